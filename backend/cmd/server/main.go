@@ -7,7 +7,11 @@ import (
 	"time"
 
 	"github.com/fujidaiti/poppo-press/backend/internal/config"
+	"github.com/fujidaiti/poppo-press/backend/internal/credentials"
 	"github.com/fujidaiti/poppo-press/backend/internal/db"
+	"github.com/fujidaiti/poppo-press/backend/internal/discovery"
+	"github.com/fujidaiti/poppo-press/backend/internal/fetcher"
+	"github.com/fujidaiti/poppo-press/backend/internal/httpclient"
 	"github.com/fujidaiti/poppo-press/backend/internal/httpserver"
 	"github.com/fujidaiti/poppo-press/backend/internal/scheduler"
 )
@@ -29,15 +33,36 @@ func main() {
 		log.Fatal(err)
 	}
 
-	srv := httpserver.New(database)
+	client, err := httpclient.New(httpclient.FromConfig(cfg))
+	if err != nil {
+		log.Fatal(err)
+	}
+	box, err := credentials.NewBox(cfg.SecretKey)
+	if err != nil {
+		log.Fatal(err)
+	}
+	rules, err := discovery.RulesFromConfig(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	srv := httpserver.New(database, httpserver.WithHTTPClient(client), httpserver.WithCredentials(box),
+		httpserver.WithRewriter(discovery.NewRewriter(rules)),
+		httpserver.WithBackfill(fetcher.FromConfig(cfg, box)),
+		httpserver.WithMaxPushBody(int64(cfg.OutboundMaxBody)))
 	// start scheduler
 	sch := scheduler.New()
-	if err := sch.HourlyFetch(database); err != nil {
+	if err := sch.FetchDue(database, cfg, client); err != nil {
+		log.Fatal(err)
+	}
+	if err := sch.WebSubRenew(database, cfg, client); err != nil {
 		log.Fatal(err)
 	}
 	if err := sch.DailyAssemble(database, cfg); err != nil {
 		log.Fatal(err)
 	}
+	if err := sch.CatchUp(database, cfg); err != nil {
+		log.Printf("edition catch-up: %v", err)
+	}
 	sch.Start()
 	log.Printf("listening on %s", cfg.HTTPAddr)
 	server := &http.Server{Addr: cfg.HTTPAddr, Handler: srv.Handler(), ReadTimeout: 10 * time.Second, WriteTimeout: 15 * time.Second, IdleTimeout: 60 * time.Second}
@@ -3,13 +3,49 @@ package aggregator
 import (
 	"context"
 	"database/sql"
+	"fmt"
 	"time"
+
+	"github.com/fujidaiti/poppo-press/backend/internal/normalize"
 )
 
-func AssembleDailyEdition(ctx context.Context, database *sql.DB, tz *time.Location, now time.Time) error {
-	localDate := now.In(tz).Format("2006-01-02")
-	windowStart := now.Add(-24 * time.Hour).UTC().Format(time.RFC3339)
-	windowEnd := now.UTC().Format(time.RFC3339)
+// DailySlot is the publish slot of editions when a single publish time is
+// configured, and of those assembled before slots existed.
+const DailySlot = "daily"
+
+// AssembleDailyEdition (re)builds the edition of the daily slot for the local
+// date of cutoff; see AssembleEdition.
+func AssembleDailyEdition(ctx context.Context, database *sql.DB, tz *time.Location, cutoff time.Time) error {
+	return AssembleEdition(ctx, database, tz, DailySlot, cutoff)
+}
+
+// firstWindow is the span of the first edition, which has no previous
+// edition to start from. It is also how long after its publish time a
+// backfilled article (the history of a new subscription or its archive) may
+// first be seen and still make an edition; older ones are old news, as are
+// backfilled articles without a publish time of their own, such as the
+// existing tags of a repository.
+const firstWindow = 24 * time.Hour
+
+// AssembleEdition (re)builds the edition of the publish slot for the local
+// date of cutoff in tz. Its window runs from the cutoff of the previous
+// edition (of any slot), or firstWindow before cutoff for the first one, up
+// to and including cutoff. An article is in the window when it arrived in it,
+// that is when both its publish time and its first sighting
+// (article.created_at) fall at or before the window's end and one of them
+// after its start. Consecutive windows thus partition time: an article
+// published before an edition but fetched after it goes into the next one,
+// and every article is in exactly one edition, however late it was fetched,
+// except for backfilled articles that are undated or were first seen more
+// than firstWindow after their publish time, which are in none. Re-running an edition keeps its window.
+//
+// Entries are ordered newest first. Articles sharing a canonical URL (see
+// normalize.CanonicalURL) appear once: the earliest published copy keeps its
+// place and the others are recorded as its alternates. Remaining entries
+// covering the same story are grouped into clusters (see clusterStories).
+func AssembleEdition(ctx context.Context, database *sql.DB, tz *time.Location, slot string, cutoff time.Time) error {
+	localDate := cutoff.In(tz).Format("2006-01-02")
+	windowEnd := cutoff.UTC().Format(time.RFC3339)
 
 	tx, err := database.BeginTx(ctx, nil)
 	if err != nil {
@@ -17,16 +53,25 @@ func AssembleDailyEdition(ctx context.Context, database *sql.DB, tz *time.Locati
 	}
 	defer func() { _ = tx.Rollback() }()
 
-	// Upsert edition row by local_date
+	var previous sql.NullString
+	if err := tx.QueryRowContext(ctx, `SELECT MAX(cutoff_at) FROM edition WHERE cutoff_at < ?`, windowEnd).Scan(&previous); err != nil {
+		return err
+	}
+	windowStart := cutoff.Add(-firstWindow).UTC().Format(time.RFC3339)
+	if previous.Valid {
+		windowStart = previous.String
+	}
+
+	// Upsert edition row by local_date and slot
 	if _, err := tx.ExecContext(ctx, `
-INSERT INTO edition(local_date, published_at, created_at)
-VALUES(?,?,COALESCE(created_at, CURRENT_TIMESTAMP))
-ON CONFLICT(local_date) DO UPDATE SET published_at=excluded.published_at
-`, localDate, now.UTC().Format(time.RFC3339)); err != nil {
+INSERT INTO edition(local_date, slot, published_at, cutoff_at, created_at)
+VALUES(?,?,?,?,CURRENT_TIMESTAMP)
+ON CONFLICT(local_date, slot) DO UPDATE SET published_at=excluded.published_at, cutoff_at=excluded.cutoff_at
+`, localDate, slot, time.Now().UTC().Format(time.RFC3339), windowEnd); err != nil {
 		return err
 	}
 	var editionID int64
-	if err := tx.QueryRowContext(ctx, `SELECT id FROM edition WHERE local_date = ?`, localDate).Scan(&editionID); err != nil {
+	if err := tx.QueryRowContext(ctx, `SELECT id FROM edition WHERE local_date = ? AND slot = ?`, localDate, slot).Scan(&editionID); err != nil {
 		return err
 	}
 
@@ -34,35 +79,72 @@ ON CONFLICT(local_date) DO UPDATE SET published_at=excluded.published_at
 	if _, err := tx.ExecContext(ctx, `DELETE FROM edition_article WHERE edition_id = ?`, editionID); err != nil {
 		return err
 	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM edition_alternate WHERE edition_id = ?`, editionID); err != nil {
+		return err
+	}
 
-	// Select last 24h articles ordered newest first
+	// Select the articles that arrived in the window, newest first; created_at
+	// defaults to SQLite's own timestamp format, so it is brought to RFC 3339
+	// for comparison
 	rows, err := tx.QueryContext(ctx, `
-SELECT id FROM article
-WHERE published_at >= ? AND published_at <= ?
+SELECT id, canonical_url, title, IFNULL(summary, '') FROM (
+  SELECT a.*, strftime('%Y-%m-%dT%H:%M:%SZ', a.created_at) AS seen_at FROM article a
+)
+WHERE MAX(published_at, seen_at) > ? AND MAX(published_at, seen_at) <= ?
+  AND NOT (backfilled AND (undated OR published_at < strftime('%Y-%m-%dT%H:%M:%SZ', seen_at, ?)))
 ORDER BY published_at DESC
-`, windowStart, windowEnd)
+`, windowStart, windowEnd, fmt.Sprintf("-%d seconds", int(firstWindow.Seconds())))
 	if err != nil {
 		return err
 	}
-	defer rows.Close()
-
-	position := 1
+	var ids []int64
+	primary := map[string]int64{} // canonical URL → earliest published copy
+	urls := map[int64]string{}
+	stories := map[int64]story{}
 	for rows.Next() {
 		var articleID int64
-		if err := rows.Scan(&articleID); err != nil {
+		var u, title, summary string
+		if err := rows.Scan(&articleID, &u, &title, &summary); err != nil {
+			_ = rows.Close()
 			return err
 		}
-		if _, err := tx.ExecContext(ctx, `
-INSERT INTO edition_article(edition_id, article_id, position)
-VALUES(?,?,?)
-`, editionID, articleID, position); err != nil {
-			return err
+		ids = append(ids, articleID)
+		stories[articleID] = newStory(articleID, title, summary)
+		if u = normalize.CanonicalURL(u); u != "" {
+			urls[articleID] = u
+			primary[u] = articleID // later rows are older
 		}
-		position++
 	}
+	_ = rows.Close()
 	if err := rows.Err(); err != nil {
 		return err
 	}
 
+	var entries []int64
+	var entryStories []story
+	for _, articleID := range ids {
+		if p, ok := primary[urls[articleID]]; ok && p != articleID {
+			if _, err := tx.ExecContext(ctx, `
+INSERT INTO edition_alternate(edition_id, article_id, alternate_id)
+VALUES(?,?,?)
+`, editionID, p, articleID); err != nil {
+				return err
+			}
+			continue
+		}
+		entries = append(entries, articleID)
+		entryStories = append(entryStories, stories[articleID])
+	}
+
+	clusters := clusterStories(entryStories)
+	for i, articleID := range entries {
+		if _, err := tx.ExecContext(ctx, `
+INSERT INTO edition_article(edition_id, article_id, position, cluster_id)
+VALUES(?,?,?,?)
+`, editionID, articleID, i+1, clusters[articleID]); err != nil {
+			return err
+		}
+	}
+
 	return tx.Commit()
 }
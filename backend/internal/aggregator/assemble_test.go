@@ -3,6 +3,8 @@ package aggregator
 import (
 	"context"
 	"database/sql"
+	"fmt"
+	"math/rand/v2"
 	"testing"
 	"time"
 
@@ -47,6 +49,186 @@ func TestAssembleDailyEdition_IdempotentAndOrdered(t *testing.T) {
 	assertPositions(t, db, edID, []int64{3, 2, 1})
 }
 
+func TestAssembleDailyEdition_CollapsesSameStory(t *testing.T) {
+	db, cleanup := testutil.OpenTestDB(t, "admin-pass")
+	defer cleanup()
+	now := time.Date(2025, 10, 19, 8, 0, 0, 0, time.UTC)
+
+	origin := insertSource(t, db, "https://ex/feed")
+	aggregator := insertSource(t, db, "https://planet.example/rss")
+	insertArticleURL(t, db, origin, 1, "https://Ex.org/story#top", now.Add(-3*time.Hour))
+	insertArticleURL(t, db, aggregator, 2, "https://ex.org/story?utm_source=planet&utm_medium=rss", now.Add(-1*time.Hour))
+	insertArticleURL(t, db, aggregator, 3, "https://ex.org/other", now.Add(-2*time.Hour))
+
+	if err := AssembleDailyEdition(context.Background(), db, time.UTC, now); err != nil {
+		t.Fatalf("assemble: %v", err)
+	}
+	edID := getEditionID(t, db, "2025-10-19")
+	assertPositions(t, db, edID, []int64{3, 1})
+
+	var primary, alternate int64
+	if err := db.QueryRow("SELECT article_id, alternate_id FROM edition_alternate WHERE edition_id = ?", edID).Scan(&primary, &alternate); err != nil {
+		t.Fatalf("alternate: %v", err)
+	}
+	if primary != 1 || alternate != 2 {
+		t.Fatalf("got alternate %d of %d, want 2 of 1", alternate, primary)
+	}
+}
+
+func TestAssembleEdition_SlotsOfADay(t *testing.T) {
+	db, cleanup := testutil.OpenTestDB(t, "admin-pass")
+	defer cleanup()
+	tokyo := time.FixedZone("JST", 9*60*60)
+	morning := time.Date(2025, 10, 19, 7, 0, 0, 0, tokyo)
+	evening := time.Date(2025, 10, 19, 19, 0, 0, 0, tokyo)
+
+	srcID := insertSource(t, db, "https://ex/feed")
+	insertArticle(t, db, srcID, 1, morning.Add(-time.Hour))
+	insertArticle(t, db, srcID, 2, evening.Add(-time.Hour))
+
+	for _, run := range []struct {
+		slot string
+		at   time.Time
+	}{{"morning", morning}, {"evening", evening}, {"morning", morning}} {
+		if err := AssembleEdition(context.Background(), db, tokyo, run.slot, run.at); err != nil {
+			t.Fatalf("assemble %s: %v", run.slot, err)
+		}
+	}
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM edition WHERE local_date = '2025-10-19'").Scan(&n); err != nil || n != 2 {
+		t.Fatalf("expected one edition per slot, got %d (%v)", n, err)
+	}
+	var morningID, eveningID int64
+	_ = db.QueryRow("SELECT id FROM edition WHERE slot = 'morning'").Scan(&morningID)
+	_ = db.QueryRow("SELECT id FROM edition WHERE slot = 'evening'").Scan(&eveningID)
+	assertPositions(t, db, morningID, []int64{1})
+	// the evening edition starts where the morning one ended
+	assertPositions(t, db, eveningID, []int64{2})
+}
+
+func TestAssembleEdition_LateArrivalsGoToTheNextEdition(t *testing.T) {
+	db, cleanup := testutil.OpenTestDB(t, "admin-pass")
+	defer cleanup()
+	first := time.Date(2025, 10, 19, 8, 0, 0, 0, time.UTC)
+	second := first.Add(24 * time.Hour)
+
+	srcID := insertSource(t, db, "https://ex/feed")
+	insertArticle(t, db, srcID, 1, first.Add(-time.Hour))
+	// published before the first edition, fetched after it
+	insertArticleSeen(t, db, srcID, 2, "https://ex/a/2", first.Add(-2*time.Hour), first.Add(time.Hour), false)
+	// history of a new subscription
+	insertArticleSeen(t, db, srcID, 3, "https://ex/a/3", first.Add(-72*time.Hour), first.Add(2*time.Hour), true)
+	// polled two days late, e.g. after a long backoff
+	insertArticleSeen(t, db, srcID, 4, "https://ex/a/4", first.Add(-48*time.Hour), first.Add(3*time.Hour), false)
+
+	for _, at := range []time.Time{first, second} {
+		if err := AssembleDailyEdition(context.Background(), db, time.UTC, at); err != nil {
+			t.Fatalf("assemble: %v", err)
+		}
+	}
+	assertPositions(t, db, getEditionID(t, db, "2025-10-19"), []int64{1})
+	assertPositions(t, db, getEditionID(t, db, "2025-10-20"), []int64{2, 4})
+}
+
+// TestAssembleEdition_EveryArticleOnce checks on random articles that
+// consecutive editions, across a DST change and with editions missed, hold
+// every article exactly once, in the edition whose window it arrived in.
+func TestAssembleEdition_EveryArticleOnce(t *testing.T) {
+	db, cleanup := testutil.OpenTestDB(t, "admin-pass")
+	defer cleanup()
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("no tzdata: %v", err)
+	}
+	rng := rand.New(rand.NewPCG(1, 2))
+
+	// morning and evening editions around the switch to summer time on
+	// 2025-03-30, some of them missed
+	var cutoffs []time.Time
+	for day := 27; day <= 31; day++ {
+		for _, hour := range []int{7, 19} {
+			if rng.IntN(4) == 0 {
+				continue
+			}
+			cutoffs = append(cutoffs, time.Date(2025, 3, day, hour, 0, 0, 0, berlin))
+		}
+	}
+	start := cutoffs[0].Add(-firstWindow)
+	end := cutoffs[len(cutoffs)-1]
+
+	type arrival struct {
+		published, seen time.Time
+		backfilled      bool
+	}
+	srcID := insertSource(t, db, "https://ex/feed")
+	articles := map[int64]arrival{}
+	for id := int64(1); id <= 400; id++ {
+		seen := start.Add(-12 * time.Hour).Add(time.Duration(rng.Int64N(int64(end.Sub(start) + 24*time.Hour)))).Truncate(time.Second)
+		// some are first seen more than a day after their publish time
+		published := seen.Add(-time.Duration(rng.Int64N(int64(72 * time.Hour)))).Truncate(time.Second)
+		if rng.IntN(10) == 0 {
+			// dated in the future
+			published = seen.Add(time.Duration(rng.Int64N(int64(3 * time.Hour)))).Truncate(time.Second)
+		}
+		a := arrival{published, seen, rng.IntN(5) == 0}
+		articles[id] = a
+		insertArticleSeen(t, db, srcID, id, fmt.Sprintf("https://ex/a/%d", id), a.published, a.seen, a.backfilled)
+	}
+	// polled long after its publish time, well inside the editions
+	late := int64(len(articles) + 1)
+	articles[late] = arrival{published: cutoffs[1].Add(-50 * time.Hour), seen: cutoffs[1].Add(-time.Minute)}
+	insertArticleSeen(t, db, srcID, late, "https://ex/late", articles[late].published, articles[late].seen, false)
+
+	editions := make([]int64, len(cutoffs))
+	for i, c := range cutoffs {
+		if err := AssembleEdition(context.Background(), db, berlin, fmt.Sprintf("h%d", c.In(berlin).Hour()), c); err != nil {
+			t.Fatalf("assemble %s: %v", c, err)
+		}
+		if err := db.QueryRow("SELECT id FROM edition WHERE cutoff_at = ?", c.UTC().Format(time.RFC3339)).Scan(&editions[i]); err != nil {
+			t.Fatalf("edition of %s: %v", c, err)
+		}
+	}
+	// re-running an earlier edition keeps its window
+	if err := AssembleEdition(context.Background(), db, berlin, fmt.Sprintf("h%d", cutoffs[2].In(berlin).Hour()), cutoffs[2]); err != nil {
+		t.Fatalf("re-assemble: %v", err)
+	}
+
+	in := map[int64][]int64{} // article → editions
+	rows, err := db.Query(`SELECT edition_id, article_id FROM edition_article
+UNION ALL SELECT edition_id, alternate_id FROM edition_alternate`)
+	if err != nil {
+		t.Fatalf("memberships: %v", err)
+	}
+	for rows.Next() {
+		var ed, a int64
+		if err := rows.Scan(&ed, &a); err != nil {
+			t.Fatalf("scan: %v", err)
+		}
+		in[a] = append(in[a], ed)
+	}
+	_ = rows.Close()
+
+	for id, a := range articles {
+		at := a.seen
+		if a.published.After(at) {
+			at = a.published
+		}
+		var want []int64
+		if !a.backfilled || !a.published.Before(a.seen.Add(-firstWindow)) {
+			prev := start
+			for i, c := range cutoffs {
+				if at.After(prev) && !at.After(c) {
+					want = []int64{editions[i]}
+				}
+				prev = c
+			}
+		}
+		if fmt.Sprint(in[id]) != fmt.Sprint(want) {
+			t.Errorf("article %d (published %s, seen %s) in editions %v, want %v", id, a.published, a.seen, in[id], want)
+		}
+	}
+}
+
 func insertSource(t *testing.T, db *sql.DB, url string) int64 {
 	t.Helper()
 	res, err := db.Exec("INSERT INTO source(url, created_at) VALUES(?, ?)", url, time.Now().UTC().Format(time.RFC3339))
@@ -59,8 +241,20 @@ func insertSource(t *testing.T, db *sql.DB, url string) int64 {
 
 func insertArticle(t *testing.T, db *sql.DB, srcID int64, aid int64, published time.Time) {
 	t.Helper()
-	_, err := db.Exec(`INSERT INTO article(id, source_id, canonical_url, title, published_at, created_at, canonical_id)
-VALUES(?,?,?,?,?,?,?)`, aid, srcID, "https://ex/a", "t", published.UTC().Format(time.RFC3339), time.Now().UTC().Format(time.RFC3339), aid)
+	insertArticleURL(t, db, srcID, aid, fmt.Sprintf("https://ex/a/%d", aid), published)
+}
+
+func insertArticleURL(t *testing.T, db *sql.DB, srcID int64, aid int64, url string, published time.Time) {
+	t.Helper()
+	insertArticleSeen(t, db, srcID, aid, url, published, published, false)
+}
+
+// insertArticleSeen inserts an article first fetched at seen, stored as
+// SQLite's CURRENT_TIMESTAMP would, by a backfill or not.
+func insertArticleSeen(t *testing.T, db *sql.DB, srcID int64, aid int64, url string, published, seen time.Time, backfilled bool) {
+	t.Helper()
+	_, err := db.Exec(`INSERT INTO article(id, source_id, canonical_url, title, published_at, created_at, canonical_id, backfilled)
+VALUES(?,?,?,?,?,?,?,?)`, aid, srcID, url, "t", published.UTC().Format(time.RFC3339), seen.UTC().Format(time.DateTime), aid, backfilled)
 	if err != nil {
 		t.Fatalf("insert article: %v", err)
 	}
@@ -0,0 +1,156 @@
+package aggregator
+
+import (
+	"hash/fnv"
+	"math/bits"
+	"strings"
+	"unicode"
+
+	"github.com/fujidaiti/poppo-press/backend/internal/normalize"
+)
+
+// Thresholds for treating two articles as coverage of the same story. Titles
+// are compared by the Jaccard similarity of their content words, of which
+// enough non-numeric ones must be shared that "Go 1.25 released" and
+// "Rust 1.25 released" stay apart; summaries by the Hamming distance of the
+// simhashes of their content words, computed only for summaries long enough
+// for a simhash to mean something. Summaries this short make a looser
+// distance than usual for documents necessary: a reworded sentence lands
+// around 6 bits apart, unrelated text around 30.
+const (
+	titleSimilarity = 0.5
+	minSharedWords  = 3
+	simhashDistance = 6
+	minSimhashWords = 8
+)
+
+// stopWords are skipped when comparing titles and summaries.
+var stopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true, "be": true,
+	"by": true, "for": true, "from": true, "has": true, "have": true, "in": true, "is": true,
+	"it": true, "its": true, "of": true, "on": true, "or": true, "that": true, "the": true,
+	"this": true, "to": true, "was": true, "were": true, "will": true, "with": true,
+}
+
+// story is an edition candidate as seen by clustering.
+type story struct {
+	id      int64
+	title   map[string]bool // content words of the title
+	simhash uint64          // simhash of summary words; 0 for short summaries
+}
+
+// newStory computes the similarity features of an article; summary is the
+// stored HTML summary.
+func newStory(id int64, title, summary string) story {
+	s := story{id: id, title: map[string]bool{}}
+	for _, w := range contentWords(title) {
+		s.title[w] = true
+	}
+	if sw := contentWords(normalize.ToText(summary)); len(sw) >= minSimhashWords {
+		s.simhash = simhash(sw)
+	}
+	return s
+}
+
+// similar reports whether two stories look like coverage of the same event.
+func similar(a, b story) bool {
+	if shared, j := overlap(a.title, b.title); shared >= minSharedWords && j >= titleSimilarity {
+		return true
+	}
+	return a.simhash != 0 && b.simhash != 0 && bits.OnesCount64(a.simhash^b.simhash) <= simhashDistance
+}
+
+// clusterStories groups similar stories (single linkage) and returns the
+// cluster of each story, identified by the id of its primary: the last
+// member in the given order. Stories given newest first thus cluster under
+// their earliest coverage.
+func clusterStories(stories []story) map[int64]int64 {
+	parent := make([]int, len(stories))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	for i := range stories {
+		for j := i + 1; j < len(stories); j++ {
+			if find(i) != find(j) && similar(stories[i], stories[j]) {
+				// keep the later (older) story as the root
+				parent[find(i)] = find(j)
+			}
+		}
+	}
+	primary := map[int]int64{}
+	for i := range stories {
+		primary[find(i)] = stories[i].id
+	}
+	out := make(map[int64]int64, len(stories))
+	for i, s := range stories {
+		out[s.id] = primary[find(i)]
+	}
+	return out
+}
+
+// contentWords splits text into lowercase words of letters and digits,
+// dropping stop words.
+func contentWords(text string) []string {
+	var out []string
+	for _, w := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	}) {
+		if !stopWords[w] {
+			out = append(out, w)
+		}
+	}
+	return out
+}
+
+// simhash computes a 64-bit simhash of features, or 0 when there are none.
+func simhash(features []string) uint64 {
+	if len(features) == 0 {
+		return 0
+	}
+	var weights [64]int
+	for _, f := range features {
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(f))
+		v := h.Sum64()
+		for i := range weights {
+			if v&(1<<i) != 0 {
+				weights[i]++
+			} else {
+				weights[i]--
+			}
+		}
+	}
+	var out uint64
+	for i, w := range weights {
+		if w > 0 {
+			out |= 1 << i
+		}
+	}
+	return out
+}
+
+// overlap returns how many words containing a letter two word sets share
+// and their Jaccard similarity (0 when either is empty).
+func overlap(a, b map[string]bool) (int, float64) {
+	if len(a) == 0 || len(b) == 0 {
+		return 0, 0
+	}
+	inter, shared := 0, 0
+	for w := range a {
+		if !b[w] {
+			continue
+		}
+		inter++
+		if strings.IndexFunc(w, unicode.IsLetter) >= 0 {
+			shared++
+		}
+	}
+	return shared, float64(inter) / float64(len(a)+len(b)-inter)
+}
@@ -0,0 +1,23 @@
+package aggregator
+
+import "testing"
+
+func TestClusterStories(t *testing.T) {
+	summary := "<p>The company showed the new phone, a thinner design and a faster chip, at its annual event in California on Tuesday.</p>"
+	stories := []story{
+		newStory(1, "Apple unveils iPhone 17 at its September event", ""),
+		newStory(2, "Go 1.25 released", ""),
+		newStory(3, "Apple unveils new iPhone 17 at September event", ""),
+		newStory(4, "Rust 1.25 released", ""),
+		newStory(5, "Hands-on with the latest phone", summary),
+		newStory(7, "A first look", "<p>The city council approved the new budget on Tuesday after a long debate about parks, roads and schools.</p>"),
+		newStory(6, "A first look", "<p>At its annual event in California on Tuesday the company showed a new phone with a thinner design and a faster chip.</p>"),
+	}
+	got := clusterStories(stories)
+	want := map[int64]int64{1: 3, 2: 2, 3: 3, 4: 4, 5: 6, 6: 6, 7: 7}
+	for id, c := range want {
+		if got[id] != c {
+			t.Errorf("story %d: cluster %d, want %d", id, got[id], c)
+		}
+	}
+}
@@ -5,6 +5,9 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -12,10 +15,79 @@ import (
 // Config holds runtime configuration for the server and scheduler.
 // Fields are mapped from YAML keys and can be overridden by environment vars.
 type Config struct {
-	HTTPAddr    string `yaml:"http_addr"`
-	DBPath      string `yaml:"db_path"`
-	Timezone    string `yaml:"timezone"`
-	PublishTime string `yaml:"publish_time"`
+	HTTPAddr string `yaml:"http_addr"`
+	DBPath   string `yaml:"db_path"`
+
+	// Timezone is the IANA zone editions are published in. PublishTime lists
+	// the publish times, comma-separated "HH:MM" or "name=HH:MM"; each names
+	// an edition slot ("daily" for a single unnamed time). Editions missed
+	// while the server was down or asleep are assembled afterwards, going
+	// back at most PublishCatchUp; a negative value disables this.
+	Timezone       string        `yaml:"timezone"`
+	PublishTime    string        `yaml:"publish_time"`
+	PublishCatchUp time.Duration `yaml:"publish_catch_up"`
+
+	// Fetch tunes the polling engine: how often due sources are checked,
+	// concurrency, per-host caps, the per-source and per-run deadlines,
+	// backoff after failures, the bounds of per-source intervals, and how many
+	// consecutive permanent redirects rewrite a source URL.
+	FetchTick          time.Duration `yaml:"fetch_tick"`
+	FetchWorkers       int           `yaml:"fetch_workers"`
+	FetchPerHost       int           `yaml:"fetch_per_host"`
+	FetchSourceTimeout time.Duration `yaml:"fetch_source_timeout"`
+	FetchRunTimeout    time.Duration `yaml:"fetch_run_timeout"`
+	FetchBackoffBase   time.Duration `yaml:"fetch_backoff_base"`
+	FetchBackoffMax    time.Duration `yaml:"fetch_backoff_max"`
+	FetchInterval      time.Duration `yaml:"fetch_interval"`
+	FetchIntervalMin   time.Duration `yaml:"fetch_interval_min"`
+	FetchIntervalMax   time.Duration `yaml:"fetch_interval_max"`
+	FetchRedirects     int           `yaml:"fetch_redirect_threshold"`
+
+	// Backfill bounds the fetch that follows adding a source: how many
+	// archive pages (RFC 5005) are walked, -1 for none, and how old items
+	// may be before the walk stops, 0 for no limit.
+	BackfillPages  int           `yaml:"backfill_pages"`
+	BackfillMaxAge time.Duration `yaml:"backfill_max_age"`
+
+	// Outbound configures requests made for sources (polling, probing, page
+	// extraction, WebSub): an optional proxy, an extra PEM CA bundle, the
+	// User-Agent, request and connect timeouts, the redirect limit, and
+	// headers per source host or URL prefix (file only), destinations
+	// exempt from the private address guard (CIDRs, addresses or host
+	// names), and the response size limit in bytes. Unset fields use the
+	// httpclient defaults.
+	OutboundProxy        string                       `yaml:"outbound_proxy"`
+	OutboundCAFile       string                       `yaml:"outbound_ca_file"`
+	OutboundUserAgent    string                       `yaml:"outbound_user_agent"`
+	OutboundTimeout      time.Duration                `yaml:"outbound_timeout"`
+	OutboundDialTimeout  time.Duration                `yaml:"outbound_dial_timeout"`
+	OutboundMaxRedirects int                          `yaml:"outbound_max_redirects"`
+	OutboundHeaders      map[string]map[string]string `yaml:"outbound_headers"`
+	OutboundAllowPrivate []string                     `yaml:"outbound_allow_private"`
+	OutboundMaxBody      int                          `yaml:"outbound_max_body"`
+
+	// PublicURL is the externally reachable base URL of the server. WebSub
+	// push subscriptions are only made when it is set, since hubs must be
+	// able to reach the callback. WebSubLease is the lease requested.
+	PublicURL   string        `yaml:"public_url"`
+	WebSubLease time.Duration `yaml:"websub_lease"`
+
+	// SecretKey encrypts source credentials at rest: 32 random bytes,
+	// base64-encoded. Sources cannot be given credentials without it.
+	SecretKey string `yaml:"secret_key"`
+
+	// SourceRewrites map web URLs of sites without usable feed discovery to
+	// their feeds when sources are added, ahead of the built-in rules (file
+	// only).
+	SourceRewrites []RewriteRule `yaml:"source_rewrites"`
+}
+
+// RewriteRule rewrites source URLs matching the regular expression Match to
+// Feed, in which $1 or ${name} stand for the match's groups.
+type RewriteRule struct {
+	Name  string `yaml:"name"`
+	Match string `yaml:"match"`
+	Feed  string `yaml:"feed"`
 }
 
 // Load returns a Config by merging defaults, a YAML config file, and
@@ -35,6 +107,48 @@ func Load() Config {
 	if cfg.PublishTime == "" {
 		cfg.PublishTime = "08:00"
 	}
+	if cfg.PublishCatchUp == 0 {
+		cfg.PublishCatchUp = 48 * time.Hour
+	}
+	if cfg.FetchTick == 0 {
+		cfg.FetchTick = 5 * time.Minute
+	}
+	if cfg.FetchWorkers == 0 {
+		cfg.FetchWorkers = 8
+	}
+	if cfg.FetchPerHost == 0 {
+		cfg.FetchPerHost = 2
+	}
+	if cfg.FetchSourceTimeout == 0 {
+		cfg.FetchSourceTimeout = 20 * time.Second
+	}
+	if cfg.FetchRunTimeout == 0 {
+		cfg.FetchRunTimeout = 50 * time.Minute
+	}
+	if cfg.FetchBackoffBase == 0 {
+		cfg.FetchBackoffBase = 10 * time.Minute
+	}
+	if cfg.FetchBackoffMax == 0 {
+		cfg.FetchBackoffMax = 24 * time.Hour
+	}
+	if cfg.FetchInterval == 0 {
+		cfg.FetchInterval = time.Hour
+	}
+	if cfg.FetchIntervalMin == 0 {
+		cfg.FetchIntervalMin = 15 * time.Minute
+	}
+	if cfg.FetchIntervalMax == 0 {
+		cfg.FetchIntervalMax = 24 * time.Hour
+	}
+	if cfg.FetchRedirects == 0 {
+		cfg.FetchRedirects = 3
+	}
+	if cfg.BackfillPages == 0 {
+		cfg.BackfillPages = 10
+	}
+	if cfg.WebSubLease == 0 {
+		cfg.WebSubLease = 240 * time.Hour
+	}
 
 	// env overrides
 	if v := os.Getenv("PP_HTTP_ADDR"); v != "" {
@@ -49,9 +163,66 @@ func Load() Config {
 	if v := os.Getenv("PP_PUBLISH_TIME"); v != "" {
 		cfg.PublishTime = v
 	}
+	envDuration("PP_PUBLISH_CATCH_UP", &cfg.PublishCatchUp)
+	envDuration("PP_FETCH_TICK", &cfg.FetchTick)
+	envInt("PP_FETCH_WORKERS", &cfg.FetchWorkers)
+	envInt("PP_FETCH_PER_HOST", &cfg.FetchPerHost)
+	envDuration("PP_FETCH_SOURCE_TIMEOUT", &cfg.FetchSourceTimeout)
+	envDuration("PP_FETCH_RUN_TIMEOUT", &cfg.FetchRunTimeout)
+	envDuration("PP_FETCH_BACKOFF_BASE", &cfg.FetchBackoffBase)
+	envDuration("PP_FETCH_BACKOFF_MAX", &cfg.FetchBackoffMax)
+	envDuration("PP_FETCH_INTERVAL", &cfg.FetchInterval)
+	envDuration("PP_FETCH_INTERVAL_MIN", &cfg.FetchIntervalMin)
+	envDuration("PP_FETCH_INTERVAL_MAX", &cfg.FetchIntervalMax)
+	envInt("PP_FETCH_REDIRECT_THRESHOLD", &cfg.FetchRedirects)
+	envInt("PP_BACKFILL_PAGES", &cfg.BackfillPages)
+	envDuration("PP_BACKFILL_MAX_AGE", &cfg.BackfillMaxAge)
+	if v := os.Getenv("PP_OUTBOUND_PROXY"); v != "" {
+		cfg.OutboundProxy = v
+	}
+	if v := os.Getenv("PP_OUTBOUND_CA_FILE"); v != "" {
+		cfg.OutboundCAFile = v
+	}
+	if v := os.Getenv("PP_OUTBOUND_USER_AGENT"); v != "" {
+		cfg.OutboundUserAgent = v
+	}
+	envDuration("PP_OUTBOUND_TIMEOUT", &cfg.OutboundTimeout)
+	envDuration("PP_OUTBOUND_DIAL_TIMEOUT", &cfg.OutboundDialTimeout)
+	envInt("PP_OUTBOUND_MAX_REDIRECTS", &cfg.OutboundMaxRedirects)
+	if v := os.Getenv("PP_OUTBOUND_ALLOW_PRIVATE"); v != "" {
+		cfg.OutboundAllowPrivate = strings.Split(v, ",")
+	}
+	envInt("PP_OUTBOUND_MAX_BODY", &cfg.OutboundMaxBody)
+	if v := os.Getenv("PP_PUBLIC_URL"); v != "" {
+		cfg.PublicURL = v
+	}
+	envDuration("PP_WEBSUB_LEASE", &cfg.WebSubLease)
+	if v := os.Getenv("PP_SECRET_KEY"); v != "" {
+		cfg.SecretKey = v
+	}
 	return cfg
 }
 
+// envInt overwrites dst with the integer value of the named environment
+// variable when it is set and well-formed.
+func envInt(name string, dst *int) {
+	if v := os.Getenv(name); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			*dst = n
+		}
+	}
+}
+
+// envDuration overwrites dst with the duration value (e.g. "30s") of the
+// named environment variable when it is set and well-formed.
+func envDuration(name string, dst *time.Duration) {
+	if v := os.Getenv(name); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			*dst = d
+		}
+	}
+}
+
 // fromFile reads configuration from a YAML file path resolved from PP_CONFIG
 // or the default location under ~/.config/poppo-press/config.yaml.
 func fromFile() Config {
@@ -0,0 +1,187 @@
+// Package credentials holds the secrets some feeds require (HTTP Basic auth,
+// a bearer token, or a token in the query string), seals them for storage
+// with a server key, and applies them to outbound requests.
+package credentials
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Credential types.
+const (
+	TypeBasic  = "basic"  // HTTP Basic auth with Username and Password
+	TypeBearer = "bearer" // Authorization: Bearer Token
+	TypeQuery  = "query"  // Token sent as the query parameter Param
+)
+
+// ErrNoKey is returned when credentials are to be sealed or opened but no
+// server key is configured.
+var ErrNoKey = errors.New("credentials: no secret key configured")
+
+// Credential is the secret used to fetch one source.
+type Credential struct {
+	Type     string `json:"type"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	Token    string `json:"token,omitempty"`
+	Param    string `json:"param,omitempty"`
+}
+
+// Validate reports whether c is complete for its type.
+func (c Credential) Validate() error {
+	switch c.Type {
+	case TypeBasic:
+		if c.Username == "" {
+			return errors.New("basic auth requires a username")
+		}
+	case TypeBearer:
+		if c.Token == "" {
+			return errors.New("bearer auth requires a token")
+		}
+	case TypeQuery:
+		if c.Param == "" || c.Token == "" {
+			return errors.New("query auth requires a param and a token")
+		}
+	default:
+		return fmt.Errorf("unknown auth type %q", c.Type)
+	}
+	return nil
+}
+
+// Apply adds the credential to req.
+func (c Credential) Apply(req *http.Request) {
+	switch c.Type {
+	case TypeBasic:
+		req.SetBasicAuth(c.Username, c.Password)
+	case TypeBearer:
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	case TypeQuery:
+		q := req.URL.Query()
+		q.Set(c.Param, c.Token)
+		req.URL.RawQuery = q.Encode()
+	}
+}
+
+// Redact returns a copy of u without the parts that can carry a secret: its
+// userinfo and, for TypeQuery, the query parameter of c. A server that keeps
+// the query on a redirect echoes the token back in Location, so URLs learned
+// from responses are redacted before they are stored.
+func (c Credential) Redact(u *url.URL) *url.URL {
+	out := *u
+	out.User = nil
+	if c.Type == TypeQuery && c.Param != "" {
+		q := out.Query()
+		if q.Has(c.Param) {
+			q.Del(c.Param)
+			out.RawQuery = q.Encode()
+		}
+	}
+	return &out
+}
+
+// Client returns a copy of base that applies c to requests for host only,
+// so that redirects and links to other hosts never carry the secret. The
+// request URLs seen by the caller, and so those in errors and redirect
+// chains, stay free of it.
+func (c Credential) Client(base *http.Client, host string) *http.Client {
+	out := *base
+	rt := base.Transport
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	out.Transport = &transport{base: rt, cred: c, host: strings.ToLower(host)}
+	return &out
+}
+
+// transport applies a credential to requests for one host.
+type transport struct {
+	base http.RoundTripper
+	cred Credential
+	host string
+}
+
+// RoundTrip implements http.RoundTripper on a copy of req.
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if strings.ToLower(req.URL.Host) != t.host {
+		return t.base.RoundTrip(req)
+	}
+	req = req.Clone(req.Context())
+	t.cred.Apply(req)
+	return t.base.RoundTrip(req)
+}
+
+// Box seals and opens credentials with AES-256-GCM.
+type Box struct {
+	aead cipher.AEAD
+}
+
+// NewBox returns a Box for a base64-encoded 32-byte key, or nil when key is
+// empty so that credentials are simply unavailable.
+func NewBox(key string) (*Box, error) {
+	if key == "" {
+		return nil, nil
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(key))
+	if err != nil || len(raw) != 32 {
+		return nil, errors.New("credentials: secret key must be 32 bytes, base64-encoded")
+	}
+	block, err := aes.NewCipher(raw)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Box{aead: aead}, nil
+}
+
+// Seal encrypts c for the source with the given id. The id is bound to the
+// ciphertext, which therefore cannot be moved to another source.
+func (b *Box) Seal(sourceID int64, c Credential) ([]byte, error) {
+	if b == nil {
+		return nil, ErrNoKey
+	}
+	plain, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, b.aead.NonceSize(), b.aead.NonceSize()+len(plain)+b.aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return b.aead.Seal(nonce, nonce, plain, additionalData(sourceID)), nil
+}
+
+// Open decrypts a credential sealed for the source with the given id.
+func (b *Box) Open(sourceID int64, sealed []byte) (Credential, error) {
+	var c Credential
+	if b == nil {
+		return c, ErrNoKey
+	}
+	n := b.aead.NonceSize()
+	if len(sealed) < n {
+		return c, errors.New("credentials: sealed value too short")
+	}
+	plain, err := b.aead.Open(nil, sealed[:n], sealed[n:], additionalData(sourceID))
+	if err != nil {
+		return c, fmt.Errorf("credentials: open: %w", err)
+	}
+	err = json.Unmarshal(plain, &c)
+	return c, err
+}
+
+// additionalData binds a sealed credential to its source.
+func additionalData(sourceID int64) []byte {
+	return []byte("source:" + strconv.FormatInt(sourceID, 10))
+}
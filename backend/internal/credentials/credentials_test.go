@@ -0,0 +1,86 @@
+package credentials
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// testKey is a well-formed secret key.
+var testKey = base64.StdEncoding.EncodeToString([]byte(strings.Repeat("k", 32)))
+
+func TestBox_SealAndOpen(t *testing.T) {
+	box, err := NewBox(testKey)
+	if err != nil {
+		t.Fatalf("new box: %v", err)
+	}
+	cred := Credential{Type: TypeBasic, Username: "me", Password: "s3cret"}
+	sealed, err := box.Seal(7, cred)
+	if err != nil {
+		t.Fatalf("seal: %v", err)
+	}
+	if strings.Contains(string(sealed), "s3cret") {
+		t.Fatalf("sealed value contains the password")
+	}
+	got, err := box.Open(7, sealed)
+	if err != nil || got != cred {
+		t.Fatalf("open: %+v %v", got, err)
+	}
+	// a credential moved to another source does not open
+	if _, err := box.Open(8, sealed); err == nil {
+		t.Fatalf("expected error opening for another source")
+	}
+
+	if b, err := NewBox(""); b != nil || err != nil {
+		t.Fatalf("expected no box without a key, got %v %v", b, err)
+	}
+	if _, err := NewBox("c2hvcnQ="); err == nil {
+		t.Fatalf("expected error for a short key")
+	}
+	var none *Box
+	if _, err := none.Seal(1, cred); err != ErrNoKey {
+		t.Fatalf("expected ErrNoKey, got %v", err)
+	}
+}
+
+func TestCredential_ClientScopesToHost(t *testing.T) {
+	var seen []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = append(seen, r.Header.Get("Authorization")+"|"+r.URL.Query().Get("key"))
+	}))
+	defer srv.Close()
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+
+	for _, tc := range []struct {
+		cred Credential
+		want string
+	}{
+		{Credential{Type: TypeBearer, Token: "tok"}, "Bearer tok|"},
+		{Credential{Type: TypeQuery, Param: "key", Token: "tok"}, "|tok"},
+	} {
+		seen = nil
+		c := tc.cred.Client(http.DefaultClient, req.URL.Host)
+		resp, err := c.Get(srv.URL + "/feed")
+		if err != nil {
+			t.Fatalf("get: %v", err)
+		}
+		_ = resp.Body.Close()
+		// requests for another host (here the same server under another
+		// name) are sent without the credential
+		other := strings.Replace(srv.URL, "127.0.0.1", "localhost", 1)
+		resp, err = c.Get(other + "/feed")
+		if err != nil {
+			t.Fatalf("get other host: %v", err)
+		}
+		_ = resp.Body.Close()
+		if len(seen) != 2 || seen[0] != tc.want || seen[1] != "|" {
+			t.Fatalf("%s: unexpected requests %q", tc.cred.Type, seen)
+		}
+	}
+
+	if err := (Credential{Type: TypeQuery, Token: "tok"}).Validate(); err == nil {
+		t.Fatalf("expected query auth without param to be invalid")
+	}
+}
@@ -3,6 +3,8 @@ package db
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
 )
 
 type UpsertArticleParams struct {
@@ -12,26 +14,143 @@ type UpsertArticleParams struct {
 	Summary      string
 	Content      string
 	Author       string
-	PublishedAt  string
+	ImageURL     string // lead image; "" keeps the stored one
+	PublishedAt  string // "" when the feed gives no date; the article is then recorded as undated
 	UpdatedAt    string
 	CanonicalID  string
+	Backfilled   bool // stored by a backfill; only recorded on insert
+	// ProvisionalURL marks CanonicalURL as a stand-in, such as a feed proxy
+	// link that could not be followed: an update keeps the stored URL.
+	ProvisionalURL bool
 }
 
-func UpsertArticleByCanonicalID(ctx context.Context, database *sql.DB, p UpsertArticleParams) error {
-	// Upsert by canonical_id (unique when not null)
+// UpsertArticleByCanonicalID inserts an article or updates the one of the same
+// source sharing its canonical id and returns its id. An empty Content or ImageURL keeps the
+// stored value, so a body fetched once is not erased by later summary-only
+// fetches; an empty PublishedAt keeps the stored publish time (new articles
+// fall back to UpdatedAt). An update also stores the new CanonicalURL, so
+// that articles follow changes to URL canonicalization, unless it is
+// provisional. When an update changes the title, summary, body, or publish
+// time, the previous values are kept as an article revision.
+//
+// Canonical ids are scoped by source. A new article sharing its id and title
+// (current or in a revision) with another source's article at a different
+// URL suggests that article was overwritten with this one's content while
+// ids were global; a SourceEventCollision is recorded on the other source.
+func UpsertArticleByCanonicalID(ctx context.Context, database *sql.DB, p UpsertArticleParams) (int64, error) {
+	// Upsert by (source_id, canonical_id) (unique when not null)
 	if p.CanonicalID == "" {
-		return nil
-	}
-	_, err := database.ExecContext(ctx, `
-INSERT INTO article(source_id, canonical_url, title, summary, content, author, published_at, updated_at, canonical_id)
-VALUES(?,?,?,?,?,?,?,?,?)
-ON CONFLICT(canonical_id) DO UPDATE SET
-  title=excluded.title,
-  summary=excluded.summary,
-  content=excluded.content,
-  author=excluded.author,
-  published_at=excluded.published_at,
-  updated_at=excluded.updated_at
-`, p.SourceID, p.CanonicalURL, p.Title, p.Summary, p.Content, p.Author, p.PublishedAt, p.UpdatedAt, p.CanonicalID)
-	return err
+		return 0, nil
+	}
+	tx, err := database.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var id int64
+	var old ArticleVersion
+	err = tx.QueryRowContext(ctx, `
+SELECT id, title, IFNULL(summary, ''), IFNULL(content, ''), published_at
+FROM article WHERE source_id = ? AND canonical_id = ?`, p.SourceID, p.CanonicalID).Scan(&id, &old.Title, &old.Summary, &old.Content, &old.PublishedAt)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		published := p.PublishedAt
+		if published == "" {
+			published = p.UpdatedAt
+		}
+		err = tx.QueryRowContext(ctx, `
+INSERT INTO article(source_id, canonical_url, title, summary, content, author, image_url, published_at, updated_at, canonical_id, backfilled, undated)
+VALUES(?,?,?,?,?,?,?,?,?,?,?,?)
+RETURNING id
+`, p.SourceID, p.CanonicalURL, p.Title, p.Summary, p.Content, p.Author, nullIfEmpty(p.ImageURL), published, p.UpdatedAt, p.CanonicalID, p.Backfilled, p.PublishedAt == "").Scan(&id)
+		if err != nil {
+			return 0, err
+		}
+		if err := flagCollisions(ctx, tx, id, p); err != nil {
+			return 0, err
+		}
+		return id, tx.Commit()
+	case err != nil:
+		return 0, err
+	}
+
+	next := ArticleVersion{Title: p.Title, Summary: p.Summary, Content: p.Content, PublishedAt: p.PublishedAt}
+	if next.Content == "" {
+		next.Content = old.Content
+	}
+	if next.PublishedAt == "" {
+		next.PublishedAt = old.PublishedAt
+	}
+	revisedAt := sql.NullString{}
+	if next != old {
+		revisedAt = sql.NullString{String: p.UpdatedAt, Valid: true}
+		if _, err := tx.ExecContext(ctx, `
+INSERT INTO article_revision(article_id, title, summary, content, published_at, replaced_at)
+VALUES(?,?,?,?,?,?)`, id, old.Title, old.Summary, old.Content, old.PublishedAt, p.UpdatedAt); err != nil {
+			return 0, err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `
+UPDATE article SET
+  canonical_url = CASE WHEN ? THEN canonical_url ELSE ? END,
+  title = ?, summary = ?, content = ?, author = ?,
+  image_url = COALESCE(?, image_url),
+  published_at = ?, updated_at = ?,
+  revised_at = COALESCE(?, revised_at)
+WHERE id = ?`, p.ProvisionalURL, p.CanonicalURL, next.Title, next.Summary, next.Content, p.Author, nullIfEmpty(p.ImageURL), next.PublishedAt, p.UpdatedAt, revisedAt, id); err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+// flagCollisions records a SourceEventCollision on every other source whose
+// article shares the canonical id and, now or in a revision, the title but
+// not the URL of the newly inserted article id.
+func flagCollisions(ctx context.Context, tx *sql.Tx, id int64, p UpsertArticleParams) error {
+	rows, err := tx.QueryContext(ctx, `
+SELECT a.id, a.source_id FROM article a
+WHERE a.canonical_id = ? AND a.source_id <> ? AND a.canonical_url <> ?
+  AND (a.title = ? OR EXISTS (SELECT 1 FROM article_revision r WHERE r.article_id = a.id AND r.title = ?))`,
+		p.CanonicalID, p.SourceID, p.CanonicalURL, p.Title, p.Title)
+	if err != nil {
+		return err
+	}
+	type hit struct{ article, source int64 }
+	var hits []hit
+	for rows.Next() {
+		var h hit
+		if err := rows.Scan(&h.article, &h.source); err != nil {
+			_ = rows.Close()
+			return err
+		}
+		hits = append(hits, h)
+	}
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, h := range hits {
+		detail := fmt.Sprintf("article %d (id %q) holds the content of article %d of source %d", h.article, p.CanonicalID, id, p.SourceID)
+		if err := insertSourceEvent(ctx, tx, h.source, SourceEventCollision, detail, p.UpdatedAt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ArticleHasContent reports whether the source's article with the given
+// canonical id already has a stored body.
+func ArticleHasContent(ctx context.Context, database *sql.DB, sourceID int64, canonicalID string) (bool, error) {
+	var n int
+	err := database.QueryRowContext(ctx, `SELECT COUNT(1) FROM article WHERE source_id = ? AND canonical_id = ? AND IFNULL(content, '') <> ''`, sourceID, canonicalID).Scan(&n)
+	return n > 0, err
+}
+
+// ArticleExists reports whether the source has an article with the given
+// canonical id.
+func ArticleExists(ctx context.Context, database *sql.DB, sourceID int64, canonicalID string) (bool, error) {
+	var n int
+	err := database.QueryRowContext(ctx, `SELECT COUNT(1) FROM article WHERE source_id = ? AND canonical_id = ?`, sourceID, canonicalID).Scan(&n)
+	return n > 0, err
 }
@@ -3,6 +3,8 @@ package db
 import (
 	"context"
 	"database/sql"
+	"strings"
+	"time"
 )
 
 type ArticleListRow struct {
@@ -12,26 +14,61 @@ type ArticleListRow struct {
 	Title        string
 	Summary      string
 	Author       string
+	ImageURL     string // lead image; "" when the article has none
+	SourceImage  string // the source's feed image; "" when it has none
 	PublishedAt  string
 	IsRead       bool
+	RevisedAt    string // last content change; "" when never revised
+	Updated      bool   // read on this device, then revised upstream
+	ClusterID    int64  // edition listings only: the primary of the entry's story cluster
 }
 
-func ListArticles(ctx context.Context, database *sql.DB, deviceID int64, readState string) ([]ArticleListRow, error) {
-	// readState: "read" | "unread" | "all"
+// updatedExpr is true for articles read on the device (read_state "rs")
+// and revised afterwards. julianday copes with both the RFC 3339 revision
+// times and the SQL timestamps of read_state.
+const updatedExpr = `COALESCE(rs.is_read = 1 AND julianday(a.revised_at) > julianday(rs.updated_at), 0)`
+
+// ArticleFilter narrows an article listing.
+type ArticleFilter struct {
+	ReadState string    // "read" | "unread" | "all"
+	Media     string    // one of the MediaFilter values
+	Tags      []string  // normalized tag names; articles must carry all of them
+	Since     time.Time // when non-zero, only articles published at or after it
+}
+
+func ListArticles(ctx context.Context, database *sql.DB, deviceID int64, f ArticleFilter) ([]ArticleListRow, error) {
+	var conds []string
+	if f.ReadState == "read" {
+		conds = append(conds, "rs.is_read = 1")
+	} else if f.ReadState == "unread" {
+		conds = append(conds, "(rs.is_read IS NULL OR rs.is_read = 0)")
+	}
+	if c := mediaCondition(f.Media); c != "" {
+		conds = append(conds, c)
+	}
+	args := []any{deviceID}
+	for _, t := range f.Tags {
+		conds = append(conds, tagCondition)
+		args = append(args, t)
+	}
+	if !f.Since.IsZero() {
+		conds = append(conds, "a.published_at >= ?")
+		args = append(args, f.Since.UTC().Format(time.RFC3339))
+	}
 	where := ""
-	if readState == "read" {
-		where = "WHERE rs.is_read = 1"
-	} else if readState == "unread" {
-		where = "WHERE rs.is_read IS NULL OR rs.is_read = 0"
+	if len(conds) > 0 {
+		where = "WHERE " + strings.Join(conds, " AND ")
 	}
 	q := `
-SELECT a.id, a.source_id, a.canonical_url, a.title, a.summary, a.author, a.published_at,
-       COALESCE(rs.is_read, 0) as is_read
+SELECT a.id, a.source_id, a.canonical_url, a.title, IFNULL(a.summary, ''), IFNULL(a.author, ''),
+       IFNULL(a.image_url, ''), IFNULL(s.image_url, ''), a.published_at,
+       COALESCE(rs.is_read, 0) as is_read, IFNULL(a.revised_at, ''), ` + updatedExpr + `
 FROM article a
+LEFT JOIN source s ON s.id = a.source_id
 LEFT JOIN read_state rs ON rs.article_id = a.id AND rs.device_id = ?
 ` + where + `
 ORDER BY a.published_at DESC`
-	rows, err := database.QueryContext(ctx, q, deviceID)
+	rows, err := database.QueryContext(ctx, q, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -40,7 +77,7 @@ ORDER BY a.published_at DESC`
 	for rows.Next() {
 		var r ArticleListRow
 		var isReadInt int
-		if err := rows.Scan(&r.ID, &r.SourceID, &r.CanonicalURL, &r.Title, &r.Summary, &r.Author, &r.PublishedAt, &isReadInt); err != nil {
+		if err := rows.Scan(&r.ID, &r.SourceID, &r.CanonicalURL, &r.Title, &r.Summary, &r.Author, &r.ImageURL, &r.SourceImage, &r.PublishedAt, &isReadInt, &r.RevisedAt, &r.Updated); err != nil {
 			return nil, err
 		}
 		r.IsRead = isReadInt == 1
@@ -52,18 +89,89 @@ ORDER BY a.published_at DESC`
 	return out, nil
 }
 
-func GetArticle(ctx context.Context, database *sql.DB, deviceID, id int64) (ArticleListRow, error) {
-	var r ArticleListRow
+// ListEditionArticles returns the articles of an edition in edition order,
+// narrowed by a media filter.
+func ListEditionArticles(ctx context.Context, database *sql.DB, editionID int64, media string) ([]ArticleListRow, error) {
+	where := "WHERE ea.edition_id = ?"
+	if c := mediaCondition(media); c != "" {
+		where += " AND " + c
+	}
+	rows, err := database.QueryContext(ctx, `
+SELECT a.id, a.source_id, a.canonical_url, a.title, IFNULL(a.summary, ''), IFNULL(a.author, ''),
+       IFNULL(a.image_url, ''), IFNULL(s.image_url, ''), a.published_at, IFNULL(ea.cluster_id, a.id)
+FROM edition_article ea JOIN article a ON ea.article_id = a.id
+LEFT JOIN source s ON s.id = a.source_id
+`+where+` ORDER BY ea.position`, editionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []ArticleListRow
+	for rows.Next() {
+		var r ArticleListRow
+		if err := rows.Scan(&r.ID, &r.SourceID, &r.CanonicalURL, &r.Title, &r.Summary, &r.Author, &r.ImageURL, &r.SourceImage, &r.PublishedAt, &r.ClusterID); err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// Alternate is another feed's copy of an edition article, collapsed into it
+// because both share a canonical URL.
+type Alternate struct {
+	ArticleID   int64
+	SourceID    int64
+	SourceTitle string
+	URL         string
+}
+
+// ListEditionAlternates returns the alternates of an edition keyed by the id
+// of the article they were collapsed into, oldest first.
+func ListEditionAlternates(ctx context.Context, database *sql.DB, editionID int64) (map[int64][]Alternate, error) {
+	rows, err := database.QueryContext(ctx, `
+SELECT ed.article_id, a.id, a.source_id, IFNULL(s.title, ''), a.canonical_url
+FROM edition_alternate ed
+JOIN article a ON a.id = ed.alternate_id
+LEFT JOIN source s ON s.id = a.source_id
+WHERE ed.edition_id = ?
+ORDER BY ed.article_id, a.published_at, a.id`, editionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := map[int64][]Alternate{}
+	for rows.Next() {
+		var id int64
+		var alt Alternate
+		if err := rows.Scan(&id, &alt.ArticleID, &alt.SourceID, &alt.SourceTitle, &alt.URL); err != nil {
+			return nil, err
+		}
+		out[id] = append(out[id], alt)
+	}
+	return out, rows.Err()
+}
+
+// ArticleDetailRow is a single article including its full body.
+type ArticleDetailRow struct {
+	ArticleListRow
+	Content string
+}
+
+func GetArticle(ctx context.Context, database *sql.DB, deviceID, id int64) (ArticleDetailRow, error) {
+	var r ArticleDetailRow
 	var isReadInt int
 	err := database.QueryRowContext(ctx, `
-SELECT a.id, a.source_id, a.canonical_url, a.title, a.summary, a.author, a.published_at,
-       COALESCE(rs.is_read, 0) as is_read
+SELECT a.id, a.source_id, a.canonical_url, a.title, IFNULL(a.summary, ''), IFNULL(a.content, ''), IFNULL(a.author, ''),
+       IFNULL(a.image_url, ''), IFNULL(s.image_url, ''), a.published_at,
+       COALESCE(rs.is_read, 0) as is_read, IFNULL(a.revised_at, ''), `+updatedExpr+`
 FROM article a
+LEFT JOIN source s ON s.id = a.source_id
 LEFT JOIN read_state rs ON rs.article_id = a.id AND rs.device_id = ?
 WHERE a.id = ?
-`, deviceID, id).Scan(&r.ID, &r.SourceID, &r.CanonicalURL, &r.Title, &r.Summary, &r.Author, &r.PublishedAt, &isReadInt)
+`, deviceID, id).Scan(&r.ID, &r.SourceID, &r.CanonicalURL, &r.Title, &r.Summary, &r.Content, &r.Author, &r.ImageURL, &r.SourceImage, &r.PublishedAt, &isReadInt, &r.RevisedAt, &r.Updated)
 	if err != nil {
-		return ArticleListRow{}, err
+		return ArticleDetailRow{}, err
 	}
 	r.IsRead = isReadInt == 1
 	return r, nil
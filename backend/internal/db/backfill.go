@@ -0,0 +1,77 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Backfill states.
+const (
+	BackfillRunning = "running"
+	BackfillDone    = "done"
+	BackfillFailed  = "failed"
+)
+
+// SourceBackfill reports the progress of the fetch that follows adding a
+// source: the feed documents read so far (the feed itself and its archive
+// pages) and the items stored from them.
+type SourceBackfill struct {
+	State      string // BackfillRunning, BackfillDone or BackfillFailed
+	Pages      int
+	Items      int
+	Error      *string // why it stopped early; nil unless failed
+	StartedAt  string
+	FinishedAt *string
+}
+
+// StartBackfill records that a backfill of the source began at the given
+// time, replacing the progress of an earlier one.
+func StartBackfill(ctx context.Context, database *sql.DB, sourceID int64, at time.Time) error {
+	_, err := database.ExecContext(ctx, `
+INSERT INTO source_backfill(source_id, state, pages, items, error, started_at, finished_at)
+VALUES(?,?,0,0,NULL,?,NULL)
+ON CONFLICT(source_id) DO UPDATE SET
+  state=excluded.state, pages=0, items=0, error=NULL,
+  started_at=excluded.started_at, finished_at=NULL
+`, sourceID, BackfillRunning, at.UTC().Format(time.RFC3339))
+	return err
+}
+
+// UpdateBackfill records the pages read and items stored so far.
+func UpdateBackfill(ctx context.Context, database *sql.DB, sourceID int64, pages, items int) error {
+	_, err := database.ExecContext(ctx, "UPDATE source_backfill SET pages = ?, items = ? WHERE source_id = ?", pages, items, sourceID)
+	return err
+}
+
+// FinishBackfill records the end of a backfill; a non-empty message marks
+// it failed.
+func FinishBackfill(ctx context.Context, database *sql.DB, sourceID int64, at time.Time, message string) error {
+	state := BackfillDone
+	if message != "" {
+		state = BackfillFailed
+	}
+	_, err := database.ExecContext(ctx, "UPDATE source_backfill SET state = ?, error = ?, finished_at = ? WHERE source_id = ?",
+		state, nullIfEmpty(message), at.UTC().Format(time.RFC3339), sourceID)
+	return err
+}
+
+// sourceBackfills returns the backfill progress of every source that has
+// one, by source id.
+func sourceBackfills(ctx context.Context, database *sql.DB) (map[int64]*SourceBackfill, error) {
+	rows, err := database.QueryContext(ctx, "SELECT source_id, state, pages, items, error, started_at, finished_at FROM source_backfill")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := map[int64]*SourceBackfill{}
+	for rows.Next() {
+		var id int64
+		b := &SourceBackfill{}
+		if err := rows.Scan(&id, &b.State, &b.Pages, &b.Items, &b.Error, &b.StartedAt, &b.FinishedAt); err != nil {
+			return nil, err
+		}
+		out[id] = b
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,36 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// LatestEditionCutoff returns the end of the window of the latest edition;
+// ok is false when no edition has been assembled yet.
+func LatestEditionCutoff(ctx context.Context, database *sql.DB) (time.Time, bool, error) {
+	var cutoff sql.NullString
+	if err := database.QueryRowContext(ctx, `SELECT MAX(cutoff_at) FROM edition`).Scan(&cutoff); err != nil {
+		return time.Time{}, false, err
+	}
+	if !cutoff.Valid {
+		return time.Time{}, false, nil
+	}
+	t, err := time.Parse(time.RFC3339, cutoff.String)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	return t, true, nil
+}
+
+// EditionExists reports whether the edition of a publish slot on a local
+// date has been assembled.
+func EditionExists(ctx context.Context, database *sql.DB, localDate, slot string) (bool, error) {
+	var id int64
+	err := database.QueryRowContext(ctx, `SELECT id FROM edition WHERE local_date = ? AND slot = ?`, localDate, slot).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,167 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+)
+
+// Media kinds of enclosures.
+const (
+	MediaAudio = "audio"
+	MediaVideo = "video"
+	MediaImage = "image"
+	MediaOther = "other"
+)
+
+// Media filters accepted by article and edition listings.
+const (
+	MediaFilterAll   = ""      // no filtering
+	MediaFilterAudio = "audio" // articles with an audio enclosure
+	MediaFilterVideo = "video" // articles with a video enclosure
+	MediaFilterAny   = "any"   // articles with an audio or video enclosure
+	MediaFilterNone  = "none"  // articles without audio or video
+)
+
+// Enclosure is a media file attached to an article. Length (bytes) and
+// Duration (seconds) are 0 when the feed does not state them.
+type Enclosure struct {
+	URL      string
+	MIMEType string
+	Length   int64
+	Duration int64
+	Kind     string
+}
+
+// ValidMediaFilter reports whether f is one of the MediaFilter values.
+func ValidMediaFilter(f string) bool {
+	switch f {
+	case MediaFilterAll, MediaFilterAudio, MediaFilterVideo, MediaFilterAny, MediaFilterNone:
+		return true
+	}
+	return false
+}
+
+// mediaCondition returns an SQL condition on the article aliased "a" that
+// implements a media filter, or "" for MediaFilterAll.
+func mediaCondition(f string) string {
+	exists := func(kinds string) string {
+		return "EXISTS (SELECT 1 FROM article_enclosure ae WHERE ae.article_id = a.id AND ae.kind IN (" + kinds + "))"
+	}
+	switch f {
+	case MediaFilterAudio:
+		return exists("'audio'")
+	case MediaFilterVideo:
+		return exists("'video'")
+	case MediaFilterAny:
+		return exists("'audio', 'video'")
+	case MediaFilterNone:
+		return "NOT " + exists("'audio', 'video'")
+	}
+	return ""
+}
+
+// MediaKindOf summarizes an article's enclosures: video when any is a video,
+// otherwise audio when any is audio, otherwise "".
+func MediaKindOf(encs []Enclosure) string {
+	kind := ""
+	for _, e := range encs {
+		switch e.Kind {
+		case MediaVideo:
+			return MediaVideo
+		case MediaAudio:
+			kind = MediaAudio
+		}
+	}
+	return kind
+}
+
+// ReplaceArticleEnclosures sets the enclosures of an article to encs, in
+// order, dropping any it had before.
+func ReplaceArticleEnclosures(ctx context.Context, database *sql.DB, articleID int64, encs []Enclosure) error {
+	tx, err := database.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	if _, err := tx.ExecContext(ctx, "DELETE FROM article_enclosure WHERE article_id = ?", articleID); err != nil {
+		return err
+	}
+	for i, e := range encs {
+		if _, err := tx.ExecContext(ctx, `
+INSERT INTO article_enclosure(article_id, url, mime_type, length, duration, kind, position)
+VALUES(?,?,?,?,?,?,?)
+ON CONFLICT(article_id, url) DO NOTHING`,
+			articleID, e.URL, nullIfEmpty(e.MIMEType), nullIfZero(e.Length), nullIfZero(e.Duration), e.Kind, i); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ListEnclosures returns the enclosures of the given articles keyed by
+// article id, each in feed order.
+func ListEnclosures(ctx context.Context, database *sql.DB, articleIDs []int64) (map[int64][]Enclosure, error) {
+	out := map[int64][]Enclosure{}
+	err := inBatches(articleIDs, func(marks string, args []any) error {
+		rows, err := database.QueryContext(ctx, `
+SELECT article_id, url, IFNULL(mime_type, ''), IFNULL(length, 0), IFNULL(duration, 0), kind
+FROM article_enclosure
+WHERE article_id IN (`+marks+`)
+ORDER BY article_id, position`, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var id int64
+			var e Enclosure
+			if err := rows.Scan(&id, &e.URL, &e.MIMEType, &e.Length, &e.Duration, &e.Kind); err != nil {
+				return err
+			}
+			out[id] = append(out[id], e)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// idBatch bounds the ids bound to one query, well below SQLite's limit on
+// variables per statement, since listings are not paginated.
+const idBatch = 500
+
+// inBatches calls fn with the placeholders and arguments of SQL IN lists
+// covering ids, at most idBatch at a time, stopping at the first error.
+func inBatches(ids []int64, fn func(marks string, args []any) error) error {
+	for len(ids) > 0 {
+		n := min(len(ids), idBatch)
+		args := make([]any, n)
+		for i, id := range ids[:n] {
+			args[i] = id
+		}
+		if err := fn(strings.TrimSuffix(strings.Repeat("?,", n), ","), args); err != nil {
+			return err
+		}
+		ids = ids[n:]
+	}
+	return nil
+}
+
+// nullIfEmpty maps "" to SQL NULL.
+func nullIfEmpty(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// nullIfZero maps 0 to SQL NULL.
+func nullIfZero(n int64) any {
+	if n == 0 {
+		return nil
+	}
+	return n
+}
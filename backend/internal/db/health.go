@@ -0,0 +1,52 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// SourceHealth describes the most recent fetch outcomes for a source. Nullable
+// columns are nil until the corresponding event has happened.
+type SourceHealth struct {
+	LastAttemptAt       *string
+	LastSuccessAt       *string
+	ConsecutiveFailures int
+	LastErrorClass      *string
+	LastErrorMessage    *string
+	NextFetchAt         *string
+}
+
+// RecordFetchSuccess marks a successful fetch at the given time, clearing the
+// failure streak and scheduling the next regular fetch at nextFetch.
+func RecordFetchSuccess(ctx context.Context, database *sql.DB, sourceID int64, at, nextFetch time.Time) error {
+	ts := at.UTC().Format(time.RFC3339)
+	_, err := database.ExecContext(ctx, `
+INSERT INTO source_health(source_id, last_attempt_at, last_success_at, consecutive_failures, last_error_class, last_error_message, next_fetch_at)
+VALUES(?,?,?,0,NULL,NULL,?)
+ON CONFLICT(source_id) DO UPDATE SET
+  last_attempt_at=excluded.last_attempt_at,
+  last_success_at=excluded.last_success_at,
+  consecutive_failures=0,
+  last_error_class=NULL,
+  last_error_message=NULL,
+  next_fetch_at=excluded.next_fetch_at
+`, sourceID, ts, ts, nextFetch.UTC().Format(time.RFC3339))
+	return err
+}
+
+// RecordFetchFailure marks a failed fetch at the given time, extends the
+// failure streak, and defers the next attempt until nextFetch.
+func RecordFetchFailure(ctx context.Context, database *sql.DB, sourceID int64, at time.Time, class, message string, nextFetch time.Time) error {
+	_, err := database.ExecContext(ctx, `
+INSERT INTO source_health(source_id, last_attempt_at, consecutive_failures, last_error_class, last_error_message, next_fetch_at)
+VALUES(?,?,1,?,?,?)
+ON CONFLICT(source_id) DO UPDATE SET
+  last_attempt_at=excluded.last_attempt_at,
+  consecutive_failures=consecutive_failures + 1,
+  last_error_class=excluded.last_error_class,
+  last_error_message=excluded.last_error_message,
+  next_fetch_at=excluded.next_fetch_at
+`, sourceID, at.UTC().Format(time.RFC3339), class, message, nextFetch.UTC().Format(time.RFC3339))
+	return err
+}
@@ -0,0 +1,94 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+)
+
+// openBaseline opens a database holding the schema of the first release,
+// before any later migration ran.
+func openBaseline(t *testing.T) *sql.DB {
+	t.Helper()
+	database, err := Open(t.TempDir() + "/poppo.db")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t.Cleanup(func() { _ = database.Close() })
+	schema, err := migrationsFS.ReadFile("migrations/0001_init.sql")
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	for _, q := range []string{string(schema), "INSERT INTO schema_migrations(version) VALUES (1)"} {
+		if _, err := database.Exec(q); err != nil {
+			t.Fatalf("baseline: %v", err)
+		}
+	}
+	return database
+}
+
+func TestMigrate_FlagsMergedArticles(t *testing.T) {
+	database := openBaseline(t)
+	for _, q := range []string{
+		"INSERT INTO source(id, url) VALUES(1, 'https://a.example/feed.xml'), (2, 'https://B.example/rss')",
+		// while ids were global, b's item "1" overwrote a's article of that id
+		`INSERT INTO article(id, source_id, canonical_url, title, published_at, canonical_id) VALUES
+  (10, 1, 'https://b.example/posts/1', 'B one', '2025-01-01T00:00:00Z', '1'),
+  (11, 1, 'https://a.example/2025/hello', 'A two', '2025-01-01T00:00:00Z', '2'),
+  (12, 2, 'https://b.example/posts/3', 'B three', '2025-01-01T00:00:00Z', '3'),
+  (13, 1, 'https://elsewhere.example/linked', 'Link', '2025-01-01T00:00:00Z', '4')`,
+	} {
+		if _, err := database.Exec(q); err != nil {
+			t.Fatalf("seed: %v", err)
+		}
+	}
+	if err := Migrate(context.Background(), database); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	rows, err := database.Query("SELECT source_id, detail FROM source_event WHERE kind = ?", SourceEventCollision)
+	if err != nil {
+		t.Fatalf("events: %v", err)
+	}
+	defer rows.Close()
+	var flagged []string
+	for rows.Next() {
+		var sourceID int64
+		var detail string
+		if err := rows.Scan(&sourceID, &detail); err != nil {
+			t.Fatalf("scan: %v", err)
+		}
+		if sourceID != 1 || !strings.HasPrefix(detail, "article 10 ") {
+			t.Errorf("unexpected collision on source %d: %s", sourceID, detail)
+		}
+		flagged = append(flagged, detail)
+	}
+	if len(flagged) != 1 {
+		t.Fatalf("expected the merged article flagged once, got %v", flagged)
+	}
+}
+
+func TestMigrate_CollisionLookupIsIndexed(t *testing.T) {
+	database := openBaseline(t)
+	if err := Migrate(context.Background(), database); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	// the lookup of flagCollisions, run on every article insert
+	rows, err := database.Query("EXPLAIN QUERY PLAN SELECT a.id, a.source_id FROM article a WHERE a.canonical_id = ? AND a.source_id <> ? AND a.canonical_url <> ?", "1", 1, "https://ex/")
+	if err != nil {
+		t.Fatalf("plan: %v", err)
+	}
+	defer rows.Close()
+	var plan []string
+	for rows.Next() {
+		var id, parent, unused int
+		var detail string
+		if err := rows.Scan(&id, &parent, &unused, &detail); err != nil {
+			t.Fatalf("scan: %v", err)
+		}
+		plan = append(plan, detail)
+	}
+	if p := strings.Join(plan, "; "); !strings.Contains(p, "idx_article_canonical_id_any") {
+		t.Fatalf("expected an index search, got %q", p)
+	}
+}
@@ -0,0 +1,13 @@
+-- source_health: per-source fetch outcome and backoff state
+CREATE TABLE IF NOT EXISTS source_health (
+  source_id INTEGER PRIMARY KEY,
+  last_attempt_at TEXT,
+  last_success_at TEXT,
+  consecutive_failures INTEGER NOT NULL DEFAULT 0,
+  last_error_class TEXT,
+  last_error_message TEXT,
+  next_fetch_at TEXT,
+  FOREIGN KEY (source_id) REFERENCES source(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_source_health_next_fetch ON source_health(next_fetch_at);
@@ -0,0 +1,4 @@
+-- source.content_mode: where article bodies come from
+--   feed    : body supplied by the feed (content:encoded / Atom content)
+--   extract : download the linked page and extract the main text when the feed only has a summary
+ALTER TABLE source ADD COLUMN content_mode TEXT NOT NULL DEFAULT 'feed';
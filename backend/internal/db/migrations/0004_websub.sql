@@ -0,0 +1,15 @@
+-- websub_subscription: push subscription of a source at its WebSub hub
+CREATE TABLE IF NOT EXISTS websub_subscription (
+  source_id INTEGER PRIMARY KEY,
+  hub_url TEXT NOT NULL,
+  topic_url TEXT NOT NULL,
+  callback_token TEXT NOT NULL UNIQUE,
+  secret TEXT NOT NULL,
+  state TEXT NOT NULL DEFAULT 'new', -- new | pending | active | denied | failed
+  lease_expires_at TEXT,
+  last_error TEXT,
+  updated_at TEXT NOT NULL,
+  FOREIGN KEY (source_id) REFERENCES source(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_websub_subscription_lease ON websub_subscription(state, lease_expires_at);
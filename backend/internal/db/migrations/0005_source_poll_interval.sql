@@ -0,0 +1,4 @@
+-- per-source polling schedule, in seconds: a user override and the interval
+-- in effect as derived from feed hints and cache headers
+ALTER TABLE source ADD COLUMN poll_interval_override INTEGER;
+ALTER TABLE source ADD COLUMN poll_interval INTEGER;
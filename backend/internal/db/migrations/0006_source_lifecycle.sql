@@ -0,0 +1,24 @@
+-- source lifecycle: dead sources are no longer polled; a pending permanent
+-- redirect is counted until the URL is rewritten
+ALTER TABLE source ADD COLUMN status TEXT NOT NULL DEFAULT 'active';
+ALTER TABLE source ADD COLUMN redirect_url TEXT;
+ALTER TABLE source ADD COLUMN redirect_count INTEGER NOT NULL DEFAULT 0;
+
+-- former URLs of sources, kept so that re-adding them is still detected as a
+-- duplicate
+CREATE TABLE IF NOT EXISTS source_alias (
+  url TEXT PRIMARY KEY,
+  source_id INTEGER NOT NULL,
+  created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_source_alias_source ON source_alias(source_id);
+
+-- lifecycle events of sources (moved, gone)
+CREATE TABLE IF NOT EXISTS source_event (
+  id INTEGER PRIMARY KEY,
+  source_id INTEGER NOT NULL,
+  kind TEXT NOT NULL,
+  detail TEXT,
+  created_at TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_source_event_source ON source_event(source_id, id);
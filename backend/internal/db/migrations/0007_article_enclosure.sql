@@ -0,0 +1,14 @@
+-- media attached to articles (RSS enclosures, Media RSS content); kind is
+-- audio, video, image, or other, inferred at fetch time
+CREATE TABLE IF NOT EXISTS article_enclosure (
+  id INTEGER PRIMARY KEY,
+  article_id INTEGER NOT NULL,
+  url TEXT NOT NULL,
+  mime_type TEXT,
+  length INTEGER,   -- bytes
+  duration INTEGER, -- seconds
+  kind TEXT NOT NULL DEFAULT 'other',
+  position INTEGER NOT NULL DEFAULT 0,
+  UNIQUE(article_id, url)
+);
+CREATE INDEX IF NOT EXISTS idx_article_enclosure_kind ON article_enclosure(kind, article_id);
@@ -0,0 +1,3 @@
+-- representative images: an article's lead image and a source's feed logo
+ALTER TABLE article ADD COLUMN image_url TEXT;
+ALTER TABLE source ADD COLUMN image_url TEXT;
@@ -0,0 +1,12 @@
+-- tags from feed categories, normalized (lowercase, single spaces)
+CREATE TABLE IF NOT EXISTS tag (
+  id INTEGER PRIMARY KEY,
+  name TEXT NOT NULL UNIQUE
+);
+
+CREATE TABLE IF NOT EXISTS article_tag (
+  article_id INTEGER NOT NULL,
+  tag_id INTEGER NOT NULL,
+  PRIMARY KEY (article_id, tag_id)
+);
+CREATE INDEX IF NOT EXISTS idx_article_tag_tag ON article_tag(tag_id, article_id);
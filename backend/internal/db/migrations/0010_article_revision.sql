@@ -0,0 +1,15 @@
+-- previous versions of articles whose feed item changed; replaced_at is when
+-- the values were superseded
+CREATE TABLE IF NOT EXISTS article_revision (
+  id INTEGER PRIMARY KEY,
+  article_id INTEGER NOT NULL,
+  title TEXT,
+  summary TEXT,
+  content TEXT,
+  published_at TEXT,
+  replaced_at TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_article_revision_article ON article_revision(article_id, id);
+
+-- last time the title, summary, body, or publish time of an article changed
+ALTER TABLE article ADD COLUMN revised_at TEXT;
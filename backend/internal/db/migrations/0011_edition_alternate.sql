@@ -0,0 +1,10 @@
+-- copies of an edition article fetched through other feeds (same canonical
+-- URL), collapsed into the edition entry of article_id
+CREATE TABLE IF NOT EXISTS edition_alternate (
+  edition_id INTEGER NOT NULL,
+  article_id INTEGER NOT NULL,
+  alternate_id INTEGER NOT NULL,
+  PRIMARY KEY (edition_id, alternate_id),
+  FOREIGN KEY (edition_id) REFERENCES edition(id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_edition_alternate_article ON edition_alternate(edition_id, article_id);
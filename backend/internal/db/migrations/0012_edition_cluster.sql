@@ -0,0 +1,3 @@
+-- story cluster of an edition entry: the article id of the cluster's primary
+-- (its own id when the entry stands alone)
+ALTER TABLE edition_article ADD COLUMN cluster_id INTEGER;
@@ -0,0 +1,49 @@
+-- canonical ids are unique per source: unrelated feeds may reuse GUIDs such
+-- as "1", "2", "3"
+DROP INDEX IF EXISTS idx_article_canonical_id;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_article_source_canonical ON article(source_id, canonical_id) WHERE canonical_id IS NOT NULL;
+-- collision checks on insert look an id up across sources
+CREATE INDEX IF NOT EXISTS idx_article_canonical_id_any ON article(canonical_id);
+
+-- flag articles that were probably merged from several feeds while ids were
+-- global, judging from:
+-- - the link: it points to the host of another subscribed source rather than
+--   to its own source's (current or former) host, as when a feed's item
+--   overwrote another feed's article of the same id
+-- - the revisions (from upgrades made after they were recorded): the title
+--   went back to one it had already been replaced with, as two feeds
+--   overwrote each other in turn
+WITH
+source_rest(source_id, rest) AS (
+  SELECT id, lower(substr(url, instr(url, '://') + 3)) FROM source
+  UNION ALL
+  SELECT source_id, lower(substr(url, instr(url, '://') + 3)) FROM source_alias
+),
+source_host(source_id, host) AS (
+  SELECT source_id, CASE WHEN instr(rest, '/') > 0 THEN substr(rest, 1, instr(rest, '/') - 1) ELSE rest END
+  FROM source_rest
+),
+article_rest(id, rest) AS (
+  SELECT id, lower(substr(canonical_url, instr(canonical_url, '://') + 3)) FROM article
+  WHERE canonical_id IS NOT NULL AND instr(canonical_url, '://') > 0
+),
+article_host(id, host) AS (
+  SELECT id, CASE WHEN instr(rest, '/') > 0 THEN substr(rest, 1, instr(rest, '/') - 1) ELSE rest END
+  FROM article_rest
+)
+INSERT INTO source_event(source_id, kind, detail, created_at)
+SELECT a.source_id, 'collision',
+       'article ' || a.id || ' (id "' || a.canonical_id || '") may mix items of several feeds',
+       strftime('%Y-%m-%dT%H:%M:%SZ', 'now')
+FROM article a
+LEFT JOIN article_host ah ON ah.id = a.id
+WHERE a.canonical_id IS NOT NULL AND (
+  (EXISTS (SELECT 1 FROM source_host sh WHERE sh.host = ah.host AND sh.source_id <> a.source_id)
+    AND NOT EXISTS (SELECT 1 FROM source_host sh WHERE sh.host = ah.host AND sh.source_id = a.source_id))
+  OR EXISTS (
+    SELECT 1 FROM article_revision r1
+    JOIN article_revision r2 ON r2.article_id = r1.article_id AND r2.id > r1.id AND r2.title <> r1.title
+    WHERE r1.article_id = a.id
+      AND (a.title = r1.title OR EXISTS (
+        SELECT 1 FROM article_revision r3
+        WHERE r3.article_id = a.id AND r3.id > r2.id AND r3.title = r1.title))));
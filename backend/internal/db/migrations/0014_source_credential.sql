@@ -0,0 +1,8 @@
+-- credentials of sources that require authentication, sealed with the
+-- server key; the type is kept in clear so that listings can name it
+CREATE TABLE IF NOT EXISTS source_credential (
+  source_id INTEGER PRIMARY KEY,
+  auth_type TEXT NOT NULL,
+  sealed BLOB NOT NULL,
+  updated_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,4 @@
+-- source kinds: feeds, and web pages scraped into items by CSS selectors
+-- kept as JSON in scrape_config
+ALTER TABLE source ADD COLUMN kind TEXT NOT NULL DEFAULT 'feed';
+ALTER TABLE source ADD COLUMN scrape_config TEXT;
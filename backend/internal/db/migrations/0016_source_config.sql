@@ -0,0 +1,3 @@
+-- source adapters keep their settings as JSON alongside scrape selectors, so
+-- the column holds the configuration of any non-feed kind
+ALTER TABLE source RENAME COLUMN scrape_config TO config;
@@ -0,0 +1,11 @@
+-- progress of the fetch that follows adding a source, which walks the
+-- feed's archive pages (RFC 5005); one row per source, replaced on rerun
+CREATE TABLE IF NOT EXISTS source_backfill (
+  source_id INTEGER PRIMARY KEY,
+  state TEXT NOT NULL,
+  pages INTEGER NOT NULL DEFAULT 0,
+  items INTEGER NOT NULL DEFAULT 0,
+  error TEXT,
+  started_at TEXT NOT NULL,
+  finished_at TEXT
+);
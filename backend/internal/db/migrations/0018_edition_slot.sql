@@ -0,0 +1,16 @@
+-- editions are keyed by local date and publish slot, so that several can be
+-- published a day; existing editions belong to the single daily slot. The
+-- table is rebuilt to replace the unique local_date constraint, keeping ids
+-- so that edition_article and edition_alternate rows stay attached.
+CREATE TABLE edition_new (
+  id INTEGER PRIMARY KEY,
+  local_date TEXT NOT NULL,
+  slot TEXT NOT NULL DEFAULT 'daily',
+  published_at TEXT,
+  created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+INSERT INTO edition_new(id, local_date, published_at, created_at)
+SELECT id, local_date, published_at, created_at FROM edition;
+DROP TABLE edition;
+ALTER TABLE edition_new RENAME TO edition;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_edition_local_date_slot ON edition(local_date, slot);
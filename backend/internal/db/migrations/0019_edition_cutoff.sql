@@ -0,0 +1,5 @@
+-- end of the window an edition was assembled from; the next edition of any
+-- slot starts where it ended. Earlier editions ended when they were published.
+ALTER TABLE edition ADD COLUMN cutoff_at TEXT;
+UPDATE edition SET cutoff_at = published_at;
+CREATE INDEX IF NOT EXISTS idx_edition_cutoff ON edition(cutoff_at);
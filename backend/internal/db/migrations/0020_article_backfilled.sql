@@ -0,0 +1,3 @@
+-- whether an article was first stored by a backfill, from a new source's
+-- first fetch or its feed archive, rather than by a poll or a push
+ALTER TABLE article ADD COLUMN backfilled INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,3 @@
+-- whether the source gave no publish time for an article, whose published_at
+-- is then the time it was first seen
+ALTER TABLE article ADD COLUMN undated INTEGER NOT NULL DEFAULT 0;
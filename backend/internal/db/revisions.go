@@ -0,0 +1,44 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+)
+
+// ArticleVersion holds the tracked fields of an article at one point in time.
+type ArticleVersion struct {
+	Title       string
+	Summary     string
+	Content     string
+	PublishedAt string
+}
+
+// ArticleRevision is a superseded version of an article.
+type ArticleRevision struct {
+	ID int64
+	ArticleVersion
+	ReplacedAt string // when this version was superseded
+}
+
+// ListArticleRevisions returns the superseded versions of an article, oldest
+// first.
+func ListArticleRevisions(ctx context.Context, database *sql.DB, articleID int64) ([]ArticleRevision, error) {
+	rows, err := database.QueryContext(ctx, `
+SELECT id, IFNULL(title, ''), IFNULL(summary, ''), IFNULL(content, ''), IFNULL(published_at, ''), replaced_at
+FROM article_revision
+WHERE article_id = ?
+ORDER BY id`, articleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []ArticleRevision
+	for rows.Next() {
+		var r ArticleRevision
+		if err := rows.Scan(&r.ID, &r.Title, &r.Summary, &r.Content, &r.PublishedAt, &r.ReplacedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
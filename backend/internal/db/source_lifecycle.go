@@ -0,0 +1,177 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Source statuses. Dead sources are kept for their articles and history but
+// are no longer polled.
+const (
+	SourceActive = "active"
+	SourceDead   = "dead"
+)
+
+// Source event kinds.
+const (
+	SourceEventMoved = "moved" // URL rewritten after consecutive permanent redirects
+	SourceEventGone  = "gone"  // upstream answered 410 Gone; the source was marked dead
+
+	// SourceEventCollision flags an article that probably mixes items of
+	// several feeds, merged while canonical ids were not scoped by source.
+	SourceEventCollision = "collision"
+)
+
+// SourceEvent is a lifecycle change recorded for a source.
+type SourceEvent struct {
+	Kind      string
+	Detail    string
+	CreatedAt string
+}
+
+// FindSourceByURL returns the id of the source whose current URL or one of
+// whose former URLs equals url.
+func FindSourceByURL(ctx context.Context, database *sql.DB, url string) (int64, bool, error) {
+	var id int64
+	err := database.QueryRowContext(ctx, `
+SELECT id FROM source WHERE url = ?
+UNION ALL
+SELECT source_id FROM source_alias WHERE url = ?
+LIMIT 1`, url, url).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return id, true, nil
+}
+
+// RecordPermanentRedirect notes that fetching a source ended at target
+// through permanent redirects only. Once the same target has been seen on
+// threshold consecutive fetches, the source URL is rewritten to it, the old
+// URL is kept as an alias, and a SourceEventMoved event is recorded. The
+// rewrite is held back while target belongs to another source. It reports
+// whether the URL was rewritten.
+func RecordPermanentRedirect(ctx context.Context, database *sql.DB, sourceID int64, target string, threshold int, now time.Time) (bool, error) {
+	tx, err := database.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var current, pending string
+	var count int
+	if err := tx.QueryRowContext(ctx, "SELECT url, IFNULL(redirect_url, ''), redirect_count FROM source WHERE id = ?", sourceID).Scan(&current, &pending, &count); err != nil {
+		return false, err
+	}
+	if pending == target {
+		count++
+	} else {
+		count = 1
+	}
+	var owner int64
+	err = tx.QueryRowContext(ctx, `
+SELECT id FROM source WHERE url = ? AND id <> ?
+UNION ALL
+SELECT source_id FROM source_alias WHERE url = ? AND source_id <> ?
+LIMIT 1`, target, sourceID, target, sourceID).Scan(&owner)
+	taken := err == nil
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return false, err
+	}
+	if count < threshold || taken {
+		if _, err := tx.ExecContext(ctx, "UPDATE source SET redirect_url = ?, redirect_count = ? WHERE id = ?", target, count, sourceID); err != nil {
+			return false, err
+		}
+		return false, tx.Commit()
+	}
+
+	ts := now.UTC().Format(time.RFC3339)
+	if _, err := tx.ExecContext(ctx, "DELETE FROM source_alias WHERE url = ?", target); err != nil {
+		return false, err
+	}
+	if _, err := tx.ExecContext(ctx, "INSERT OR REPLACE INTO source_alias(url, source_id, created_at) VALUES(?,?,?)", current, sourceID, ts); err != nil {
+		return false, err
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE source SET url = ?, redirect_url = NULL, redirect_count = 0, updated_at = CURRENT_TIMESTAMP WHERE id = ?", target, sourceID); err != nil {
+		return false, err
+	}
+	if err := insertSourceEvent(ctx, tx, sourceID, SourceEventMoved, current+" -> "+target, ts); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// ClearPendingRedirect resets the redirect streak of a source after a fetch
+// that was not permanently redirected.
+func ClearPendingRedirect(ctx context.Context, database *sql.DB, sourceID int64) error {
+	_, err := database.ExecContext(ctx, "UPDATE source SET redirect_url = NULL, redirect_count = 0 WHERE id = ?", sourceID)
+	return err
+}
+
+// MarkSourceDead stops polling a source whose feed is gone, recording a
+// SourceEventGone event and dropping its WebSub subscription.
+func MarkSourceDead(ctx context.Context, database *sql.DB, sourceID int64, detail string, now time.Time) error {
+	tx, err := database.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	if _, err := tx.ExecContext(ctx, "UPDATE source SET status = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?", SourceDead, sourceID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM websub_subscription WHERE source_id = ?", sourceID); err != nil {
+		return err
+	}
+	if err := insertSourceEvent(ctx, tx, sourceID, SourceEventGone, detail, now.UTC().Format(time.RFC3339)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// insertSourceEvent appends a lifecycle event for a source within tx.
+func insertSourceEvent(ctx context.Context, tx *sql.Tx, sourceID int64, kind, detail, ts string) error {
+	_, err := tx.ExecContext(ctx, "INSERT INTO source_event(source_id, kind, detail, created_at) VALUES(?,?,?,?)", sourceID, kind, detail, ts)
+	return err
+}
+
+// sourceAliases returns the former URLs of every source, oldest first.
+func sourceAliases(ctx context.Context, database *sql.DB) (map[int64][]string, error) {
+	rows, err := database.QueryContext(ctx, "SELECT source_id, url FROM source_alias ORDER BY created_at, url")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := map[int64][]string{}
+	for rows.Next() {
+		var id int64
+		var url string
+		if err := rows.Scan(&id, &url); err != nil {
+			return nil, err
+		}
+		out[id] = append(out[id], url)
+	}
+	return out, rows.Err()
+}
+
+// sourceEvents returns the lifecycle events of every source, oldest first.
+func sourceEvents(ctx context.Context, database *sql.DB) (map[int64][]SourceEvent, error) {
+	rows, err := database.QueryContext(ctx, "SELECT source_id, kind, IFNULL(detail, ''), created_at FROM source_event ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := map[int64][]SourceEvent{}
+	for rows.Next() {
+		var id int64
+		var e SourceEvent
+		if err := rows.Scan(&id, &e.Kind, &e.Detail, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		out[id] = append(out[id], e)
+	}
+	return out, rows.Err()
+}
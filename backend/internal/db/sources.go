@@ -3,35 +3,137 @@ package db
 import (
 	"context"
 	"database/sql"
+	"time"
+)
+
+// Content modes select where article bodies of a source come from.
+const (
+	ContentModeFeed    = "feed"    // body as supplied by the feed
+	ContentModeExtract = "extract" // extract the linked page when the feed only has a summary
+)
+
+// Source kinds select how a source's URL is turned into items.
+const (
+	SourceKindFeed   = "feed"   // an RSS, Atom or JSON feed
+	SourceKindScrape = "scrape" // an HTML page scraped with CSS selectors
 )
 
 type SourceRow struct {
-	ID        int64
-	URL       string
-	Title     string
-	CreatedAt string
+	ID                   int64
+	URL                  string
+	Title                string
+	ImageURL             string // feed logo or artwork; "" when none
+	ContentMode          string
+	Kind                 string // SourceKindFeed, SourceKindScrape, or an adapter kind
+	Config               string // scrape selectors or adapter settings as JSON; "" for feeds
+	Status               string // SourceActive or SourceDead
+	CreatedAt            string
+	PollIntervalOverride *int64 // seconds; nil when the source follows feed hints
+	PollInterval         *int64 // seconds; nil until the source was first fetched
+	Health               SourceHealth
+	Push                 *SourcePush // nil unless the feed advertises a WebSub hub
+	Aliases              []string    // former URLs, oldest first
+	Events               []SourceEvent
+	AuthType             string          // credential type; "" when the source needs none
+	Backfill             *SourceBackfill // nil unless fetched right after being added
+}
+
+// SourcePush summarizes the WebSub subscription of a source.
+type SourcePush struct {
+	HubURL         string
+	State          string
+	LeaseExpiresAt *string
 }
 
 type SourceFetchRow struct {
-	ID           int64
+	ID                   int64
+	URL                  string
+	ETag                 string
+	LastModified         string
+	ContentMode          string
+	Kind                 string
+	Config               string
+	ConsecutiveFailures  int
+	PollIntervalOverride time.Duration // 0 when unset
+	PollInterval         time.Duration // interval in effect; 0 until first fetched
+	RedirectCount        int           // consecutive fetches permanently redirected to the same URL
+	Credential           []byte        // sealed credential; nil when the source needs none
+}
+
+// CreateSourceParams describes a new source as validated by the probe.
+type CreateSourceParams struct {
 	URL          string
+	Title        string
 	ETag         string
 	LastModified string
+	ContentMode  string // defaults to ContentModeFeed
+	Kind         string // defaults to SourceKindFeed
+	Config       string // scrape selectors or adapter settings as JSON
+	// AuthType and SealCredential store a credential with the source: the
+	// function seals it for the new source id. Both are empty for sources
+	// that need none.
+	AuthType       string
+	SealCredential func(id int64) ([]byte, error)
+	// HoldUntil, when set, keeps the source off the polling schedule until
+	// then, for callers that fetch it themselves right after adding it.
+	HoldUntil time.Time
 }
 
-func CreateSource(ctx context.Context, database *sql.DB, url, title, etag, lastModified string) (int64, error) {
-	res, err := database.ExecContext(ctx,
-		"INSERT INTO source(url, title, etag, last_modified) VALUES(?,?,?,?)",
-		url, title, etag, lastModified,
+// CreateSource inserts a source, with its credential when it has one, in
+// one transaction so that it is never polled without it nor before
+// p.HoldUntil.
+func CreateSource(ctx context.Context, database *sql.DB, p CreateSourceParams) (int64, error) {
+	if p.ContentMode == "" {
+		p.ContentMode = ContentModeFeed
+	}
+	if p.Kind == "" {
+		p.Kind = SourceKindFeed
+	}
+	tx, err := database.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+	res, err := tx.ExecContext(ctx,
+		"INSERT INTO source(url, title, etag, last_modified, content_mode, kind, config) VALUES(?,?,?,?,?,?,?)",
+		p.URL, p.Title, p.ETag, p.LastModified, p.ContentMode, p.Kind, nullIfEmpty(p.Config),
 	)
 	if err != nil {
 		return 0, err
 	}
-	return res.LastInsertId()
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	if p.SealCredential != nil {
+		sealed, err := p.SealCredential(id)
+		if err != nil {
+			return 0, err
+		}
+		if _, err := tx.ExecContext(ctx, "INSERT INTO source_credential(source_id, auth_type, sealed) VALUES(?,?,?)", id, p.AuthType, sealed); err != nil {
+			return 0, err
+		}
+	}
+	if !p.HoldUntil.IsZero() {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO source_health(source_id, next_fetch_at) VALUES(?,?)", id, p.HoldUntil.UTC().Format(time.RFC3339)); err != nil {
+			return 0, err
+		}
+	}
+	return id, tx.Commit()
 }
 
 func ListSources(ctx context.Context, database *sql.DB) ([]SourceRow, error) {
-	rows, err := database.QueryContext(ctx, "SELECT id, url, IFNULL(title, ''), created_at FROM source ORDER BY id")
+	rows, err := database.QueryContext(ctx, `
+SELECT s.id, s.url, IFNULL(s.title, ''), IFNULL(s.image_url, ''), s.content_mode, s.kind, IFNULL(s.config, ''), s.status, s.created_at,
+       s.poll_interval_override, s.poll_interval,
+       h.last_attempt_at, h.last_success_at, IFNULL(h.consecutive_failures, 0),
+       h.last_error_class, h.last_error_message, h.next_fetch_at,
+       w.hub_url, w.state, w.lease_expires_at, IFNULL(c.auth_type, '')
+FROM source s
+LEFT JOIN source_health h ON h.source_id = s.id
+LEFT JOIN websub_subscription w ON w.source_id = s.id
+LEFT JOIN source_credential c ON c.source_id = s.id
+ORDER BY s.id`)
 	if err != nil {
 		return nil, err
 	}
@@ -39,27 +141,64 @@ func ListSources(ctx context.Context, database *sql.DB) ([]SourceRow, error) {
 	var out []SourceRow
 	for rows.Next() {
 		var r SourceRow
-		if err := rows.Scan(&r.ID, &r.URL, &r.Title, &r.CreatedAt); err != nil {
+		h := &r.Health
+		var hub, state sql.NullString
+		var lease *string
+		if err := rows.Scan(&r.ID, &r.URL, &r.Title, &r.ImageURL, &r.ContentMode, &r.Kind, &r.Config, &r.Status, &r.CreatedAt,
+			&r.PollIntervalOverride, &r.PollInterval,
+			&h.LastAttemptAt, &h.LastSuccessAt, &h.ConsecutiveFailures,
+			&h.LastErrorClass, &h.LastErrorMessage, &h.NextFetchAt,
+			&hub, &state, &lease, &r.AuthType); err != nil {
 			return nil, err
 		}
+		if hub.Valid {
+			r.Push = &SourcePush{HubURL: hub.String, State: state.String, LeaseExpiresAt: lease}
+		}
 		out = append(out, r)
 	}
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
+	aliases, err := sourceAliases(ctx, database)
+	if err != nil {
+		return nil, err
+	}
+	events, err := sourceEvents(ctx, database)
+	if err != nil {
+		return nil, err
+	}
+	backfills, err := sourceBackfills(ctx, database)
+	if err != nil {
+		return nil, err
+	}
+	for i := range out {
+		out[i].Aliases = aliases[out[i].ID]
+		out[i].Events = events[out[i].ID]
+		out[i].Backfill = backfills[out[i].ID]
+	}
 	return out, nil
 }
 
-func ListSourcesForFetch(ctx context.Context, database *sql.DB) ([]SourceFetchRow, error) {
-	rows, err := database.QueryContext(ctx, "SELECT id, url, IFNULL(etag, ''), IFNULL(last_modified, '') FROM source ORDER BY id")
+// ListSourcesForFetch returns the sources that are due at now: those never
+// fetched and those whose next scheduled or backoff time has passed. Dead
+// sources and sources receiving pushes through an unexpired WebSub
+// subscription are skipped.
+func ListSourcesForFetch(ctx context.Context, database *sql.DB, now time.Time) ([]SourceFetchRow, error) {
+	rows, err := database.QueryContext(ctx, selectSourceForFetch+`
+WHERE s.status = 'active'
+  AND (h.next_fetch_at IS NULL OR h.next_fetch_at <= ?)
+  AND NOT EXISTS (
+    SELECT 1 FROM websub_subscription w
+    WHERE w.source_id = s.id AND w.state = 'active' AND w.lease_expires_at > ?)
+ORDER BY s.id`, now.UTC().Format(time.RFC3339), now.UTC().Format(time.RFC3339))
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 	var out []SourceFetchRow
 	for rows.Next() {
-		var r SourceFetchRow
-		if err := rows.Scan(&r.ID, &r.URL, &r.ETag, &r.LastModified); err != nil {
+		r, err := scanSourceForFetch(rows)
+		if err != nil {
 			return nil, err
 		}
 		out = append(out, r)
@@ -70,16 +209,113 @@ func ListSourcesForFetch(ctx context.Context, database *sql.DB) ([]SourceFetchRo
 	return out, nil
 }
 
+// GetSourceForFetch returns an active source for fetching regardless of its
+// schedule. ok is false when there is no such source.
+func GetSourceForFetch(ctx context.Context, database *sql.DB, id int64) (SourceFetchRow, bool, error) {
+	r, err := scanSourceForFetch(database.QueryRowContext(ctx, selectSourceForFetch+`
+WHERE s.status = 'active' AND s.id = ?`, id))
+	if err == sql.ErrNoRows {
+		return SourceFetchRow{}, false, nil
+	}
+	if err != nil {
+		return SourceFetchRow{}, false, err
+	}
+	return r, true, nil
+}
+
+// selectSourceForFetch selects the columns read by scanSourceForFetch.
+const selectSourceForFetch = `
+SELECT s.id, s.url, IFNULL(s.etag, ''), IFNULL(s.last_modified, ''), s.content_mode, s.kind, IFNULL(s.config, ''), IFNULL(h.consecutive_failures, 0),
+       IFNULL(s.poll_interval_override, 0), IFNULL(s.poll_interval, 0), s.redirect_count, c.sealed
+FROM source s
+LEFT JOIN source_health h ON h.source_id = s.id
+LEFT JOIN source_credential c ON c.source_id = s.id`
+
+// scanSourceForFetch reads a row selected by selectSourceForFetch.
+func scanSourceForFetch(row interface{ Scan(...any) error }) (SourceFetchRow, error) {
+	var r SourceFetchRow
+	var override, interval int64
+	if err := row.Scan(&r.ID, &r.URL, &r.ETag, &r.LastModified, &r.ContentMode, &r.Kind, &r.Config, &r.ConsecutiveFailures, &override, &interval, &r.RedirectCount, &r.Credential); err != nil {
+		return SourceFetchRow{}, err
+	}
+	r.PollIntervalOverride = time.Duration(override) * time.Second
+	r.PollInterval = time.Duration(interval) * time.Second
+	return r, nil
+}
+
 func UpdateSourceHeaders(ctx context.Context, database *sql.DB, id int64, etag, lastModified string) error {
 	_, err := database.ExecContext(ctx, "UPDATE source SET etag = ?, last_modified = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?", etag, lastModified, id)
 	return err
 }
 
+// SetSourceImage records the image a source's feed declares; "" clears it.
+func SetSourceImage(ctx context.Context, database *sql.DB, id int64, imageURL string) error {
+	_, err := database.ExecContext(ctx, "UPDATE source SET image_url = ? WHERE id = ?", nullIfEmpty(imageURL), id)
+	return err
+}
+
+// SetSourcePollInterval records the polling interval in effect for a source.
+func SetSourcePollInterval(ctx context.Context, database *sql.DB, id int64, interval time.Duration) error {
+	_, err := database.ExecContext(ctx, "UPDATE source SET poll_interval = ? WHERE id = ?", int64(interval/time.Second), id)
+	return err
+}
+
+// SetSourcePollOverride sets (or, when override is 0, clears) the user's
+// polling interval for a source and makes the source due immediately so the
+// new schedule takes effect. It reports whether the source exists.
+func SetSourcePollOverride(ctx context.Context, database *sql.DB, id int64, override time.Duration) (bool, error) {
+	var v any
+	if override > 0 {
+		v = int64(override / time.Second)
+	}
+	res, err := database.ExecContext(ctx, "UPDATE source SET poll_interval_override = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?", v, id)
+	if err != nil {
+		return false, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return false, nil
+	}
+	_, err = database.ExecContext(ctx, "UPDATE source_health SET next_fetch_at = NULL WHERE source_id = ?", id)
+	return true, err
+}
+
+// DeleteSource deletes a source together with its health, WebSub
+// subscription, aliases, events, credential and backfill progress, and its
+// articles with their enclosures, tags, revisions, edition entries, read
+// states and bookmarks, all in one transaction. The rows that refer to the
+// source go first, so that none is left behind should the connection enforce
+// foreign keys or not. It reports whether the source existed.
 func DeleteSource(ctx context.Context, database *sql.DB, id int64) (bool, error) {
-	res, err := database.ExecContext(ctx, "DELETE FROM source WHERE id = ?", id)
+	tx, err := database.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = tx.Rollback() }()
+	const articles = "SELECT id FROM article WHERE source_id = ?"
+	for _, q := range []string{
+		"DELETE FROM article_enclosure WHERE article_id IN (" + articles + ")",
+		"DELETE FROM article_tag WHERE article_id IN (" + articles + ")",
+		"DELETE FROM article_revision WHERE article_id IN (" + articles + ")",
+		"DELETE FROM edition_article WHERE article_id IN (" + articles + ")",
+		"DELETE FROM edition_alternate WHERE article_id IN (" + articles + ")",
+		"DELETE FROM edition_alternate WHERE alternate_id IN (" + articles + ")",
+		"DELETE FROM read_state WHERE article_id IN (" + articles + ")",
+		"DELETE FROM bookmark WHERE article_id IN (" + articles + ")",
+		"DELETE FROM article WHERE source_id = ?",
+	} {
+		if _, err := tx.ExecContext(ctx, q, id); err != nil {
+			return false, err
+		}
+	}
+	for _, table := range []string{"source_health", "websub_subscription", "source_alias", "source_event", "source_credential", "source_backfill"} {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM "+table+" WHERE source_id = ?", id); err != nil {
+			return false, err
+		}
+	}
+	res, err := tx.ExecContext(ctx, "DELETE FROM source WHERE id = ?", id)
 	if err != nil {
 		return false, err
 	}
 	n, _ := res.RowsAffected()
-	return n > 0, nil
+	return n > 0, tx.Commit()
 }
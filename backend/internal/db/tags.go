@@ -0,0 +1,105 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// TagCount is a tag with the number of articles carrying it.
+type TagCount struct {
+	Name  string
+	Count int
+}
+
+// ReplaceArticleTags sets the tags of an article to names, which must
+// already be normalized, creating tags as needed and dropping any the
+// article had before.
+func ReplaceArticleTags(ctx context.Context, database *sql.DB, articleID int64, names []string) error {
+	tx, err := database.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	if _, err := tx.ExecContext(ctx, "DELETE FROM article_tag WHERE article_id = ?", articleID); err != nil {
+		return err
+	}
+	for _, name := range names {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO tag(name) VALUES(?) ON CONFLICT(name) DO NOTHING", name); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `
+INSERT INTO article_tag(article_id, tag_id)
+SELECT ?, id FROM tag WHERE name = ?
+ON CONFLICT DO NOTHING`, articleID, name); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ListTags returns the tags in use with their article counts, most used
+// first. A non-zero since counts only articles published at or after it.
+func ListTags(ctx context.Context, database *sql.DB, since time.Time) ([]TagCount, error) {
+	where := ""
+	var args []any
+	if !since.IsZero() {
+		where = "WHERE a.published_at >= ?"
+		args = append(args, since.UTC().Format(time.RFC3339))
+	}
+	rows, err := database.QueryContext(ctx, `
+SELECT t.name, COUNT(1) AS cnt
+FROM article_tag at
+JOIN tag t ON t.id = at.tag_id
+JOIN article a ON a.id = at.article_id
+`+where+`
+GROUP BY t.id, t.name
+ORDER BY cnt DESC, t.name`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []TagCount
+	for rows.Next() {
+		var tc TagCount
+		if err := rows.Scan(&tc.Name, &tc.Count); err != nil {
+			return nil, err
+		}
+		out = append(out, tc)
+	}
+	return out, rows.Err()
+}
+
+// ListArticleTags returns the tag names of the given articles keyed by
+// article id, each sorted by name.
+func ListArticleTags(ctx context.Context, database *sql.DB, articleIDs []int64) (map[int64][]string, error) {
+	out := map[int64][]string{}
+	err := inBatches(articleIDs, func(marks string, args []any) error {
+		rows, err := database.QueryContext(ctx, `
+SELECT at.article_id, t.name
+FROM article_tag at JOIN tag t ON t.id = at.tag_id
+WHERE at.article_id IN (`+marks+`)
+ORDER BY at.article_id, t.name`, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var id int64
+			var name string
+			if err := rows.Scan(&id, &name); err != nil {
+				return err
+			}
+			out[id] = append(out[id], name)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// tagCondition returns an SQL condition on the article aliased "a" requiring
+// the named tag; the name is its single argument.
+const tagCondition = "EXISTS (SELECT 1 FROM article_tag at JOIN tag t ON t.id = at.tag_id WHERE at.article_id = a.id AND t.name = ?)"
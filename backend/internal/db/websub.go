@@ -0,0 +1,131 @@
+package db
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"time"
+)
+
+// WebSub subscription states.
+const (
+	WebSubNew     = "new"     // hub discovered, not yet subscribed
+	WebSubPending = "pending" // subscription requested, awaiting verification
+	WebSubActive  = "active"  // verified; pushes arrive until the lease expires
+	WebSubDenied  = "denied"  // the hub refused the subscription
+	WebSubFailed  = "failed"  // the subscription request itself failed
+)
+
+// WebSubSubscription is the push subscription state of one source.
+type WebSubSubscription struct {
+	SourceID       int64
+	HubURL         string
+	TopicURL       string
+	CallbackToken  string
+	Secret         string
+	State          string
+	LeaseExpiresAt *string
+	LastError      *string
+	UpdatedAt      string
+}
+
+// RecordWebSubHub remembers the hub and topic a source's feed advertises.
+// A new or changed hub/topic pair resets the subscription to WebSubNew with
+// fresh callback credentials; an unchanged pair is left alone.
+func RecordWebSubHub(ctx context.Context, database *sql.DB, sourceID int64, hub, topic string, now time.Time) error {
+	token, err := randomHex(16)
+	if err != nil {
+		return err
+	}
+	secret, err := randomHex(32)
+	if err != nil {
+		return err
+	}
+	_, err = database.ExecContext(ctx, `
+INSERT INTO websub_subscription(source_id, hub_url, topic_url, callback_token, secret, state, updated_at)
+VALUES(?,?,?,?,?,'new',?)
+ON CONFLICT(source_id) DO UPDATE SET
+  hub_url=excluded.hub_url,
+  topic_url=excluded.topic_url,
+  callback_token=excluded.callback_token,
+  secret=excluded.secret,
+  state='new',
+  lease_expires_at=NULL,
+  last_error=NULL,
+  updated_at=excluded.updated_at
+WHERE websub_subscription.hub_url <> excluded.hub_url OR websub_subscription.topic_url <> excluded.topic_url
+`, sourceID, hub, topic, token, secret, now.UTC().Format(time.RFC3339))
+	return err
+}
+
+// GetWebSubByToken looks up a subscription by its callback token.
+func GetWebSubByToken(ctx context.Context, database *sql.DB, token string) (WebSubSubscription, error) {
+	return scanWebSub(database.QueryRowContext(ctx, webSubSelect+" WHERE callback_token = ?", token))
+}
+
+// GetWebSub returns the subscription of a source.
+func GetWebSub(ctx context.Context, database *sql.DB, sourceID int64) (WebSubSubscription, error) {
+	return scanWebSub(database.QueryRowContext(ctx, webSubSelect+" WHERE source_id = ?", sourceID))
+}
+
+// ListWebSubDue returns subscriptions that need a (re)subscribe request at
+// now: newly discovered hubs, active leases expiring within renewBefore, and
+// pending, denied, or failed subscriptions last touched before retryAfter ago.
+func ListWebSubDue(ctx context.Context, database *sql.DB, now time.Time, renewBefore, retryAfter time.Duration) ([]WebSubSubscription, error) {
+	rows, err := database.QueryContext(ctx, webSubSelect+`
+WHERE state = 'new'
+   OR (state = 'active' AND (lease_expires_at IS NULL OR lease_expires_at <= ?))
+   OR (state IN ('pending', 'denied', 'failed') AND updated_at <= ?)
+ORDER BY source_id`,
+		now.Add(renewBefore).UTC().Format(time.RFC3339), now.Add(-retryAfter).UTC().Format(time.RFC3339))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []WebSubSubscription
+	for rows.Next() {
+		s, err := scanWebSub(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
+
+// SetWebSubState records a state transition. leaseExpires is stored only when
+// non-nil, and errMsg clears the last error when empty.
+func SetWebSubState(ctx context.Context, database *sql.DB, sourceID int64, state string, leaseExpires *time.Time, errMsg string, now time.Time) error {
+	var lease, lastErr any
+	if leaseExpires != nil {
+		lease = leaseExpires.UTC().Format(time.RFC3339)
+	}
+	if errMsg != "" {
+		lastErr = errMsg
+	}
+	_, err := database.ExecContext(ctx, `
+UPDATE websub_subscription SET state = ?, lease_expires_at = COALESCE(?, lease_expires_at), last_error = ?, updated_at = ?
+WHERE source_id = ?`, state, lease, lastErr, now.UTC().Format(time.RFC3339), sourceID)
+	return err
+}
+
+const webSubSelect = `
+SELECT source_id, hub_url, topic_url, callback_token, secret, state, lease_expires_at, last_error, updated_at
+FROM websub_subscription`
+
+// scanWebSub reads one subscription row.
+func scanWebSub(row interface{ Scan(...any) error }) (WebSubSubscription, error) {
+	var s WebSubSubscription
+	err := row.Scan(&s.SourceID, &s.HubURL, &s.TopicURL, &s.CallbackToken, &s.Secret, &s.State, &s.LeaseExpiresAt, &s.LastError, &s.UpdatedAt)
+	return s, err
+}
+
+// randomHex returns n random bytes hex-encoded.
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
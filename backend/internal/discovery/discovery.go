@@ -0,0 +1,260 @@
+// Package discovery resolves a user-supplied URL to a feed. The URL may point
+// at a feed directly or at a website that advertises its feeds through
+// <link rel="alternate"> elements or serves them at well-known paths.
+package discovery
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/mmcdole/gofeed"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+
+	"github.com/fujidaiti/poppo-press/backend/internal/httpclient"
+)
+
+// ErrNoFeed is returned when neither the URL nor the page it serves leads to
+// a parseable feed.
+var ErrNoFeed = errors.New("discovery: no feed found")
+
+// maxBody bounds how much of a probed response is read.
+const maxBody = 5 << 20
+
+// feedTypes are the MIME types accepted on <link rel="alternate">.
+var feedTypes = map[string]bool{
+	"application/rss+xml":   true,
+	"application/atom+xml":  true,
+	"application/feed+json": true,
+}
+
+// wellKnownPaths are tried, in order of preference, when a page advertises
+// no feeds.
+var wellKnownPaths = []string{"/feed", "/rss", "/atom.xml", "/feed.xml", "/rss.xml", "/index.xml", "/feed.json"}
+
+// Feed describes a feed that was fetched and parsed successfully.
+type Feed struct {
+	URL          string
+	Title        string
+	ETag         string
+	LastModified string
+}
+
+// Candidate is a feed advertised by, or found next to, a web page.
+type Candidate struct {
+	URL   string `json:"url"`
+	Title string `json:"title"`
+	Type  string `json:"type"`
+}
+
+// Probe fetches rawURL and resolves it to a feed. When rawURL is a feed, or
+// a page that leads to exactly one feed, the feed is returned. When the page
+// offers several feeds, they are returned as candidates for the caller to
+// choose from and the feed is nil.
+func Probe(ctx context.Context, client *http.Client, rawURL string) (*Feed, []Candidate, error) {
+	resp, body, err := get(ctx, client, rawURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	if f, err := gofeed.NewParser().Parse(bytes.NewReader(body)); err == nil {
+		return feedOf(rawURL, f, resp), nil, nil
+	}
+	if !isHTML(resp, body) {
+		return nil, nil, ErrNoFeed
+	}
+	base := resp.Request.URL
+	candidates := preferred(alternateLinks(body, base))
+	if len(candidates) == 0 {
+		candidates = probeWellKnown(ctx, client, base)
+	}
+	switch len(candidates) {
+	case 0:
+		return nil, nil, ErrNoFeed
+	case 1:
+		return probeFeed(ctx, client, candidates[0].URL)
+	}
+	return nil, candidates, nil
+}
+
+// probeFeed fetches a candidate URL that must itself be a feed.
+func probeFeed(ctx context.Context, client *http.Client, feedURL string) (*Feed, []Candidate, error) {
+	resp, body, err := get(ctx, client, feedURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	f, err := gofeed.NewParser().Parse(bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %s: %v", ErrNoFeed, feedURL, err)
+	}
+	return feedOf(feedURL, f, resp), nil, nil
+}
+
+// get performs a GET and returns the response with its (bounded) body.
+func get(ctx context.Context, client *http.Client, rawURL string) (*http.Response, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, nil, fmt.Errorf("discovery: %s: status %d", rawURL, resp.StatusCode)
+	}
+	if err := httpclient.CheckContentType(resp.Header); err != nil {
+		return nil, nil, err
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBody))
+	if err != nil {
+		return nil, nil, err
+	}
+	return resp, body, nil
+}
+
+// feedOf builds a Feed from a parsed response.
+func feedOf(feedURL string, f *gofeed.Feed, resp *http.Response) *Feed {
+	return &Feed{URL: feedURL, Title: f.Title, ETag: resp.Header.Get("ETag"), LastModified: resp.Header.Get("Last-Modified")}
+}
+
+// isHTML reports whether a response is an HTML document, trusting the
+// Content-Type header and falling back to content sniffing.
+func isHTML(resp *http.Response, body []byte) bool {
+	ct := resp.Header.Get("Content-Type")
+	if ct == "" {
+		ct = http.DetectContentType(body)
+	}
+	mt, _, _ := mime.ParseMediaType(ct)
+	return mt == "text/html" || mt == "application/xhtml+xml"
+}
+
+// alternateLinks returns the feeds advertised by <link rel="alternate">
+// elements, resolved against base and de-duplicated in document order.
+func alternateLinks(body []byte, base *url.URL) []Candidate {
+	var out []Candidate
+	seen := map[string]bool{}
+	z := html.NewTokenizer(bytes.NewReader(body))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			return out
+		}
+		if tt != html.StartTagToken && tt != html.SelfClosingTagToken {
+			continue
+		}
+		t := z.Token()
+		if t.DataAtom == atom.Body {
+			return out
+		}
+		if t.DataAtom != atom.Link {
+			continue
+		}
+		var rel, typ, href, title string
+		for _, a := range t.Attr {
+			switch strings.ToLower(a.Key) {
+			case "rel":
+				rel = strings.ToLower(a.Val)
+			case "type":
+				typ = strings.ToLower(strings.TrimSpace(a.Val))
+			case "href":
+				href = strings.TrimSpace(a.Val)
+			case "title":
+				title = strings.TrimSpace(a.Val)
+			}
+		}
+		if !hasToken(rel, "alternate") || !feedTypes[typ] || href == "" {
+			continue
+		}
+		u, err := base.Parse(href)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			continue
+		}
+		if seen[u.String()] {
+			continue
+		}
+		seen[u.String()] = true
+		out = append(out, Candidate{URL: u.String(), Title: title, Type: typ})
+	}
+}
+
+// preferred drops comment feeds when the page also offers other feeds,
+// since they are rarely what a reader wants to subscribe to.
+func preferred(cs []Candidate) []Candidate {
+	var main []Candidate
+	for _, c := range cs {
+		if !strings.Contains(strings.ToLower(c.Title+" "+c.URL), "comment") {
+			main = append(main, c)
+		}
+	}
+	if len(main) == 0 {
+		return cs
+	}
+	return main
+}
+
+// probeWellKnown tries the common feed paths on base's origin concurrently
+// and returns those that parse as feeds, in preference order. Paths that
+// redirect to the same feed are reported once.
+func probeWellKnown(ctx context.Context, client *http.Client, base *url.URL) []Candidate {
+	found := make([]*Candidate, len(wellKnownPaths))
+	var wg sync.WaitGroup
+	for i, p := range wellKnownPaths {
+		u := &url.URL{Scheme: base.Scheme, Host: base.Host, Path: p}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, body, err := get(ctx, client, u.String())
+			if err != nil {
+				return
+			}
+			f, err := gofeed.NewParser().Parse(bytes.NewReader(body))
+			if err != nil {
+				return
+			}
+			found[i] = &Candidate{URL: resp.Request.URL.String(), Title: f.Title, Type: feedType(f, resp)}
+		}()
+	}
+	wg.Wait()
+	var out []Candidate
+	seen := map[string]bool{}
+	for _, c := range found {
+		if c != nil && !seen[c.URL] {
+			seen[c.URL] = true
+			out = append(out, *c)
+		}
+	}
+	return out
+}
+
+// feedType reports the MIME type of a parsed feed.
+func feedType(f *gofeed.Feed, resp *http.Response) string {
+	switch f.FeedType {
+	case "rss":
+		return "application/rss+xml"
+	case "atom":
+		return "application/atom+xml"
+	case "json":
+		return "application/feed+json"
+	}
+	mt, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	return mt
+}
+
+// hasToken reports whether the space-separated list contains tok.
+func hasToken(list, tok string) bool {
+	for _, f := range strings.Fields(list) {
+		if f == tok {
+			return true
+		}
+	}
+	return false
+}
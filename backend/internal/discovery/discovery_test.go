@@ -0,0 +1,114 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const rss = `<?xml version="1.0"?><rss version="2.0"><channel><title>%s</title></channel></rss>`
+
+func TestProbe_DirectFeed(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/rss+xml")
+		w.Header().Set("ETag", `"v1"`)
+		fmt.Fprintf(w, rss, "Direct")
+	}))
+	defer srv.Close()
+
+	f, cs, err := Probe(context.Background(), srv.Client(), srv.URL+"/feed.xml")
+	if err != nil || cs != nil {
+		t.Fatalf("probe: %v %v", err, cs)
+	}
+	if f.URL != srv.URL+"/feed.xml" || f.Title != "Direct" || f.ETag != `"v1"` {
+		t.Fatalf("unexpected feed: %+v", f)
+	}
+}
+
+func TestProbe_SingleAlternateLinkIsSelected(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, `<html><head>
+<link rel="alternate" type="application/rss+xml" title="Posts" href="/posts.rss">
+<link rel="alternate" type="application/rss+xml" title="Comments" href="/comments.rss">
+<link rel="stylesheet" href="/style.css">
+</head><body>hi</body></html>`)
+	})
+	mux.HandleFunc("/posts.rss", func(w http.ResponseWriter, r *http.Request) { fmt.Fprintf(w, rss, "Posts") })
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	f, cs, err := Probe(context.Background(), srv.Client(), srv.URL+"/")
+	if err != nil || cs != nil {
+		t.Fatalf("probe: %v %v", err, cs)
+	}
+	if f.URL != srv.URL+"/posts.rss" || f.Title != "Posts" {
+		t.Fatalf("unexpected feed: %+v", f)
+	}
+}
+
+func TestProbe_MultipleAlternatesAreReturned(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<html><head>
+<link rel="alternate" type="application/rss+xml" title="RSS" href="https://ex.test/rss">
+<link rel="alternate" type="application/atom+xml" title="Atom" href="atom.xml">
+<link rel="alternate" type="application/feed+json" title="JSON" href="/feed.json">
+</head></html>`)
+	}))
+	defer srv.Close()
+
+	f, cs, err := Probe(context.Background(), srv.Client(), srv.URL+"/blog/")
+	if err != nil || f != nil {
+		t.Fatalf("probe: %v %+v", err, f)
+	}
+	want := []Candidate{
+		{URL: "https://ex.test/rss", Title: "RSS", Type: "application/rss+xml"},
+		{URL: srv.URL + "/blog/atom.xml", Title: "Atom", Type: "application/atom+xml"},
+		{URL: srv.URL + "/feed.json", Title: "JSON", Type: "application/feed+json"},
+	}
+	if fmt.Sprint(cs) != fmt.Sprint(want) {
+		t.Fatalf("candidates:\n got %+v\nwant %+v", cs, want)
+	}
+}
+
+func TestProbe_WellKnownPathFallback(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, `<!doctype html><html><head><title>Blog</title></head><body>no feeds advertised</body></html>`)
+	})
+	mux.HandleFunc("/index.xml", func(w http.ResponseWriter, r *http.Request) { fmt.Fprintf(w, rss, "Hugo") })
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	f, _, err := Probe(context.Background(), srv.Client(), srv.URL+"/")
+	if err != nil {
+		t.Fatalf("probe: %v", err)
+	}
+	if f.URL != srv.URL+"/index.xml" || f.Title != "Hugo" {
+		t.Fatalf("unexpected feed: %+v", f)
+	}
+}
+
+func TestProbe_NoFeed(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, `<html><body>plain page</body></html>`)
+	}))
+	defer srv.Close()
+
+	if _, _, err := Probe(context.Background(), srv.Client(), srv.URL+"/"); !errors.Is(err, ErrNoFeed) {
+		t.Fatalf("expected ErrNoFeed, got %v", err)
+	}
+}
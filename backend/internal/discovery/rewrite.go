@@ -0,0 +1,120 @@
+package discovery
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/fujidaiti/poppo-press/backend/internal/config"
+)
+
+// Rule maps the web URL of a well-known site to its feed. URLs matching
+// Pattern are rewritten to Feed, a template expanded with the match as by
+// regexp.Regexp.Expand ($1, ${name}).
+type Rule struct {
+	Name    string
+	Pattern *regexp.Regexp
+	Feed    string
+}
+
+// builtinRules cover sites whose pages are not feeds and advertise none, or
+// whose advertised feed is not the one users expect. Only URL shapes that
+// map to a feed without a network lookup are listed; YouTube @handles, for
+// instance, need the channel id from the page and go through discovery.
+var builtinRules = []Rule{
+	mustRule("youtube-channel", `(?i)^https?://(?:www\.|m\.)?youtube\.com/channel/(UC[\w-]+)(?:/[\w-]+)*/?(?:[?#].*)?$`, "https://www.youtube.com/feeds/videos.xml?channel_id=$1"),
+	mustRule("youtube-user", `(?i)^https?://(?:www\.|m\.)?youtube\.com/user/([\w.-]+)/?(?:[?#].*)?$`, "https://www.youtube.com/feeds/videos.xml?user=$1"),
+	mustRule("youtube-playlist", `(?i)^https?://(?:www\.|m\.)?youtube\.com/playlist\?(?:.*&)?list=([\w-]+)(?:[&#].*)?$`, "https://www.youtube.com/feeds/videos.xml?playlist_id=$1"),
+	mustRule("reddit-subreddit", `(?i)^https?://(?:www\.|old\.|new\.)?reddit\.com/r/(\w+)(/(?:hot|new|top|rising))?/?(?:[?#].*)?$`, "https://www.reddit.com/r/$1$2/.rss"),
+	mustRule("reddit-user", `(?i)^https?://(?:www\.|old\.|new\.)?reddit\.com/(?:u|user)/([\w-]+)/?(?:[?#].*)?$`, "https://www.reddit.com/user/$1/.rss"),
+	// GitHub's own top-level pages are no user or repository; mapping them
+	// to themselves keeps them from the rules below
+	mustRule("github-reserved", `(?i)^https?://(?:www\.)?github\.com/(?:about|account|apps|codespaces|collections|contact|dashboard|enterprise|events|explore|features|login|logout|marketplace|new|notifications|organizations|orgs|pricing|pulls|issues|search|security|settings|signup|site|sponsors|stars|topics|trending|watching)(?:[/?#].*)?$`, "$0"),
+	mustRule("github-releases", `(?i)^https?://(?:www\.)?github\.com/([\w.-]+)/([\w.-]+?)(?:\.git)?(?:/releases)?/?(?:[?#].*)?$`, "https://github.com/$1/$2/releases.atom"),
+	mustRule("github-tags", `(?i)^https?://(?:www\.)?github\.com/([\w.-]+)/([\w.-]+)/tags/?(?:[?#].*)?$`, "https://github.com/$1/$2/tags.atom"),
+	mustRule("github-commits", `(?i)^https?://(?:www\.)?github\.com/([\w.-]+)/([\w.-]+)/commits/([\w./-]+?)/?(?:[?#].*)?$`, "https://github.com/$1/$2/commits/$3.atom"),
+	mustRule("github-user", `(?i)^https?://(?:www\.)?github\.com/([\w-]+)/?(?:[?#].*)?$`, "https://github.com/$1.atom"),
+	mustRule("medium-profile", `(?i)^https?://(?:www\.)?medium\.com/(@[\w.-]+)/?(?:[?#].*)?$`, "https://medium.com/feed/$1"),
+	// YouTube handles are left to discovery; this keeps them from the
+	// Mastodon rule, as a rule mapping a URL to itself ends the search
+	mustRule("youtube-handle", `(?i)^https?://(?:www\.|m\.)?youtube\.com/@.*$`, "$0"),
+	// last: any other host serving /@user is taken for a Mastodon instance
+	mustRule("mastodon-profile", `^(https://[\w.-]+)/(@\w+)/?(?:[?#].*)?$`, "$1/$2.rss"),
+}
+
+// mustRule compiles a built-in rule.
+func mustRule(name, pattern, feed string) Rule {
+	r, err := CompileRule(name, pattern, feed)
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+// CompileRule builds a rule from its pattern.
+func CompileRule(name, pattern, feed string) (Rule, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return Rule{}, fmt.Errorf("rewrite rule %q: %v", name, err)
+	}
+	if strings.TrimSpace(feed) == "" {
+		return Rule{}, fmt.Errorf("rewrite rule %q: feed template is required", name)
+	}
+	return Rule{Name: name, Pattern: re, Feed: feed}, nil
+}
+
+// RulesFromConfig compiles the rewrite rules set in cfg.
+func RulesFromConfig(cfg config.Config) ([]Rule, error) {
+	rules := make([]Rule, 0, len(cfg.SourceRewrites))
+	for i, r := range cfg.SourceRewrites {
+		name := r.Name
+		if name == "" {
+			name = fmt.Sprintf("config-%d", i+1)
+		}
+		rule, err := CompileRule(name, r.Match, r.Feed)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// Rewriter maps URLs to feeds by the first matching rule. The zero value
+// and nil apply the built-in rules only.
+type Rewriter struct {
+	rules []Rule
+}
+
+// NewRewriter returns a rewriter trying extra before the built-in rules, so
+// that configuration can override them.
+func NewRewriter(extra []Rule) *Rewriter {
+	return &Rewriter{rules: append(append([]Rule{}, extra...), builtinRules...)}
+}
+
+// Rewrite returns the feed URL that rawURL maps to and the name of the rule
+// that matched; rules whose result is not an http(s) URL are skipped. ok is
+// false when no rule matches or the first match maps the URL to itself; the
+// URL is then probed as given.
+func (rw *Rewriter) Rewrite(rawURL string) (feedURL, rule string, ok bool) {
+	rules := builtinRules
+	if rw != nil && rw.rules != nil {
+		rules = rw.rules
+	}
+	for _, r := range rules {
+		m := r.Pattern.FindStringSubmatchIndex(rawURL)
+		if m == nil {
+			continue
+		}
+		out := string(r.Pattern.ExpandString(nil, r.Feed, rawURL, m))
+		if u, err := url.Parse(out); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			continue
+		}
+		if out == rawURL {
+			return "", "", false
+		}
+		return out, r.Name, true
+	}
+	return "", "", false
+}
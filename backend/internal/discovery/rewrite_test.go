@@ -0,0 +1,82 @@
+package discovery
+
+import (
+	"testing"
+
+	"github.com/fujidaiti/poppo-press/backend/internal/config"
+)
+
+func TestRewriter_BuiltinRules(t *testing.T) {
+	cases := []struct{ in, want, rule string }{
+		{"https://www.youtube.com/channel/UC_x5XG1OV2P6uZZ5FSM9Ttw", "https://www.youtube.com/feeds/videos.xml?channel_id=UC_x5XG1OV2P6uZZ5FSM9Ttw", "youtube-channel"},
+		{"https://youtube.com/channel/UCabc-1/videos?view=0", "https://www.youtube.com/feeds/videos.xml?channel_id=UCabc-1", "youtube-channel"},
+		{"https://m.youtube.com/user/GoogleDevelopers/", "https://www.youtube.com/feeds/videos.xml?user=GoogleDevelopers", "youtube-user"},
+		{"https://www.youtube.com/playlist?list=PL123_ab", "https://www.youtube.com/feeds/videos.xml?playlist_id=PL123_ab", "youtube-playlist"},
+		{"https://www.reddit.com/r/golang/", "https://www.reddit.com/r/golang/.rss", "reddit-subreddit"},
+		{"https://old.reddit.com/r/golang/top?t=week", "https://www.reddit.com/r/golang/top/.rss", "reddit-subreddit"},
+		{"https://www.reddit.com/u/spez", "https://www.reddit.com/user/spez/.rss", "reddit-user"},
+		{"https://github.com/golang/go", "https://github.com/golang/go/releases.atom", "github-releases"},
+		{"https://github.com/golang/go.git", "https://github.com/golang/go/releases.atom", "github-releases"},
+		{"https://github.com/golang/go/releases/", "https://github.com/golang/go/releases.atom", "github-releases"},
+		{"https://github.com/golang/go/tags", "https://github.com/golang/go/tags.atom", "github-tags"},
+		{"https://github.com/golang/go/commits/master", "https://github.com/golang/go/commits/master.atom", "github-commits"},
+		{"https://github.com/fujidaiti", "https://github.com/fujidaiti.atom", "github-user"},
+		{"https://github.com/explosion/spaCy", "https://github.com/explosion/spaCy/releases.atom", "github-releases"},
+		{"https://medium.com/@someone", "https://medium.com/feed/@someone", "medium-profile"},
+		{"https://mastodon.social/@Gargron", "https://mastodon.social/@Gargron.rss", "mastodon-profile"},
+	}
+	var rw *Rewriter // nil applies the built-in rules
+	for _, c := range cases {
+		got, rule, ok := rw.Rewrite(c.in)
+		if !ok || got != c.want || rule != c.rule {
+			t.Errorf("Rewrite(%q) = %q, %q, %v; want %q by %q", c.in, got, rule, ok, c.want, c.rule)
+		}
+	}
+	for _, in := range []string{
+		"https://example.com/blog/",
+		"https://www.youtube.com/feeds/videos.xml?channel_id=UC1",
+		"https://www.youtube.com/@handle",
+		"https://www.reddit.com/r/golang/.rss",
+		"https://github.com/golang/go/releases.atom",
+		"https://github.com/golang/go/issues/1",
+		"https://github.com/orgs/golang",
+		"https://github.com/orgs/golang/repositories",
+		"https://github.com/settings/profile",
+		"https://github.com/topics/go",
+		"https://github.com/marketplace",
+		"https://github.com/marketplace/actions/checkout",
+		"https://github.com/sponsors/fujidaiti",
+		"https://github.com/Settings/",
+		"http://mastodon.social/@Gargron",
+		"https://mastodon.social/@Gargron.rss",
+	} {
+		if got, rule, ok := rw.Rewrite(in); ok {
+			t.Errorf("Rewrite(%q) = %q by %q; want no rewrite", in, got, rule)
+		}
+	}
+}
+
+func TestRewriter_ConfigRules(t *testing.T) {
+	rules, err := RulesFromConfig(config.Config{SourceRewrites: []config.RewriteRule{
+		{Name: "mirror", Match: `^https://github\.com/(\w+)/(\w+)$`, Feed: "https://mirror.example/${1}/${2}.xml"},
+		{Match: `^https://ftp\.example/(.*)$`, Feed: "ftp://ftp.example/$1"},
+	}})
+	if err != nil {
+		t.Fatalf("rules: %v", err)
+	}
+	rw := NewRewriter(rules)
+	if got, rule, ok := rw.Rewrite("https://github.com/golang/go"); !ok || got != "https://mirror.example/golang/go.xml" || rule != "mirror" {
+		t.Fatalf("config rule should take precedence: %q %q %v", got, rule, ok)
+	}
+	if got, _, ok := rw.Rewrite("https://github.com/golang/go/tags"); !ok || got != "https://github.com/golang/go/tags.atom" {
+		t.Fatalf("built-in rules should still apply: %q %v", got, ok)
+	}
+	if got, _, ok := rw.Rewrite("https://ftp.example/feed"); ok {
+		t.Fatalf("non-http result should be ignored, got %q", got)
+	}
+	for _, bad := range []config.RewriteRule{{Match: `(`, Feed: "https://x/"}, {Match: `^x$`}} {
+		if _, err := RulesFromConfig(config.Config{SourceRewrites: []config.RewriteRule{bad}}); err == nil {
+			t.Fatalf("expected %+v rejected", bad)
+		}
+	}
+}
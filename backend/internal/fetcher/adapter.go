@@ -0,0 +1,160 @@
+package fetcher
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/fujidaiti/poppo-press/backend/internal/db"
+	"github.com/fujidaiti/poppo-press/backend/internal/httpclient"
+	"github.com/fujidaiti/poppo-press/backend/internal/normalize"
+)
+
+// SourceAdapter fetches a source that is not a feed, such as a JSON API, and
+// maps its items onto articles. Adapters are registered by source kind; the
+// source row's config holds the adapter's own settings as JSON.
+type SourceAdapter interface {
+	// Validate checks a source URL and config before the source is added.
+	Validate(sourceURL string, config json.RawMessage) error
+	// Request builds the request that fetches the source's items. The
+	// fetcher adds conditional headers.
+	Request(ctx context.Context, sourceURL string, config json.RawMessage) (*http.Request, error)
+	// Parse maps a response body onto articles. The fetcher fills in the
+	// source id and update time, computes missing canonical ids, and
+	// sanitizes titles and HTML.
+	Parse(body []byte, sourceURL string, config json.RawMessage) (AdapterResult, error)
+}
+
+// AdapterResult is what an adapter read from one response.
+type AdapterResult struct {
+	Title    string // title for the source when it is added
+	Articles []db.UpsertArticleParams
+}
+
+// adapters are the source adapters by source kind.
+var adapters = map[string]SourceAdapter{
+	"hn":     hnAdapter{},
+	"reddit": redditAdapter{},
+	"github": githubAdapter{},
+}
+
+// RegisterAdapter adds an adapter for sources of the given kind. It
+// must be called before any fetch starts, typically from an init function,
+// and panics when the kind is taken.
+func RegisterAdapter(kind string, a SourceAdapter) {
+	if _, ok := adapters[kind]; ok || kind == db.SourceKindFeed || kind == db.SourceKindScrape {
+		panic("fetcher: adapter kind already registered: " + kind)
+	}
+	adapters[kind] = a
+}
+
+// Adapter returns the adapter for sources of the given kind.
+func Adapter(kind string) (SourceAdapter, bool) {
+	a, ok := adapters[kind]
+	return a, ok
+}
+
+// ProbeAdapter validates the config of a source of the given kind and
+// fetches it once, as done when the source is added.
+func ProbeAdapter(ctx context.Context, client *http.Client, kind, sourceURL string, config json.RawMessage) (AdapterResult, error) {
+	a, ok := Adapter(kind)
+	if !ok {
+		return AdapterResult{}, fmt.Errorf("unknown source kind %q", kind)
+	}
+	if err := a.Validate(sourceURL, config); err != nil {
+		return AdapterResult{}, err
+	}
+	req, err := a.Request(ctx, sourceURL, config)
+	if err != nil {
+		return AdapterResult{}, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return AdapterResult{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return AdapterResult{}, statusError(resp, time.Now())
+	}
+	if err := httpclient.CheckContentType(resp.Header); err != nil {
+		return AdapterResult{}, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return AdapterResult{}, err
+	}
+	return a.Parse(body, sourceURL, config)
+}
+
+// ingestArticles upserts the articles an adapter produced for a source,
+// treating them as ingest treats feed items: titles are reduced to plain
+// text, summaries and bodies sanitized, and URLs canonicalized.
+func ingestArticles(ctx context.Context, database *sql.DB, sourceID int64, articles []db.UpsertArticleParams, backfilled bool) (int, error) {
+	var errs []error
+	n := 0
+	now := time.Now().UTC()
+	for _, p := range articles {
+		p.SourceID = sourceID
+		p.Backfilled = backfilled
+		p.UpdatedAt = now.Format(time.RFC3339)
+		if p.CanonicalID == "" {
+			published, _ := time.Parse(time.RFC3339, p.PublishedAt)
+			p.CanonicalID = computeCanonicalID("", p.CanonicalURL, p.Title, published)
+		}
+		p.Title = normalize.ToText(p.Title)
+		p.Summary = normalize.SanitizeHTML(p.Summary, p.CanonicalURL)
+		p.Content = normalize.SanitizeHTML(p.Content, p.CanonicalURL)
+		p.CanonicalURL = normalize.CanonicalURL(p.CanonicalURL)
+		if _, err := db.UpsertArticleByCanonicalID(ctx, database, p); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		n++
+	}
+	return n, errors.Join(errs...)
+}
+
+// decodeConfig unmarshals an adapter config into v; an empty config leaves
+// v unchanged. Unknown fields are rejected so that typos surface when the
+// source is added.
+func decodeConfig(config json.RawMessage, v any) error {
+	if len(bytes.TrimSpace(config)) == 0 || string(bytes.TrimSpace(config)) == "null" {
+		return nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(config))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("invalid config: %v", err)
+	}
+	return nil
+}
+
+// paragraphs renders plain text, such as Markdown release notes, as HTML
+// paragraphs split on blank lines.
+func paragraphs(text string) string {
+	var b strings.Builder
+	for _, p := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n\n") {
+		if p = strings.TrimSpace(p); p != "" {
+			b.WriteString("<p>" + html.EscapeString(p) + "</p>")
+		}
+	}
+	return b.String()
+}
+
+// rfc3339 normalizes an API timestamp to RFC 3339 in UTC, returning "" when
+// it does not parse.
+func rfc3339(s string) string {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
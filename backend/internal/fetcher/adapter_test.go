@@ -0,0 +1,267 @@
+package fetcher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fujidaiti/poppo-press/backend/internal/aggregator"
+	"github.com/fujidaiti/poppo-press/backend/internal/db"
+	"github.com/fujidaiti/poppo-press/backend/internal/testutil"
+)
+
+// apiStandIns serves canned responses of the APIs the built-in adapters read.
+func apiStandIns(t *testing.T) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/search", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"hits":[
+{"objectID":"1","title":"Show HN: A thing","url":"https://thing.example/","author":"alice","created_at":"2025-04-01T10:00:00.000Z","points":120,"num_comments":40},
+{"objectID":"2","title":"Ask HN: Why?","url":null,"author":"bob","created_at":"2025-04-01T11:00:00Z","points":80,"num_comments":3,"story_text":"<p>Just wondering</p>"},
+{"objectID":"3","title":"Quiet","url":"https://quiet.example/","points":2}]}`))
+	})
+	mux.HandleFunc("/r/golang/top/.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"data":{"children":[
+{"data":{"name":"t3_a","title":"Go 1.99 &amp; you","url":"https://go.dev/blog","permalink":"/r/golang/comments/a/","author":"gopher","subreddit":"golang","created_utc":1743500000,"score":300}},
+{"data":{"name":"t3_b","title":"Help","url":"https://www.reddit.com/r/golang/comments/b/","permalink":"/r/golang/comments/b/","subreddit":"golang","created_utc":1743500100,"score":50,"is_self":true,"selftext_html":"&lt;p&gt;my code&lt;/p&gt;"}},
+{"data":{"name":"t3_c","title":"Spicy","url":"https://spicy.example/","permalink":"/r/golang/comments/c/","subreddit":"golang","score":500,"over_18":true}}]}}`))
+	})
+	mux.HandleFunc("/repos/acme/tool/releases", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept") != "application/vnd.github+json" {
+			t.Errorf("unexpected accept header %q", r.Header.Get("Accept"))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`[
+{"id":3,"tag_name":"v2.0.0","name":"","html_url":"https://github.com/acme/tool/releases/tag/v2.0.0","draft":true},
+{"id":2,"tag_name":"v1.1.0-rc1","name":"RC","html_url":"https://github.com/acme/tool/releases/tag/v1.1.0-rc1","prerelease":true},
+{"id":1,"tag_name":"v1.0.0","name":"First","html_url":"https://github.com/acme/tool/releases/tag/v1.0.0","body":"Hello.\r\n\r\n* one <thing>","published_at":"2025-01-02T03:04:05Z","author":{"login":"octo"}}]`))
+	})
+	mux.HandleFunc("/repos/acme/tool/tags", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`[{"name":"v1.0.0","commit":{"sha":"abc"}},{"name":"v0.9.0","commit":{"sha":"def"}}]`))
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestFetchAllSources_Adapters(t *testing.T) {
+	database, cleanup := testutil.OpenTestDB(t, "admin-pass")
+	defer cleanup()
+	srv := apiStandIns(t)
+	create := func(kind, path, config string) int64 {
+		t.Helper()
+		id, err := db.CreateSource(context.Background(), database, db.CreateSourceParams{URL: srv.URL + path, Kind: kind, Config: config})
+		if err != nil {
+			t.Fatalf("create source: %v", err)
+		}
+		return id
+	}
+	hn := create("hn", "/api/v1/search?tags=front_page", `{"minPoints":10}`)
+	reddit := create("reddit", "/r/golang/top/.json", `{}`)
+	releases := create("github", "/repos/acme/tool/releases", `{}`)
+	tags := create("github", "/repos/acme/tool/tags", "")
+	for range 2 {
+		// a second pass updates rather than duplicates
+		for _, id := range []int64{hn, reddit, releases, tags} {
+			makeDue(t, database, id)
+		}
+		results, err := FetchAllSources(context.Background(), database, testutil.HTTPClient(t), Options{})
+		if err != nil {
+			t.Fatalf("fetch: %v", err)
+		}
+		for _, r := range results {
+			if r.Err != nil {
+				t.Fatalf("source %s: %v", r.URL, r.Err)
+			}
+		}
+	}
+	assertArticleCount(t, database, hn, 2)
+	assertArticleCount(t, database, reddit, 2)
+	assertArticleCount(t, database, releases, 1)
+	assertArticleCount(t, database, tags, 2)
+
+	article := func(sourceID int64, canonicalID string) (url, title, summary, content, author, published string) {
+		t.Helper()
+		err := database.QueryRow(`SELECT canonical_url, title, IFNULL(summary, ''), IFNULL(content, ''), IFNULL(author, ''), IFNULL(published_at, '')
+FROM article WHERE source_id = ? AND canonical_id = ?`, sourceID, canonicalID).Scan(&url, &title, &summary, &content, &author, &published)
+		if err != nil {
+			t.Fatalf("query %s: %v", canonicalID, err)
+		}
+		return
+	}
+	url, _, summary, _, author, published := article(hn, "hn:1")
+	if url != "https://thing.example/" || author != "alice" || !strings.Contains(summary, "item?id=1") || !strings.HasPrefix(published, "2025-04-01T10:00") {
+		t.Fatalf("unexpected hn story: %s %q %s %s", url, summary, author, published)
+	}
+	if url, _, _, content, _, _ := article(hn, "hn:2"); url != "https://news.ycombinator.com/item?id=2" || !strings.Contains(content, "Just wondering") {
+		t.Fatalf("unexpected ask hn: %s %q", url, content)
+	}
+	if url, title, _, _, _, _ := article(reddit, "reddit:t3_a"); url != "https://go.dev/blog" || title != "Go 1.99 & you" {
+		t.Fatalf("unexpected reddit link post: %s %q", url, title)
+	}
+	if url, _, _, content, _, _ := article(reddit, "reddit:t3_b"); url != "https://www.reddit.com/r/golang/comments/b/" || !strings.Contains(content, "<p>my code</p>") {
+		t.Fatalf("unexpected reddit self post: %s %q", url, content)
+	}
+	if _, title, _, content, author, published := article(releases, "github:acme/tool:release:v1.0.0"); title != "acme/tool First" || author != "octo" ||
+		!strings.Contains(content, "<p>Hello.</p>") || !strings.Contains(content, "&lt;thing&gt;") || !strings.HasPrefix(published, "2025-01-02") {
+		t.Fatalf("unexpected release: %q %q %s %s", title, content, author, published)
+	}
+	if url, _, _, _, _, _ := article(tags, "github:acme/tool:tag:v0.9.0"); url != "https://github.com/acme/tool/releases/tag/v0.9.0" {
+		t.Fatalf("unexpected tag: %s", url)
+	}
+}
+
+func TestFetchAllSources_AdapterParseFailure(t *testing.T) {
+	database, cleanup := testutil.OpenTestDB(t, "admin-pass")
+	defer cleanup()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"data": [`))
+	}))
+	defer srv.Close()
+	id, err := db.CreateSource(context.Background(), database, db.CreateSourceParams{URL: srv.URL + "/r/x/.json", Kind: "reddit"})
+	if err != nil {
+		t.Fatalf("create source: %v", err)
+	}
+	if _, err := FetchAllSources(context.Background(), database, testutil.HTTPClient(t), Options{}); err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	if h := readHealth(t, database, id); h.class != ClassParse {
+		t.Fatalf("expected parse failure, got %+v", h)
+	}
+}
+
+func TestFetchAllSources_AdapterCountsAreNoEdits(t *testing.T) {
+	database, cleanup := testutil.OpenTestDB(t, "admin-pass")
+	defer cleanup()
+	var score int
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/search", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"hits":[{"objectID":"1","title":"Rising","url":"https://rising.example/","created_at":"2025-04-01T10:00:00Z","points":%d,"num_comments":%d}]}`, score, score/2)
+	})
+	mux.HandleFunc("/r/golang/new/.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"data":{"children":[{"data":{"name":"t3_a","title":"Rising","url":"https://rising.example/","permalink":"/r/golang/comments/a/","subreddit":"golang","created_utc":1743500000,"score":%d,"num_comments":%d}}]}}`, score, score/2)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	var ids []int64
+	for _, s := range []db.CreateSourceParams{{URL: srv.URL + "/api/v1/search", Kind: "hn"}, {URL: srv.URL + "/r/golang/new/.json", Kind: "reddit"}} {
+		id, err := db.CreateSource(context.Background(), database, s)
+		if err != nil {
+			t.Fatalf("create source: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	// the same items, voted and commented on between polls
+	for _, score = range []int{10, 250} {
+		for _, id := range ids {
+			makeDue(t, database, id)
+		}
+		results, err := FetchAllSources(context.Background(), database, testutil.HTTPClient(t), Options{})
+		if err != nil || len(results) != 2 || results[0].Err != nil || results[1].Err != nil {
+			t.Fatalf("fetch: %+v %v", results, err)
+		}
+	}
+	var revisions, revised int
+	if err := database.QueryRow("SELECT (SELECT COUNT(1) FROM article_revision), (SELECT COUNT(1) FROM article WHERE revised_at IS NOT NULL)").Scan(&revisions, &revised); err != nil {
+		t.Fatalf("count: %v", err)
+	}
+	if revisions != 0 || revised != 0 {
+		t.Fatalf("expected no edits, got %d revisions and %d revised articles", revisions, revised)
+	}
+}
+
+func TestBackfill_ExistingTagsAreNoNews(t *testing.T) {
+	database, cleanup := testutil.OpenTestDB(t, "admin-pass")
+	defer cleanup()
+	tags := `{"name":"v1.0.0","commit":{"sha":"abc"}},{"name":"v0.9.0","commit":{"sha":"def"}}`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, "["+tags+"]")
+	}))
+	defer srv.Close()
+	id, err := db.CreateSource(context.Background(), database, db.CreateSourceParams{URL: srv.URL + "/repos/acme/tool/tags", Kind: "github"})
+	if err != nil {
+		t.Fatalf("create source: %v", err)
+	}
+	edition := func(cutoff time.Time) []string {
+		t.Helper()
+		if err := aggregator.AssembleEdition(context.Background(), database, time.UTC, aggregator.DailySlot, cutoff); err != nil {
+			t.Fatalf("assemble: %v", err)
+		}
+		rows, err := database.Query(`SELECT a.canonical_id FROM edition_article ea JOIN edition e ON e.id = ea.edition_id JOIN article a ON a.id = ea.article_id
+WHERE e.cutoff_at = ? ORDER BY ea.position`, cutoff.UTC().Format(time.RFC3339))
+		if err != nil {
+			t.Fatalf("entries: %v", err)
+		}
+		defer rows.Close()
+		var ids []string
+		for rows.Next() {
+			var s string
+			if err := rows.Scan(&s); err != nil {
+				t.Fatalf("scan: %v", err)
+			}
+			ids = append(ids, s)
+		}
+		return ids
+	}
+
+	// the tags the repository already has are stored, but are no news
+	if err := Backfill(context.Background(), database, testutil.HTTPClient(t), Options{}, id); err != nil {
+		t.Fatalf("backfill: %v", err)
+	}
+	assertArticleCount(t, database, id, 2)
+	// as if added an hour ago
+	mustExec(t, database, `UPDATE article SET created_at = datetime(created_at, '-1 hour'),
+  published_at = strftime('%Y-%m-%dT%H:%M:%SZ', published_at, '-1 hour')`)
+	first := time.Now().Add(-30 * time.Minute)
+	if got := edition(first); len(got) != 0 {
+		t.Fatalf("expected existing tags left out, got %v", got)
+	}
+
+	// a tag pushed later is
+	tags = `{"name":"v1.1.0","commit":{"sha":"123"}},` + tags
+	makeDue(t, database, id)
+	if _, err := FetchAllSources(context.Background(), database, testutil.HTTPClient(t), Options{}); err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	if got := edition(first.Add(24 * time.Hour)); len(got) != 1 || got[0] != "github:acme/tool:tag:v1.1.0" {
+		t.Fatalf("expected the new tag only, got %v", got)
+	}
+}
+
+func TestAdapters_Validate(t *testing.T) {
+	for _, c := range []struct {
+		kind, url, config string
+		ok                bool
+	}{
+		{"hn", "https://hn.algolia.com/api/v1/search", `{"minPoints":5}`, true},
+		{"hn", "https://hn.algolia.com/api/v1/search", `{"minPoints":-1}`, false},
+		{"hn", "https://hn.algolia.com/api/v1/search", `{"minPionts":5}`, false},
+		{"reddit", "https://www.reddit.com/r/golang/.json", `{"includeNsfw":true}`, true},
+		{"reddit", "https://www.reddit.com/r/golang/", ``, false},
+		{"github", "https://api.github.com/repos/o/r/tags", `null`, true},
+		{"github", "https://api.github.com/repos/o/r", ``, false},
+	} {
+		a, ok := Adapter(c.kind)
+		if !ok {
+			t.Fatalf("no adapter for %s", c.kind)
+		}
+		if err := a.Validate(c.url, json.RawMessage(c.config)); (err == nil) != c.ok {
+			t.Fatalf("%s %s %s: got err %v", c.kind, c.url, c.config, err)
+		}
+	}
+	if _, ok := Adapter(db.SourceKindScrape); ok {
+		t.Fatalf("scrape must not be an adapter kind")
+	}
+}
@@ -0,0 +1,160 @@
+package fetcher
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+
+	"github.com/fujidaiti/poppo-press/backend/internal/db"
+	"github.com/fujidaiti/poppo-press/backend/internal/httpclient"
+)
+
+// Backfill fetches a newly added source right away instead of waiting for
+// its first scheduled poll, then walks back through the feed's archive
+// (RFC 5005 prev-archive links of archived feeds, or next links of paged
+// feeds) so that the subscription arrives with its recent history. The walk
+// reads at most opts.BackfillPages older documents and stops at the first
+// one whose items are all older than opts.BackfillMaxAge; older items are
+// not stored. Archived items are stored as polled ones, without page
+// extraction or proxy link resolution. Articles first stored by a backfill
+// are marked as such, so that editions can leave out the old ones.
+//
+// Progress (documents read, items stored) is recorded as the walk goes so
+// that clients can follow it. The first fetch counts as a regular poll for
+// the source's health and schedule; a failing archive page ends the walk
+// and marks the backfill failed, keeping what was stored.
+func Backfill(ctx context.Context, database *sql.DB, client *http.Client, opts Options, sourceID int64) error {
+	if client == nil {
+		client = httpclient.Default()
+	}
+	opts = opts.withDefaults()
+	s, ok, err := db.GetSourceForFetch(ctx, database, sourceID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("backfill: no active source %d", sourceID)
+	}
+	if err := db.StartBackfill(ctx, database, s.ID, time.Now()); err != nil {
+		return err
+	}
+	err = backfill(ctx, database, client, opts, s)
+	msg := ""
+	if err != nil {
+		msg = err.Error()
+	}
+	// record the end even when ctx ran out
+	_ = db.FinishBackfill(context.WithoutCancel(ctx), database, s.ID, time.Now(), msg)
+	return err
+}
+
+// backfill performs the fetches of Backfill, recording progress.
+func backfill(ctx context.Context, database *sql.DB, client *http.Client, opts Options, s db.SourceFetchRow) error {
+	fetchCtx, cancel := context.WithTimeout(ctx, opts.SourceTimeout)
+	out, err := fetchSource(fetchCtx, database, client, opts.Credentials, s)
+	cancel()
+	if out != nil {
+		out.backfilled = true
+	}
+	res := record(ctx, database, opts, s, out, err)
+	if res.Err != nil {
+		return res.Err
+	}
+	pages, items := 1, res.Items
+	if err := db.UpdateBackfill(ctx, database, s.ID, pages, items); err != nil {
+		return err
+	}
+	if out.notModified || s.Kind != db.SourceKindFeed {
+		return nil
+	}
+	feedClient, _, err := sourceClient(client, opts.Credentials, s)
+	if err != nil {
+		return err
+	}
+	var cutoff time.Time
+	if opts.BackfillMaxAge > 0 {
+		cutoff = time.Now().Add(-opts.BackfillMaxAge)
+	}
+	seen := map[string]bool{s.URL: true}
+	for next := out.archive; next != "" && !seen[next] && pages <= opts.BackfillPages; pages++ {
+		seen[next] = true
+		feed, older, err := fetchArchive(ctx, feedClient, next, opts.SourceTimeout)
+		if err != nil {
+			return fmt.Errorf("archive page %s: %w", next, classify(err))
+		}
+		recent, done := itemsSince(feed, cutoff)
+		n, err := ingest(ctx, database, s.ID, recent, nil, true)
+		items += n
+		if err != nil {
+			return err
+		}
+		if err := db.UpdateBackfill(ctx, database, s.ID, pages+1, items); err != nil {
+			return err
+		}
+		if done {
+			break
+		}
+		next = older
+	}
+	return nil
+}
+
+// fetchArchive downloads and parses one archive document of a feed,
+// returning it with the URL of the next older one ("" at the end).
+func fetchArchive(ctx context.Context, client *http.Client, pageURL string, timeout time.Duration) (*gofeed.Feed, string, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pageURL, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, "", statusError(resp, time.Now())
+	}
+	if err := httpclient.CheckContentType(resp.Header); err != nil {
+		return nil, "", err
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", err
+	}
+	feed, err := gofeed.NewParser().Parse(bytes.NewReader(body))
+	if err != nil {
+		return nil, "", &FetchError{Class: ClassParse, Err: err}
+	}
+	return feed, archiveLink(resp.Header, body, resp.Request.URL), nil
+}
+
+// itemsSince returns a copy of feed holding only the items published at or
+// after cutoff (all of them when cutoff is zero), and whether every dated
+// item was older, which ends the walk. Undated items are kept.
+func itemsSince(feed *gofeed.Feed, cutoff time.Time) (*gofeed.Feed, bool) {
+	if cutoff.IsZero() {
+		return feed, false
+	}
+	kept := *feed
+	kept.Items = nil
+	dated, old := 0, 0
+	for _, item := range feed.Items {
+		if item.PublishedParsed != nil || item.UpdatedParsed != nil {
+			dated++
+			if itemPublished(item).Before(cutoff) {
+				old++
+				continue
+			}
+		}
+		kept.Items = append(kept.Items, item)
+	}
+	return &kept, dated > 0 && old == dated
+}
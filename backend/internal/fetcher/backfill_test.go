@@ -0,0 +1,122 @@
+package fetcher
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fujidaiti/poppo-press/backend/internal/db"
+	"github.com/fujidaiti/poppo-press/backend/internal/testutil"
+)
+
+// archivedFeed serves an RFC 5005 archived feed: the current document and
+// two archive pages, each entry dated daysAgo days before now. The oldest
+// page links back to the newer one, which the walk must not follow again.
+func archivedFeed(t *testing.T) *httptest.Server {
+	t.Helper()
+	entries := func(prefix string, daysAgo ...int) string {
+		var b strings.Builder
+		for i, d := range daysAgo {
+			ts := time.Now().UTC().AddDate(0, 0, -d).Format(time.RFC3339)
+			fmt.Fprintf(&b, `<entry><id>urn:%s:%d</id><title>%s %d</title><link href="https://blog.example/%s/%d"/><updated>%s</updated></entry>`, prefix, i, prefix, i, prefix, i, ts)
+		}
+		return b.String()
+	}
+	doc := func(prev, body string) string {
+		link := ""
+		if prev != "" {
+			link = `<link rel="prev-archive" href="` + prev + `"/>`
+		}
+		return `<?xml version="1.0"?><feed xmlns="http://www.w3.org/2005/Atom"><title>Blog</title><id>urn:blog</id>` + link + body + `</feed>`
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/feed", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/atom+xml")
+		fmt.Fprint(w, doc("/archive/2", entries("current", 1, 2)))
+	})
+	mux.HandleFunc("/archive/2", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/atom+xml")
+		fmt.Fprint(w, doc("1", entries("two", 10, 20, 30)))
+	})
+	mux.HandleFunc("/archive/1", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/atom+xml")
+		fmt.Fprint(w, doc("/archive/2", entries("one", 100, 200)))
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func readBackfill(t *testing.T, database *sql.DB, sourceID int64) db.SourceBackfill {
+	t.Helper()
+	var b db.SourceBackfill
+	if err := database.QueryRow("SELECT state, pages, items, error, started_at, finished_at FROM source_backfill WHERE source_id = ?", sourceID).
+		Scan(&b.State, &b.Pages, &b.Items, &b.Error, &b.StartedAt, &b.FinishedAt); err != nil {
+		t.Fatalf("backfill: %v", err)
+	}
+	return b
+}
+
+func TestBackfill_WalksArchives(t *testing.T) {
+	srv := archivedFeed(t)
+	for _, c := range []struct {
+		name         string
+		opts         Options
+		pages, items int
+	}{
+		{"unbounded", Options{}, 3, 7},
+		{"page limit", Options{BackfillPages: 1}, 2, 5},
+		{"no archives", Options{BackfillPages: -1}, 1, 2},
+		{"max age", Options{BackfillMaxAge: 15 * 24 * time.Hour}, 3, 3},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			database, cleanup := testutil.OpenTestDB(t, "admin-pass")
+			defer cleanup()
+			id := insertSource(t, database, srv.URL+"/feed")
+			if err := Backfill(context.Background(), database, testutil.HTTPClient(t), c.opts, id); err != nil {
+				t.Fatalf("backfill: %v", err)
+			}
+			assertArticleCount(t, database, id, c.items)
+			b := readBackfill(t, database, id)
+			if b.State != db.BackfillDone || b.Pages != c.pages || b.Items != c.items || b.FinishedAt == nil || b.Error != nil {
+				t.Fatalf("unexpected progress: %+v", b)
+			}
+			if h := readHealth(t, database, id); h.failures != 0 || !h.lastSuccess.Valid || h.nextNull {
+				t.Fatalf("expected the first fetch recorded as a poll: %+v", h)
+			}
+			var polled int
+			if err := database.QueryRow("SELECT COUNT(1) FROM article WHERE source_id = ? AND NOT backfilled", id).Scan(&polled); err != nil || polled != 0 {
+				t.Fatalf("expected every article marked backfilled, %d are not (%v)", polled, err)
+			}
+		})
+	}
+}
+
+func TestBackfill_FailingArchiveKeepsProgress(t *testing.T) {
+	database, cleanup := testutil.OpenTestDB(t, "admin-pass")
+	defer cleanup()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/feed" {
+			http.Error(w, "gone fishing", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/rss+xml")
+		w.Header().Set("Link", `</old>; rel="prev-archive"`)
+		fmt.Fprint(w, `<?xml version="1.0"?><rss version="2.0"><channel><title>T</title><item><guid>a</guid><title>A</title><link>https://e/a</link></item></channel></rss>`)
+	}))
+	defer srv.Close()
+	id := insertSource(t, database, srv.URL+"/feed")
+	if err := Backfill(context.Background(), database, testutil.HTTPClient(t), Options{}, id); err == nil {
+		t.Fatalf("expected the archive failure reported")
+	}
+	assertArticleCount(t, database, id, 1)
+	b := readBackfill(t, database, id)
+	if b.State != db.BackfillFailed || b.Pages != 1 || b.Items != 1 || b.Error == nil || !strings.Contains(*b.Error, "/old") {
+		t.Fatalf("unexpected progress: %+v", b)
+	}
+}
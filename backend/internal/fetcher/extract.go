@@ -0,0 +1,70 @@
+package fetcher
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+
+	"github.com/mmcdole/gofeed"
+
+	"github.com/fujidaiti/poppo-press/backend/internal/db"
+	"github.com/fujidaiti/poppo-press/backend/internal/httpclient"
+	"github.com/fujidaiti/poppo-press/backend/internal/readability"
+)
+
+// maxExtractPerFetch bounds how many linked pages a single source fetch may
+// download, keeping a large summary-only feed within its source timeout.
+const maxExtractPerFetch = 10
+
+// extractMissing downloads and extracts the linked pages of items that carry
+// no body in the feed and have none stored yet. It returns the extracted
+// pages keyed by item index. Failures on individual pages are skipped; the
+// item keeps its summary and is retried on the next fetch.
+func extractMissing(ctx context.Context, database *sql.DB, client *http.Client, sourceID int64, feed *gofeed.Feed) map[int]linkedPage {
+	out := map[int]linkedPage{}
+	for i, item := range feed.Items {
+		if len(out) >= maxExtractPerFetch || ctx.Err() != nil {
+			break
+		}
+		if item.Content != "" || item.Link == "" {
+			continue
+		}
+		has, err := db.ArticleHasContent(ctx, database, sourceID, itemCanonicalID(item))
+		if err != nil || has {
+			continue
+		}
+		page, err := extractPage(ctx, client, item.Link)
+		if err != nil {
+			continue
+		}
+		out[i] = page
+	}
+	return out
+}
+
+// extractPage downloads a web page and returns its main content as HTML
+// together with its canonical URL: the page's rel=canonical link, or the
+// URL the download ended at.
+func extractPage(ctx context.Context, client *http.Client, pageURL string) (linkedPage, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pageURL, nil)
+	if err != nil {
+		return linkedPage{}, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return linkedPage{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return linkedPage{}, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	if err := httpclient.CheckContentType(resp.Header); err != nil {
+		return linkedPage{}, err
+	}
+	a, err := readability.Extract(resp.Body)
+	if err != nil {
+		return linkedPage{}, err
+	}
+	return linkedPage{body: a.HTML, url: pageCanonical(resp.Request.URL, a.Canonical)}, nil
+}
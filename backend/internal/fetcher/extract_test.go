@@ -0,0 +1,117 @@
+package fetcher
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fujidaiti/poppo-press/backend/internal/testutil"
+)
+
+func TestFetchAllSources_StoresFeedBodyAndExtractsSummaryOnlyItems(t *testing.T) {
+	database, cleanup := testutil.OpenTestDB(t, "admin-pass")
+	defer cleanup()
+
+	pageHits := 0
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/full.xml":
+			w.Header().Set("Content-Type", "application/rss+xml")
+			fmt.Fprint(w, `<?xml version="1.0"?><rss version="2.0" xmlns:content="http://purl.org/rss/1.0/modules/content/"><channel><title>Full</title>
+<item><guid>full-1</guid><title>Full</title><link>https://ex/full</link><description>short</description><content:encoded><![CDATA[<p>The whole story.</p>]]></content:encoded></item>
+</channel></rss>`)
+		case "/summary.xml":
+			w.Header().Set("Content-Type", "application/rss+xml")
+			fmt.Fprintf(w, `<?xml version="1.0"?><rss version="2.0"><channel><title>Summary</title>
+<item><guid>sum-1</guid><title>Teaser</title><link>%s/post</link><description>Read more...</description></item>
+</channel></rss>`, srv.URL)
+		case "/post":
+			pageHits++
+			fmt.Fprint(w, `<html><body><nav class="menu"><a href="/">Home</a></nav><div class="entry-content">
+<p>This is the extracted article body, long enough to count as a real paragraph of text.</p>
+<p>And a second paragraph, which also has enough words, commas, and substance to be kept.</p>
+</div></body></html>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	fullID := insertSource(t, database, srv.URL+"/full.xml")
+	sumID := insertSource(t, database, srv.URL+"/summary.xml")
+	mustExec(t, database, "UPDATE source SET content_mode = 'extract' WHERE id = ?", sumID)
+
+	for range 2 {
+		if _, err := FetchAllSources(context.Background(), database, &http.Client{Timeout: 5 * time.Second}, Options{}); err != nil {
+			t.Fatalf("fetch: %v", err)
+		}
+	}
+
+	if got := articleContent(t, database, fullID); got != "<p>The whole story.</p>" {
+		t.Fatalf("feed body not stored: %q", got)
+	}
+	got := articleContent(t, database, sumID)
+	if !strings.Contains(got, "extracted article body") || strings.Contains(got, "Home") {
+		t.Fatalf("unexpected extracted body: %q", got)
+	}
+	if pageHits != 1 {
+		t.Fatalf("expected the page to be extracted once, got %d downloads", pageHits)
+	}
+}
+
+func TestFetchAllSources_UndatedItemsWithoutGUIDKeepTheirID(t *testing.T) {
+	database, cleanup := testutil.OpenTestDB(t, "admin-pass")
+	defer cleanup()
+
+	pageHits := 0
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/feed.xml":
+			w.Header().Set("Content-Type", "application/rss+xml")
+			fmt.Fprintf(w, `<?xml version="1.0"?><rss version="2.0"><channel><title>Undated</title>
+<item><title>Teaser</title><link>%s/post</link><description>Read more...</description></item>
+</channel></rss>`, srv.URL)
+		case "/post":
+			pageHits++
+			fmt.Fprint(w, `<html><body><div class="entry-content">
+<p>This is the extracted article body, long enough to count as a real paragraph of text.</p>
+</div></body></html>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	id := insertSource(t, database, srv.URL+"/feed.xml")
+	mustExec(t, database, "UPDATE source SET content_mode = 'extract' WHERE id = ?", id)
+
+	for i := range 2 {
+		if i > 0 {
+			// ids used to hash the time of the fetch, to the second
+			time.Sleep(time.Second)
+		}
+		makeDue(t, database, id)
+		if _, err := FetchAllSources(context.Background(), database, testutil.HTTPClient(t), Options{}); err != nil {
+			t.Fatalf("fetch: %v", err)
+		}
+	}
+	assertArticleCount(t, database, id, 1)
+	if pageHits != 1 {
+		t.Fatalf("expected the page to be extracted once, got %d downloads", pageHits)
+	}
+}
+
+func articleContent(t *testing.T, database *sql.DB, sourceID int64) string {
+	t.Helper()
+	var content string
+	if err := database.QueryRow("SELECT IFNULL(content, '') FROM article WHERE source_id = ?", sourceID).Scan(&content); err != nil {
+		t.Fatalf("content: %v", err)
+	}
+	return content
+}
@@ -1,90 +1,382 @@
+// Package fetcher polls registered sources with conditional GETs, parses their
+// feeds, and upserts the resulting articles.
 package fetcher
 
 import (
+	"bytes"
 	"context"
 	"crypto/sha1"
 	"database/sql"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"net/url"
 	"time"
 
 	"github.com/mmcdole/gofeed"
 
+	"github.com/fujidaiti/poppo-press/backend/internal/credentials"
 	"github.com/fujidaiti/poppo-press/backend/internal/db"
+	"github.com/fujidaiti/poppo-press/backend/internal/httpclient"
+	"github.com/fujidaiti/poppo-press/backend/internal/normalize"
+	"github.com/fujidaiti/poppo-press/backend/internal/scrape"
 )
 
-func FetchAllSources(ctx context.Context, database *sql.DB, client *http.Client) error {
+// Result reports the outcome of fetching a single source during a run.
+type Result struct {
+	SourceID    int64
+	URL         string
+	Items       int   // number of items upserted
+	NotModified bool  // upstream answered 304
+	Err         error // nil when the source was fetched and stored successfully
+}
+
+// fetchOutcome carries what a worker learned from the network for one source
+// so that the coordinator can persist it.
+type fetchOutcome struct {
+	notModified  bool
+	etag         string
+	lastModified string
+	feed         *gofeed.Feed
+	articles     []db.UpsertArticleParams // items of an adapter source, which has no feed
+	pages        map[int]linkedPage       // item index → what its linked page revealed
+	hub, self    string                   // WebSub hub and topic advertised by the feed
+	hints        scheduleHints            // publisher hints for the polling interval
+	movedTo      string                   // final URL when only permanent redirects were followed
+	archive      string                   // older feed document (RFC 5005); "" when none
+	backfilled   bool                     // fetched by a backfill; its new items are marked so
+}
+
+// FetchAllSources fetches every source that is due using a bounded worker
+// pool and persists parsed items. Results are returned and persisted in
+// source id order regardless of which fetch completes first, so a run is
+// reproducible. After a success the source's next fetch is scheduled one
+// polling interval ahead (see effectiveInterval). A failing source never
+// aborts the run; its error is reported in its Result and recorded in the
+// source's health, deferring its next attempt with exponential backoff.
+// Sources not yet due are skipped.
+//
+// A source whose feed answers 410 Gone is marked dead and no longer polled.
+// One whose feed is permanently redirected (301, 308) to the same URL on
+// opts.RedirectThreshold consecutive fetches has its URL rewritten, keeping
+// the old URL as an alias.
+func FetchAllSources(ctx context.Context, database *sql.DB, client *http.Client, opts Options) ([]Result, error) {
 	if client == nil {
-		client = &http.Client{Timeout: 10 * time.Second}
+		client = httpclient.Default()
 	}
-	sources, err := db.ListSourcesForFetch(ctx, database)
+	opts = opts.withDefaults()
+	sources, err := db.ListSourcesForFetch(ctx, database, time.Now())
 	if err != nil {
-		return err
+		return nil, err
 	}
-	for _, s := range sources {
-		req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.URL, nil)
-		if err != nil {
-			continue
+	results := make([]Result, len(sources))
+	run(ctx, sources, opts, func(ctx context.Context, s db.SourceFetchRow) (*fetchOutcome, error) {
+		return fetchSource(ctx, database, client, opts.Credentials, s)
+	}, func(i int, out *fetchOutcome, err error) {
+		results[i] = record(ctx, database, opts, sources[i], out, err)
+	})
+	return results, nil
+}
+
+// record persists what fetching s yielded — its items and validators, or its
+// failure — and updates its health, polling interval and next fetch time. A
+// fetch whose items cannot be stored is recorded as a failure.
+func record(ctx context.Context, database *sql.DB, opts Options, s db.SourceFetchRow, out *fetchOutcome, err error) Result {
+	res := Result{SourceID: s.ID, URL: s.URL}
+	now := time.Now()
+	if err == nil {
+		res.NotModified = out.notModified
+		if res.Items, err = persistOutcome(ctx, database, s, out); err != nil {
+			err = &FetchError{Class: ClassStorage, Err: err}
 		}
-		if s.ETag != "" {
-			req.Header.Set("If-None-Match", s.ETag)
+	}
+	if err != nil {
+		res.Err = err
+		if ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+			// The run ended before this source finished; not its fault.
+			return res
 		}
-		if s.LastModified != "" {
-			req.Header.Set("If-Modified-Since", s.LastModified)
+		fe := classify(err)
+		res.Err = fe
+		next := now.Add(retryDelay(fe, s.ConsecutiveFailures+1, opts.BackoffBase, opts.BackoffMax))
+		_ = db.RecordFetchFailure(ctx, database, s.ID, now, fe.Class, fe.Err.Error(), next)
+		if fe.Class == ClassGone {
+			_ = db.MarkSourceDead(ctx, database, s.ID, s.URL+" answered 410 Gone", now)
 		}
-		resp, err := client.Do(req)
+		return res
+	}
+	interval := effectiveInterval(s.PollIntervalOverride, out.hints, opts)
+	if out.notModified && s.PollIntervalOverride <= 0 && out.hints.maxAge <= 0 && s.PollInterval > 0 {
+		// a 304 carries no feed hints; keep the interval learned from the body
+		interval = min(max(s.PollInterval, opts.MinInterval), opts.MaxInterval)
+	}
+	if interval != s.PollInterval {
+		_ = db.SetSourcePollInterval(ctx, database, s.ID, interval)
+	}
+	_ = db.RecordFetchSuccess(ctx, database, s.ID, now, nextFetchAt(s.ID, now, interval, out.hints))
+	if out.movedTo != "" && out.movedTo != s.URL {
+		_, _ = db.RecordPermanentRedirect(ctx, database, s.ID, out.movedTo, opts.RedirectThreshold, now)
+	} else if s.RedirectCount > 0 {
+		_ = db.ClearPendingRedirect(ctx, database, s.ID)
+	}
+	return res
+}
+
+// fetchSource performs a conditional GET against the source and parses the
+// body when the upstream reports a change; a scraped source has its page
+// built into a feed instead, and a source with an adapter (see
+// SourceAdapter) has its response mapped onto articles. For sources in
+// extract mode it also downloads the pages of summary-only items; new items
+// linked through a feed proxy have their destination resolved. The source's
+// credential, if any, is sent with the feed request only.
+func fetchSource(ctx context.Context, database *sql.DB, client *http.Client, box *credentials.Box, s db.SourceFetchRow) (*fetchOutcome, error) {
+	feedClient, cred, err := sourceClient(client, box, s)
+	if err != nil {
+		return nil, err
+	}
+	adapter, isAdapter := Adapter(s.Kind)
+	var req *http.Request
+	if isAdapter {
+		req, err = adapter.Request(ctx, s.URL, json.RawMessage(s.Config))
+	} else {
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, s.URL, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Prefer the strong validator; If-Modified-Since is only a fallback.
+	if s.ETag != "" {
+		req.Header.Set("If-None-Match", s.ETag)
+	} else if s.LastModified != "" {
+		req.Header.Set("If-Modified-Since", s.LastModified)
+	}
+	tracked, redirects := trackRedirects(feedClient, cred)
+	resp, err := tracked.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified {
+		return &fetchOutcome{notModified: true, hints: feedHints(resp.Header, nil, nil), movedTo: redirects.movedTo()}, nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, statusError(resp, time.Now())
+	}
+	if err := httpclient.CheckContentType(resp.Header); err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if isAdapter {
+		res, err := adapter.Parse(body, s.URL, json.RawMessage(s.Config))
 		if err != nil {
-			continue
+			return nil, &FetchError{Class: ClassParse, Err: err}
 		}
-		if resp.StatusCode == http.StatusNotModified {
-			_ = resp.Body.Close()
-			continue
+		return &fetchOutcome{
+			etag:         resp.Header.Get("ETag"),
+			lastModified: resp.Header.Get("Last-Modified"),
+			articles:     res.Articles,
+			hints:        feedHints(resp.Header, nil, nil),
+			movedTo:      redirects.movedTo(),
+		}, nil
+	}
+	var feed *gofeed.Feed
+	if s.Kind == db.SourceKindScrape {
+		feed, err = scrapeFeed(s, body, resp.Request.URL)
+	} else {
+		feed, err = gofeed.NewParser().Parse(bytes.NewReader(body))
+	}
+	if err != nil {
+		return nil, &FetchError{Class: ClassParse, Err: err}
+	}
+	out := &fetchOutcome{
+		etag:         resp.Header.Get("ETag"),
+		lastModified: resp.Header.Get("Last-Modified"),
+		feed:         feed,
+		movedTo:      redirects.movedTo(),
+	}
+	if s.Kind == db.SourceKindScrape {
+		// a page carries no feed-level hints or hub; only its headers count
+		out.hints = feedHints(resp.Header, nil, nil)
+	} else {
+		out.hub, out.self = hubLinks(resp.Header, body)
+		out.archive = archiveLink(resp.Header, body, resp.Request.URL)
+		out.hints = feedHints(resp.Header, feed, body)
+	}
+	if s.ContentMode == db.ContentModeExtract {
+		out.pages = extractMissing(ctx, database, client, s.ID, feed)
+	}
+	out.pages = resolveProxyLinks(ctx, database, client, s.ID, feed, out.pages)
+	return out, nil
+}
+
+// scrapeFeed builds the feed of a scraped source from its page.
+func scrapeFeed(s db.SourceFetchRow, body []byte, base *url.URL) (*gofeed.Feed, error) {
+	var cfg scrape.Config
+	if err := json.Unmarshal([]byte(s.Config), &cfg); err != nil {
+		return nil, fmt.Errorf("scrape config: %w", err)
+	}
+	return scrape.Build(body, base, cfg)
+}
+
+// sourceClient returns the client for the feed request of s: client itself,
+// or for a source with a credential a copy that applies it to the feed's
+// host. It also returns the credential, the zero value when there is none.
+func sourceClient(client *http.Client, box *credentials.Box, s db.SourceFetchRow) (*http.Client, credentials.Credential, error) {
+	if s.Credential == nil {
+		return client, credentials.Credential{}, nil
+	}
+	cred, err := box.Open(s.ID, s.Credential)
+	if err != nil {
+		return nil, credentials.Credential{}, &FetchError{Class: ClassCredentials, Err: err}
+	}
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		return nil, credentials.Credential{}, err
+	}
+	return cred.Client(client, u.Host), cred, nil
+}
+
+// persistOutcome upserts the parsed items or adapter articles of a source and records its new
+// validators and any WebSub hub the feed advertises. It returns the number
+// of items written.
+func persistOutcome(ctx context.Context, database *sql.DB, s db.SourceFetchRow, out *fetchOutcome) (int, error) {
+	if out.notModified {
+		return 0, nil
+	}
+	var n int
+	var err error
+	if out.feed != nil {
+		n, err = ingest(ctx, database, s.ID, out.feed, out.pages, out.backfilled)
+	} else {
+		n, err = ingestArticles(ctx, database, s.ID, out.articles, out.backfilled)
+	}
+	errs := []error{err}
+	if err := db.UpdateSourceHeaders(ctx, database, s.ID, out.etag, out.lastModified); err != nil {
+		errs = append(errs, err)
+	}
+	if out.hub != "" {
+		topic := out.self
+		if topic == "" {
+			topic = s.URL
 		}
-		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-			_ = resp.Body.Close()
-			continue
+		if err := db.RecordWebSubHub(ctx, database, s.ID, out.hub, topic, time.Now()); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return n, errors.Join(errs...)
+}
+
+// IngestFeed upserts the items of a feed delivered for a source outside the
+// polling loop, such as a WebSub push. It returns the number of items
+// written.
+func IngestFeed(ctx context.Context, database *sql.DB, sourceID int64, feed *gofeed.Feed) (int, error) {
+	return ingest(ctx, database, sourceID, feed, nil, false)
+}
+
+// ingest upserts feed items for a source along with their media
+// enclosures, lead images, and tags (from item categories), and records the
+// feed's own image. Titles are
+// reduced to plain text and summaries and bodies are sanitized before
+// storage. Article URLs are canonicalized (see articleURL); pages supplies
+// bodies for items whose feed entry has none and resolved item URLs. New
+// articles are marked backfilled when they come from a backfill.
+func ingest(ctx context.Context, database *sql.DB, sourceID int64, feed *gofeed.Feed, pages map[int]linkedPage, backfilled bool) (int, error) {
+	var errs []error
+	if img := feedImage(feed); img != "" {
+		if err := db.SetSourceImage(ctx, database, sourceID, img); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	n := 0
+	for i, item := range feed.Items {
+		published := itemPublished(item)
+		content := item.Content
+		if content == "" {
+			content = pages[i].body
+		}
+		author := ""
+		if item.Author != nil {
+			author = item.Author.Name
+		}
+		canonicalID := itemCanonicalID(item)
+		publishedAt := ""
+		if item.PublishedParsed != nil || item.UpdatedParsed != nil {
+			// undated items keep the publish time of their first sighting
+			publishedAt = published.UTC().Format(time.RFC3339)
+		}
+		summary := normalize.SanitizeHTML(item.Description, item.Link)
+		content = normalize.SanitizeHTML(content, item.Link)
+		encs := itemEnclosures(item)
+		id, err := db.UpsertArticleByCanonicalID(ctx, database, db.UpsertArticleParams{
+			SourceID:       sourceID,
+			CanonicalURL:   articleURL(item, pages[i]),
+			ProvisionalURL: provisionalURL(item, pages[i]),
+			Title:          normalize.ToText(item.Title),
+			Summary:        summary,
+			Content:        content,
+			Author:         author,
+			ImageURL:       leadImage(item, encs, content, summary),
+			PublishedAt:    publishedAt,
+			UpdatedAt:      time.Now().UTC().Format(time.RFC3339),
+			CanonicalID:    canonicalID,
+			Backfilled:     backfilled,
+		})
+		if err == nil && id != 0 {
+			err = db.ReplaceArticleEnclosures(ctx, database, id, encs)
+		}
+		if err == nil && id != 0 {
+			err = db.ReplaceArticleTags(ctx, database, id, normalize.Tags(item.Categories))
 		}
-		etag := resp.Header.Get("ETag")
-		lastMod := resp.Header.Get("Last-Modified")
-		parser := gofeed.NewParser()
-		feed, err := parser.Parse(resp.Body)
-		_ = resp.Body.Close()
 		if err != nil {
+			errs = append(errs, err)
 			continue
 		}
-		for _, item := range feed.Items {
-			published := time.Now().UTC()
-			if item.PublishedParsed != nil {
-				published = *item.PublishedParsed
-			} else if item.UpdatedParsed != nil {
-				published = *item.UpdatedParsed
-			}
-			author := ""
-			if item.Author != nil {
-				author = item.Author.Name
-			}
-			canonicalID := computeCanonicalID(item.GUID, item.Link, item.Title, published)
-			_ = db.UpsertArticleByCanonicalID(ctx, database, db.UpsertArticleParams{
-				SourceID:     s.ID,
-				CanonicalURL: item.Link,
-				Title:        item.Title,
-				Summary:      item.Description,
-				Content:      "",
-				Author:       author,
-				PublishedAt:  published.UTC().Format(time.RFC3339),
-				UpdatedAt:    time.Now().UTC().Format(time.RFC3339),
-				CanonicalID:  canonicalID,
-			})
-		}
-		_ = db.UpdateSourceHeaders(ctx, database, s.ID, etag, lastMod)
+		n++
+	}
+	return n, errors.Join(errs...)
+}
+
+// itemPublished returns the item's publish time, falling back to its update
+// time and finally to now.
+func itemPublished(item *gofeed.Item) time.Time {
+	if item.PublishedParsed != nil {
+		return *item.PublishedParsed
+	}
+	if item.UpdatedParsed != nil {
+		return *item.UpdatedParsed
 	}
-	return nil
+	return time.Now().UTC()
 }
 
+// itemCanonicalID returns the canonical id of a feed item; see
+// computeCanonicalID. Undated items are identified by link and title alone,
+// as the time they are first seen at changes with every poll.
+func itemCanonicalID(item *gofeed.Item) string {
+	var published time.Time
+	if item.PublishedParsed != nil || item.UpdatedParsed != nil {
+		published = itemPublished(item)
+	}
+	return computeCanonicalID(item.GUID, item.Link, item.Title, published)
+}
+
+// computeCanonicalID returns the item's GUID, or a stable hash of its link,
+// title, and publish time when the feed provides no GUID; a zero publish
+// time leaves it out. The id identifies the item within its source only;
+// feeds are free to reuse each other's GUIDs.
 func computeCanonicalID(guid, link, title string, published time.Time) string {
 	if guid != "" {
 		return guid
 	}
-	h := sha1.Sum([]byte(link + "|" + title + "|" + published.UTC().Format(time.RFC3339)))
+	key := link + "|" + title
+	if !published.IsZero() {
+		key += "|" + published.UTC().Format(time.RFC3339)
+	}
+	h := sha1.Sum([]byte(key))
 	return hex.EncodeToString(h[:])
 }
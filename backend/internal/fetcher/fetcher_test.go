@@ -3,14 +3,18 @@ package fetcher
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	_ "modernc.org/sqlite"
 
+	"github.com/fujidaiti/poppo-press/backend/internal/db"
+	"github.com/fujidaiti/poppo-press/backend/internal/scrape"
 	"github.com/fujidaiti/poppo-press/backend/internal/testutil"
 )
 
@@ -43,14 +47,15 @@ func TestFetchAllSources_ConditionalGET_ParseAndDedupe(t *testing.T) {
 	srcID := insertSource(t, database, srv.URL)
 
 	// First run: should fetch, parse 2 items, update headers
-	if err := FetchAllSources(context.Background(), database, &http.Client{Timeout: 5 * time.Second}); err != nil {
+	if _, err := FetchAllSources(context.Background(), database, &http.Client{Timeout: 5 * time.Second}, Options{}); err != nil {
 		t.Fatalf("fetch 1: %v", err)
 	}
 	assertArticleCount(t, database, srcID, 2)
 	assertSourceHeaders(t, database, srcID, etag, lastMod)
 
 	// Second run with 304: no new items
-	if err := FetchAllSources(context.Background(), database, &http.Client{Timeout: 5 * time.Second}); err != nil {
+	makeDue(t, database, srcID)
+	if _, err := FetchAllSources(context.Background(), database, &http.Client{Timeout: 5 * time.Second}, Options{}); err != nil {
 		t.Fatalf("fetch 2: %v", err)
 	}
 	assertArticleCount(t, database, srcID, 2)
@@ -58,13 +63,85 @@ func TestFetchAllSources_ConditionalGET_ParseAndDedupe(t *testing.T) {
 	// Change feed: new item and new ETag
 	etag = "W/\"v2\""
 	items = append(items, `<item><guid>3</guid><title>C</title><link>https://ex/c</link><pubDate>Mon, 06 Sep 2021 02:00:00 GMT</pubDate></item>`)
+	makeDue(t, database, srcID)
 
-	if err := FetchAllSources(context.Background(), database, &http.Client{Timeout: 5 * time.Second}); err != nil {
+	if _, err := FetchAllSources(context.Background(), database, &http.Client{Timeout: 5 * time.Second}, Options{}); err != nil {
 		t.Fatalf("fetch 3: %v", err)
 	}
 	assertArticleCount(t, database, srcID, 3)
 }
 
+func TestFetchAllSources_SanitizesStoredHTML(t *testing.T) {
+	database, cleanup := testutil.OpenTestDB(t, "admin-pass")
+	defer cleanup()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/rss+xml")
+		fmt.Fprint(w, `<?xml version="1.0"?><rss version="2.0"><channel><title>T</title>
+<item><guid>s1</guid><title>Tom &amp;amp; Jerry</title><link>https://ex/posts/1</link><description><![CDATA[<p style="x" onclick="y()">Hi<script>evil()</script> <a href="/more">more</a></p><img src="https://ex/pixel.gif" width="1" height="1">]]></description></item>
+</channel></rss>`)
+	}))
+	defer srv.Close()
+	srcID := insertSource(t, database, srv.URL)
+
+	if _, err := FetchAllSources(context.Background(), database, testutil.HTTPClient(t), Options{}); err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	var title, summary string
+	if err := database.QueryRow("SELECT title, summary FROM article WHERE source_id = ?", srcID).Scan(&title, &summary); err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if title != "Tom & Jerry" {
+		t.Fatalf("title: %q", title)
+	}
+	if summary != `<p>Hi <a href="https://ex/more">more</a></p>` {
+		t.Fatalf("summary: %q", summary)
+	}
+}
+
+func TestFetchAllSources_ScopesCanonicalIDsBySource(t *testing.T) {
+	database, cleanup := testutil.OpenTestDB(t, "admin-pass")
+	defer cleanup()
+
+	feed := func(prefix string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/rss+xml")
+			fmt.Fprintf(w, `<?xml version="1.0"?><rss version="2.0"><channel><title>T</title>
+<item><guid>1</guid><title>%[1]s one</title><link>https://%[1]s.example/1</link></item>
+<item><guid>2</guid><title>%[1]s two</title><link>https://%[1]s.example/2</link></item>
+</channel></rss>`, prefix)
+		}))
+	}
+	a, b := feed("alpha"), feed("beta")
+	defer a.Close()
+	defer b.Close()
+	srcA := insertSource(t, database, a.URL)
+	// source B's item 2 was merged into source A's row while ids were global
+	mustExec(t, database, `INSERT INTO article(source_id, canonical_url, title, published_at, canonical_id)
+VALUES(?, 'https://alpha.example/2', 'beta two', '2025-10-19T00:00:00Z', '2')`, srcA)
+	srcB := insertSource(t, database, b.URL)
+
+	if _, err := FetchAllSources(context.Background(), database, testutil.HTTPClient(t), Options{}); err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	assertArticleCount(t, database, srcA, 2)
+	assertArticleCount(t, database, srcB, 2)
+	var title string
+	if err := database.QueryRow("SELECT title FROM article WHERE source_id = ? AND canonical_id = '1'", srcB).Scan(&title); err != nil || title != "beta one" {
+		t.Fatalf("source B item 1: %q %v", title, err)
+	}
+	var events int
+	if err := database.QueryRow("SELECT COUNT(1) FROM source_event WHERE source_id = ? AND kind = 'collision'", srcA).Scan(&events); err != nil || events != 1 {
+		t.Fatalf("expected one collision event on source A, got %d (%v)", events, err)
+	}
+}
+
+// makeDue clears a source's schedule so the next run fetches it.
+func makeDue(t *testing.T, database *sql.DB, sourceID int64) {
+	t.Helper()
+	mustExec(t, database, "UPDATE source_health SET next_fetch_at = NULL WHERE source_id = ?", sourceID)
+}
+
 func join(items []string) string {
 	s := ""
 	for _, it := range items {
@@ -104,3 +181,68 @@ func assertSourceHeaders(t *testing.T, db *sql.DB, id int64, etag, lastMod strin
 		t.Fatalf("headers mismatch: %q %q vs %q %q", gotE, gotL, etag, lastMod)
 	}
 }
+
+func TestFetchAllSources_StoresCategoriesAsTags(t *testing.T) {
+	database, cleanup := testutil.OpenTestDB(t, "admin-pass")
+	defer cleanup()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/rss+xml")
+		fmt.Fprint(w, `<?xml version="1.0"?><rss version="2.0"><channel><title>T</title>
+<item><guid>1</guid><title>A</title><link>https://ex/a</link><category>Go</category><category> golang </category><category>GO</category></item>
+<item><guid>2</guid><title>B</title><link>https://ex/b</link><category>Machine  Learning</category></item>
+</channel></rss>`)
+	}))
+	defer srv.Close()
+	insertSource(t, database, srv.URL)
+
+	if _, err := FetchAllSources(context.Background(), database, testutil.HTTPClient(t), Options{}); err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	rows, err := database.Query(`SELECT a.canonical_id, t.name FROM article_tag x JOIN tag t ON t.id = x.tag_id JOIN article a ON a.id = x.article_id ORDER BY a.canonical_id, t.name`)
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	defer rows.Close()
+	var got []string
+	for rows.Next() {
+		var id, name string
+		_ = rows.Scan(&id, &name)
+		got = append(got, id+":"+name)
+	}
+	if fmt.Sprint(got) != "[1:go 1:golang 2:machine learning]" {
+		t.Fatalf("unexpected tags: %v", got)
+	}
+}
+
+func TestFetchAllSources_ScrapesPages(t *testing.T) {
+	database, cleanup := testutil.OpenTestDB(t, "admin-pass")
+	defer cleanup()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte(`<html><body><ul>
+<li><a href="/a">Alpha</a> <small>2025-02-01</small><p>About <i>alpha</i>.</p></li>
+<li><a href="/b">Beta</a></li></ul></body></html>`))
+	}))
+	defer srv.Close()
+	cfg, _ := json.Marshal(scrape.Config{Item: "li", Title: "a", Date: "small", Summary: "p"})
+	srcID, err := db.CreateSource(context.Background(), database, db.CreateSourceParams{URL: srv.URL, Kind: db.SourceKindScrape, Config: string(cfg)})
+	if err != nil {
+		t.Fatalf("create source: %v", err)
+	}
+	for range 2 {
+		// a second pass over the same page updates rather than duplicates
+		makeDue(t, database, srcID)
+		if _, err := FetchAllSources(context.Background(), database, testutil.HTTPClient(t), Options{}); err != nil {
+			t.Fatalf("fetch: %v", err)
+		}
+	}
+	assertArticleCount(t, database, srcID, 2)
+	var url, summary, published string
+	if err := database.QueryRow("SELECT canonical_url, summary, published_at FROM article WHERE title = 'Alpha'").Scan(&url, &summary, &published); err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if url != srv.URL+"/a" || !strings.Contains(summary, "<i>alpha</i>") || !strings.HasPrefix(published, "2025-02-01") {
+		t.Fatalf("unexpected article: %s %q %s", url, summary, published)
+	}
+}
@@ -0,0 +1,133 @@
+package fetcher
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/fujidaiti/poppo-press/backend/internal/db"
+)
+
+// githubAdapter reads the releases or tags of a repository from the GitHub
+// REST API, such as https://api.github.com/repos/OWNER/REPO/releases.
+type githubAdapter struct{}
+
+// githubConfig selects which releases become articles.
+type githubConfig struct {
+	IncludePrereleases bool `json:"includePrereleases"` // keep releases marked as pre-releases
+}
+
+// githubRelease is the part of a release the adapter reads.
+type githubRelease struct {
+	ID          int64  `json:"id"`
+	TagName     string `json:"tag_name"`
+	Name        string `json:"name"`
+	HTMLURL     string `json:"html_url"`
+	Body        string `json:"body"`
+	Draft       bool   `json:"draft"`
+	Prerelease  bool   `json:"prerelease"`
+	PublishedAt string `json:"published_at"`
+	Author      struct {
+		Login string `json:"login"`
+	} `json:"author"`
+}
+
+// githubTag is the part of a tag the adapter reads.
+type githubTag struct {
+	Name   string `json:"name"`
+	Commit struct {
+		SHA string `json:"sha"`
+	} `json:"commit"`
+}
+
+// githubRepo splits an API URL into the repository path ("owner/repo") and
+// the listing it names ("releases" or "tags").
+func githubRepo(sourceURL string) (repo, listing string, err error) {
+	u, err := url.Parse(sourceURL)
+	if err != nil {
+		return "", "", err
+	}
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) != 4 || parts[0] != "repos" || (parts[3] != "releases" && parts[3] != "tags") {
+		return "", "", errors.New("github sources need a /repos/OWNER/REPO/releases or /tags URL")
+	}
+	return parts[1] + "/" + parts[2], parts[3], nil
+}
+
+// Validate implements SourceAdapter.
+func (githubAdapter) Validate(sourceURL string, config json.RawMessage) error {
+	var cfg githubConfig
+	if err := decodeConfig(config, &cfg); err != nil {
+		return err
+	}
+	_, _, err := githubRepo(sourceURL)
+	return err
+}
+
+// Request implements SourceAdapter.
+func (githubAdapter) Request(ctx context.Context, sourceURL string, _ json.RawMessage) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, sourceURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	return req, nil
+}
+
+// Parse implements SourceAdapter. Drafts are skipped; release notes become
+// the body. Tags carry no date or notes and link to their release page; being
+// undated, the tags a repository already has when the source is added are
+// kept out of editions (see aggregator.AssembleEdition).
+func (githubAdapter) Parse(body []byte, sourceURL string, config json.RawMessage) (AdapterResult, error) {
+	var cfg githubConfig
+	if err := decodeConfig(config, &cfg); err != nil {
+		return AdapterResult{}, err
+	}
+	repo, listing, err := githubRepo(sourceURL)
+	if err != nil {
+		return AdapterResult{}, err
+	}
+	out := AdapterResult{Title: repo + " " + listing}
+	if listing == "tags" {
+		var tags []githubTag
+		if err := json.Unmarshal(body, &tags); err != nil {
+			return AdapterResult{}, err
+		}
+		for _, t := range tags {
+			if t.Name == "" {
+				continue
+			}
+			out.Articles = append(out.Articles, db.UpsertArticleParams{
+				CanonicalURL: "https://github.com/" + repo + "/releases/tag/" + url.PathEscape(t.Name),
+				Title:        repo + " " + t.Name,
+				CanonicalID:  "github:" + repo + ":tag:" + t.Name,
+			})
+		}
+		return out, nil
+	}
+	var releases []githubRelease
+	if err := json.Unmarshal(body, &releases); err != nil {
+		return AdapterResult{}, err
+	}
+	for _, r := range releases {
+		if r.Draft || (r.Prerelease && !cfg.IncludePrereleases) || r.HTMLURL == "" {
+			continue
+		}
+		title := r.Name
+		if title == "" {
+			title = r.TagName
+		}
+		out.Articles = append(out.Articles, db.UpsertArticleParams{
+			CanonicalURL: r.HTMLURL,
+			Title:        repo + " " + title,
+			Content:      paragraphs(r.Body),
+			Author:       r.Author.Login,
+			PublishedAt:  rfc3339(r.PublishedAt),
+			CanonicalID:  "github:" + repo + ":release:" + r.TagName,
+		})
+	}
+	return out, nil
+}
@@ -0,0 +1,118 @@
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/fujidaiti/poppo-press/backend/internal/httpclient"
+)
+
+// Error classes recorded in a source's health so that broken feeds can be
+// grouped by cause.
+const (
+	ClassNetwork     = "network"
+	ClassTimeout     = "timeout"
+	ClassRateLimited = "rate_limited"
+	ClassUnavailable = "unavailable"
+	ClassHTTPStatus  = "http_status"
+	ClassGone        = "gone" // 410 Gone; the source is marked dead
+	ClassParse       = "parse"
+	ClassBlocked     = "blocked"     // destination refused by the private address guard
+	ClassContent     = "content"     // response too large or not a feed
+	ClassCredentials = "credentials" // stored credential cannot be opened with the server key
+	ClassStorage     = "storage"     // fetched, but storing what it yielded failed
+)
+
+// FetchError is a classified failure of a single source fetch.
+type FetchError struct {
+	Class      string
+	StatusCode int           // upstream HTTP status, when the failure was a response
+	RetryAfter time.Duration // upstream Retry-After hint, zero when absent
+	Err        error
+}
+
+func (e *FetchError) Error() string { return e.Class + ": " + e.Err.Error() }
+func (e *FetchError) Unwrap() error { return e.Err }
+
+// classify wraps err in a FetchError, inferring the class for transport
+// failures that were not already classified.
+func classify(err error) *FetchError {
+	var fe *FetchError
+	if errors.As(err, &fe) {
+		return fe
+	}
+	if errors.Is(err, httpclient.ErrForbiddenAddress) {
+		return &FetchError{Class: ClassBlocked, Err: err}
+	}
+	if errors.Is(err, httpclient.ErrBodyTooLarge) || errors.Is(err, httpclient.ErrContentType) {
+		return &FetchError{Class: ClassContent, Err: err}
+	}
+	var ne net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &ne) && ne.Timeout()) {
+		return &FetchError{Class: ClassTimeout, Err: err}
+	}
+	return &FetchError{Class: ClassNetwork, Err: err}
+}
+
+// statusError builds a FetchError for a non-success response, capturing the
+// Retry-After hint on 429 and 503.
+func statusError(resp *http.Response, now time.Time) *FetchError {
+	fe := &FetchError{Class: ClassHTTPStatus, StatusCode: resp.StatusCode, Err: errors.New("unexpected status " + strconv.Itoa(resp.StatusCode))}
+	switch resp.StatusCode {
+	case http.StatusGone:
+		fe.Class = ClassGone
+	case http.StatusTooManyRequests:
+		fe.Class = ClassRateLimited
+		fe.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), now)
+	case http.StatusServiceUnavailable:
+		fe.Class = ClassUnavailable
+		fe.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), now)
+	}
+	return fe
+}
+
+// parseRetryAfter interprets a Retry-After header given either as delay
+// seconds or as an HTTP date. It returns zero when absent or malformed.
+func parseRetryAfter(v string, now time.Time) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		if secs < 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
+
+// retryDelay returns how long to wait before fetching a source again after
+// its failures-th consecutive failure. An upstream Retry-After wins over the
+// computed backoff; both are capped at max.
+func retryDelay(fe *FetchError, failures int, base, max time.Duration) time.Duration {
+	if fe.RetryAfter > 0 {
+		return min(fe.RetryAfter, max)
+	}
+	return backoff(failures, base, max)
+}
+
+// backoff computes an exponential delay with equal jitter: half of the
+// exponential step is fixed and the other half is random, spreading retries
+// of sources that failed together.
+func backoff(failures int, base, max time.Duration) time.Duration {
+	d := base
+	for i := 1; i < failures && d < max; i++ {
+		d *= 2
+	}
+	d = min(d, max)
+	half := d / 2
+	return half + rand.N(half+1)
+}
@@ -0,0 +1,223 @@
+package fetcher
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/fujidaiti/poppo-press/backend/internal/credentials"
+	"github.com/fujidaiti/poppo-press/backend/internal/db"
+	"github.com/fujidaiti/poppo-press/backend/internal/testutil"
+)
+
+func TestFetchAllSources_RecordsHealthAndBacksOff(t *testing.T) {
+	database, cleanup := testutil.OpenTestDB(t, "admin-pass")
+	defer cleanup()
+
+	status := http.StatusServiceUnavailable
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if status != http.StatusOK {
+			w.Header().Set("Retry-After", "120")
+			w.WriteHeader(status)
+			return
+		}
+		w.Header().Set("Content-Type", "application/rss+xml")
+		_, _ = w.Write([]byte(`<?xml version="1.0"?><rss version="2.0"><channel><title>T</title></channel></rss>`))
+	}))
+	defer srv.Close()
+	srcID := insertSource(t, database, srv.URL)
+
+	// 503 with Retry-After: failure recorded and next attempt deferred by the hint
+	before := time.Now()
+	results, err := FetchAllSources(context.Background(), database, testutil.HTTPClient(t), Options{})
+	if err != nil {
+		t.Fatalf("fetch 1: %v", err)
+	}
+	if len(results) != 1 || results[0].Err == nil {
+		t.Fatalf("expected failed result, got %+v", results)
+	}
+	h := readHealth(t, database, srcID)
+	if h.failures != 1 || h.class != ClassUnavailable || h.lastSuccess.Valid {
+		t.Fatalf("unexpected health: %+v", h)
+	}
+	if d := h.next.Sub(before); d < 119*time.Second || d > 122*time.Second {
+		t.Fatalf("next fetch not deferred by Retry-After: %s", d)
+	}
+
+	// Still backing off: the source is skipped entirely
+	results, err = FetchAllSources(context.Background(), database, testutil.HTTPClient(t), Options{})
+	if err != nil {
+		t.Fatalf("fetch 2: %v", err)
+	}
+	if len(results) != 0 {
+		t.Fatalf("expected source to be skipped, got %+v", results)
+	}
+
+	// Once eligible again, a success clears the streak and schedules the next poll
+	mustExec(t, database, "UPDATE source_health SET next_fetch_at = ? WHERE source_id = ?", before.Add(-time.Minute).UTC().Format(time.RFC3339), srcID)
+	status = http.StatusOK
+	if _, err := FetchAllSources(context.Background(), database, testutil.HTTPClient(t), Options{}); err != nil {
+		t.Fatalf("fetch 3: %v", err)
+	}
+	h = readHealth(t, database, srcID)
+	if h.failures != 0 || h.class != "" || !h.lastSuccess.Valid || h.nextNull || !h.next.After(time.Now()) {
+		t.Fatalf("expected healthy source, got %+v", h)
+	}
+}
+
+func TestFetchAllSources_ClassifiesRefusedResponses(t *testing.T) {
+	database, cleanup := testutil.OpenTestDB(t, "admin-pass")
+	defer cleanup()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/image" {
+			w.Header().Set("Content-Type", "image/png")
+		}
+		_, _ = w.Write([]byte(`<?xml version="1.0"?><rss version="2.0"><channel><title>T</title></channel></rss>`))
+	}))
+	defer srv.Close()
+	imageID := insertSource(t, database, srv.URL+"/image")
+
+	// the default client refuses loopback destinations
+	if _, err := FetchAllSources(context.Background(), database, nil, Options{}); err != nil {
+		t.Fatalf("fetch 1: %v", err)
+	}
+	if h := readHealth(t, database, imageID); h.class != ClassBlocked {
+		t.Fatalf("expected blocked source, got %+v", h)
+	}
+
+	makeDue(t, database, imageID)
+	if _, err := FetchAllSources(context.Background(), database, testutil.HTTPClient(t), Options{}); err != nil {
+		t.Fatalf("fetch 2: %v", err)
+	}
+	if h := readHealth(t, database, imageID); h.class != ClassContent {
+		t.Fatalf("expected content failure, got %+v", h)
+	}
+}
+
+func TestFetchAllSources_RecordsStorageFailures(t *testing.T) {
+	database, cleanup := testutil.OpenTestDB(t, "admin-pass")
+	defer cleanup()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/rss+xml")
+		_, _ = w.Write([]byte(`<?xml version="1.0"?><rss version="2.0"><channel><title>T</title><item><guid>1</guid><title>One</title></item></channel></rss>`))
+	}))
+	defer srv.Close()
+	srcID := insertSource(t, database, srv.URL)
+	mustExec(t, database, "CREATE TRIGGER refuse_articles BEFORE INSERT ON article BEGIN SELECT RAISE(ABORT, 'disk full'); END")
+
+	results, err := FetchAllSources(context.Background(), database, testutil.HTTPClient(t), Options{})
+	if err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	if len(results) != 1 || classify(results[0].Err).Class != ClassStorage {
+		t.Fatalf("expected storage failure, got %+v", results)
+	}
+	if h := readHealth(t, database, srcID); h.failures != 1 || h.class != ClassStorage || h.lastSuccess.Valid || !h.next.After(time.Now()) {
+		t.Fatalf("expected the failure recorded and retried later, got %+v", h)
+	}
+}
+
+func TestFetchAllSources_AppliesCredentials(t *testing.T) {
+	database, cleanup := testutil.OpenTestDB(t, "admin-pass")
+	defer cleanup()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, _ := r.BasicAuth(); user != "me" || pass != "pw" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`<?xml version="1.0"?><rss version="2.0"><channel><title>T</title><item><guid>1</guid><title>Members only</title></item></channel></rss>`))
+	}))
+	defer srv.Close()
+	box, err := credentials.NewBox(base64.StdEncoding.EncodeToString(make([]byte, 32)))
+	if err != nil {
+		t.Fatalf("box: %v", err)
+	}
+	cred := credentials.Credential{Type: credentials.TypeBasic, Username: "me", Password: "pw"}
+	srcID, err := db.CreateSource(context.Background(), database, db.CreateSourceParams{
+		URL: srv.URL, AuthType: cred.Type,
+		SealCredential: func(id int64) ([]byte, error) { return box.Seal(id, cred) },
+	})
+	if err != nil {
+		t.Fatalf("create source: %v", err)
+	}
+
+	if _, err := FetchAllSources(context.Background(), database, testutil.HTTPClient(t), Options{}); err != nil {
+		t.Fatalf("fetch 1: %v", err)
+	}
+	if h := readHealth(t, database, srcID); h.class != ClassCredentials {
+		t.Fatalf("expected credentials failure without a key, got %+v", h)
+	}
+
+	makeDue(t, database, srcID)
+	if _, err := FetchAllSources(context.Background(), database, testutil.HTTPClient(t), Options{Credentials: box}); err != nil {
+		t.Fatalf("fetch 2: %v", err)
+	}
+	if h := readHealth(t, database, srcID); h.class != "" || !h.lastSuccess.Valid {
+		t.Fatalf("expected authenticated fetch to succeed, got %+v", h)
+	}
+	assertArticleCount(t, database, srcID, 1)
+}
+
+func TestBackoff_GrowsAndIsCapped(t *testing.T) {
+	base, maxDelay := time.Minute, time.Hour
+	for failures, want := range map[int]time.Duration{1: time.Minute, 3: 4 * time.Minute, 20: time.Hour} {
+		got := backoff(failures, base, maxDelay)
+		if got < want/2 || got > want {
+			t.Fatalf("backoff(%d) = %s, want within [%s, %s]", failures, got, want/2, want)
+		}
+	}
+	fe := &FetchError{Class: ClassRateLimited, RetryAfter: 3 * time.Hour}
+	if got := retryDelay(fe, 1, base, maxDelay); got != maxDelay {
+		t.Fatalf("Retry-After should be capped at max, got %s", got)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	if got := parseRetryAfter("30", now); got != 30*time.Second {
+		t.Fatalf("seconds: %s", got)
+	}
+	if got := parseRetryAfter(now.Add(time.Hour).Format(http.TimeFormat), now); got != time.Hour {
+		t.Fatalf("http date: %s", got)
+	}
+	if got := parseRetryAfter("soon", now); got != 0 {
+		t.Fatalf("malformed: %s", got)
+	}
+}
+
+type healthRow struct {
+	failures    int
+	class       string
+	lastSuccess sql.NullString
+	next        time.Time
+	nextNull    bool
+}
+
+func readHealth(t *testing.T, database *sql.DB, sourceID int64) healthRow {
+	t.Helper()
+	var h healthRow
+	var class, next sql.NullString
+	if err := database.QueryRow("SELECT consecutive_failures, last_error_class, last_success_at, next_fetch_at FROM source_health WHERE source_id = ?", sourceID).Scan(&h.failures, &class, &h.lastSuccess, &next); err != nil {
+		t.Fatalf("health: %v", err)
+	}
+	h.class = class.String
+	h.nextNull = !next.Valid
+	if next.Valid {
+		h.next, _ = time.Parse(time.RFC3339, next.String)
+	}
+	return h
+}
+
+func mustExec(t *testing.T, database *sql.DB, q string, args ...any) {
+	t.Helper()
+	if _, err := database.Exec(q, args...); err != nil {
+		t.Fatalf("exec: %v", err)
+	}
+}
@@ -0,0 +1,97 @@
+package fetcher
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+
+	"github.com/fujidaiti/poppo-press/backend/internal/db"
+)
+
+// hnItemURL is the discussion page of a Hacker News item.
+const hnItemURL = "https://news.ycombinator.com/item?id="
+
+// hnAdapter reads Hacker News stories from an Algolia-style search API, such
+// as https://hn.algolia.com/api/v1/search?tags=front_page.
+type hnAdapter struct{}
+
+// hnConfig selects which stories become articles.
+type hnConfig struct {
+	MinPoints int `json:"minPoints"` // skip stories with fewer points
+}
+
+// hnResponse is the part of a search response the adapter reads.
+type hnResponse struct {
+	Hits []struct {
+		ObjectID  string `json:"objectID"`
+		Title     string `json:"title"`
+		URL       string `json:"url"`
+		Author    string `json:"author"`
+		CreatedAt string `json:"created_at"`
+		Points    int    `json:"points"`
+		StoryText string `json:"story_text"`
+	} `json:"hits"`
+	Query string `json:"query"`
+}
+
+// Validate implements SourceAdapter.
+func (hnAdapter) Validate(sourceURL string, config json.RawMessage) error {
+	var cfg hnConfig
+	if err := decodeConfig(config, &cfg); err != nil {
+		return err
+	}
+	if cfg.MinPoints < 0 {
+		return errors.New("minPoints must not be negative")
+	}
+	return nil
+}
+
+// Request implements SourceAdapter.
+func (hnAdapter) Request(ctx context.Context, sourceURL string, _ json.RawMessage) (*http.Request, error) {
+	return http.NewRequestWithContext(ctx, http.MethodGet, sourceURL, nil)
+}
+
+// Parse implements SourceAdapter. Stories link to their URL, or to their
+// discussion when they have none (Ask HN); the summary links the discussion.
+// Points and comment counts are left out: they change on every poll and
+// would record each one as an edit of the story.
+func (hnAdapter) Parse(body []byte, sourceURL string, config json.RawMessage) (AdapterResult, error) {
+	var cfg hnConfig
+	if err := decodeConfig(config, &cfg); err != nil {
+		return AdapterResult{}, err
+	}
+	var resp hnResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return AdapterResult{}, err
+	}
+	out := AdapterResult{Title: "Hacker News"}
+	if u, err := url.Parse(sourceURL); err == nil {
+		if tags := u.Query().Get("tags"); tags != "" {
+			out.Title += ": " + tags
+		}
+	}
+	for _, h := range resp.Hits {
+		if h.ObjectID == "" || h.Title == "" || h.Points < cfg.MinPoints {
+			continue
+		}
+		discussion := hnItemURL + h.ObjectID
+		link := h.URL
+		if link == "" {
+			link = discussion
+		}
+		out.Articles = append(out.Articles, db.UpsertArticleParams{
+			CanonicalURL: link,
+			Title:        h.Title,
+			Summary:      fmt.Sprintf(`<p><a href="%s">Comments</a></p>`, html.EscapeString(discussion)),
+			Content:      h.StoryText,
+			Author:       h.Author,
+			PublishedAt:  rfc3339(h.CreatedAt),
+			CanonicalID:  "hn:" + h.ObjectID,
+		})
+	}
+	return out, nil
+}
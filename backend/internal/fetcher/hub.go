@@ -0,0 +1,116 @@
+package fetcher
+
+import (
+	"bytes"
+	"encoding/xml"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// hubLinks returns the WebSub hub and self (topic) URLs a feed advertises,
+// either in HTTP Link headers or as <link rel="hub|self"> / <atom:link>
+// elements at feed level. Header values take precedence.
+func hubLinks(h http.Header, body []byte) (hub, self string) {
+	links := feedLinks(h, body, "hub", "self")
+	return links["hub"], links["self"]
+}
+
+// archiveLink returns the URL of the older document of a feed that pages its
+// history (RFC 5005): the prev-archive link of an archived feed, else the
+// next link of a paged feed, resolved against base. It returns "" when the
+// feed has neither.
+func archiveLink(h http.Header, body []byte, base *url.URL) string {
+	links := feedLinks(h, body, "prev-archive", "next")
+	ref := links["prev-archive"]
+	if ref == "" {
+		ref = links["next"]
+	}
+	if ref == "" {
+		return ""
+	}
+	u, err := base.Parse(ref)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return ""
+	}
+	return u.String()
+}
+
+// feedLinks returns the first URL advertised for each of rels, either in
+// HTTP Link headers or as <link> / <atom:link> elements at feed level.
+// Header values take precedence.
+func feedLinks(h http.Header, body []byte, rels ...string) map[string]string {
+	links := make(map[string]string, len(rels))
+	add := func(rel, href string) {
+		for _, want := range rels {
+			if _, ok := links[want]; !ok && hasRel(rel, want) {
+				links[want] = href
+			}
+		}
+	}
+	for _, v := range h.Values("Link") {
+		for _, part := range strings.Split(v, ",") {
+			if target, rel := parseLinkValue(part); target != "" {
+				add(rel, target)
+			}
+		}
+	}
+	d := xml.NewDecoder(bytes.NewReader(body))
+	d.Strict = false
+	for len(links) < len(rels) {
+		tok, err := d.Token()
+		if err != nil {
+			break
+		}
+		se, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if se.Name.Local == "item" || se.Name.Local == "entry" {
+			break // only feed-level links count
+		}
+		if se.Name.Local != "link" {
+			continue
+		}
+		var rel, href string
+		for _, a := range se.Attr {
+			switch a.Name.Local {
+			case "rel":
+				rel = a.Value
+			case "href":
+				href = strings.TrimSpace(a.Value)
+			}
+		}
+		if href != "" {
+			add(rel, href)
+		}
+	}
+	return links
+}
+
+// parseLinkValue splits one RFC 8288 link-value into its target and rel.
+func parseLinkValue(v string) (url, rel string) {
+	v = strings.TrimSpace(v)
+	end := strings.Index(v, ">")
+	if !strings.HasPrefix(v, "<") || end < 0 {
+		return "", ""
+	}
+	url = strings.TrimSpace(v[1:end])
+	for _, p := range strings.Split(v[end+1:], ";") {
+		k, val, ok := strings.Cut(strings.TrimSpace(p), "=")
+		if ok && strings.EqualFold(strings.TrimSpace(k), "rel") {
+			rel = strings.Trim(strings.TrimSpace(val), `"`)
+		}
+	}
+	return url, rel
+}
+
+// hasRel reports whether a space-separated rel list contains want.
+func hasRel(rel, want string) bool {
+	for _, r := range strings.Fields(rel) {
+		if strings.EqualFold(r, want) {
+			return true
+		}
+	}
+	return false
+}
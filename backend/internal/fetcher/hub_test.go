@@ -0,0 +1,25 @@
+package fetcher
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestHubLinks(t *testing.T) {
+	rss := []byte(`<?xml version="1.0"?><rss version="2.0" xmlns:atom="http://www.w3.org/2005/Atom"><channel><title>T</title>
+<atom:link rel="hub" href="https://hub.example/"/><atom:link rel="self" type="application/rss+xml" href="https://ex/feed"/>
+<item><atom:link rel="hub" href="https://ignored/"/></item></channel></rss>`)
+	if hub, self := hubLinks(http.Header{}, rss); hub != "https://hub.example/" || self != "https://ex/feed" {
+		t.Fatalf("xml links: %q %q", hub, self)
+	}
+
+	h := http.Header{}
+	h.Add("Link", `<https://hub.header/>; rel="hub", <https://ex/canonical>; rel="self"`)
+	if hub, self := hubLinks(h, rss); hub != "https://hub.header/" || self != "https://ex/canonical" {
+		t.Fatalf("header links: %q %q", hub, self)
+	}
+
+	if hub, _ := hubLinks(http.Header{}, []byte(`<rss><channel><item><link>https://ex/a</link></item></channel></rss>`)); hub != "" {
+		t.Fatalf("unexpected hub %q", hub)
+	}
+}
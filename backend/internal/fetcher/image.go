@@ -0,0 +1,75 @@
+package fetcher
+
+import (
+	"github.com/mmcdole/gofeed"
+	ext "github.com/mmcdole/gofeed/extensions"
+
+	"github.com/fujidaiti/poppo-press/backend/internal/db"
+	"github.com/fujidaiti/poppo-press/backend/internal/normalize"
+)
+
+// leadImage chooses the representative image of an item, preferring images
+// the publisher designated over ones found in the text: media:thumbnail,
+// then image enclosures (including Media RSS image content), the iTunes
+// episode image, the first real image of the sanitized body and summary,
+// and finally the image gofeed derived. Tracking pixels and non-http(s)
+// URLs are never chosen. It returns "" when the item has no image.
+func leadImage(item *gofeed.Item, encs []db.Enclosure, content, summary string) string {
+	for _, t := range mediaThumbnails(item.Extensions) {
+		if u := normalize.ImageURL(t.Attrs["url"], item.Link); u != "" {
+			return u
+		}
+	}
+	for _, e := range encs {
+		if e.Kind == db.MediaImage {
+			if u := normalize.ImageURL(e.URL, item.Link); u != "" {
+				return u
+			}
+		}
+	}
+	if item.ITunesExt != nil {
+		if u := normalize.ImageURL(item.ITunesExt.Image, item.Link); u != "" {
+			return u
+		}
+	}
+	if u := normalize.FirstImage(content, item.Link); u != "" {
+		return u
+	}
+	if u := normalize.FirstImage(summary, item.Link); u != "" {
+		return u
+	}
+	if item.Image != nil {
+		return normalize.ImageURL(item.Image.URL, item.Link)
+	}
+	return ""
+}
+
+// feedImage returns the logo or artwork a feed declares for itself, or "".
+func feedImage(feed *gofeed.Feed) string {
+	if feed.Image != nil {
+		if u := normalize.ImageURL(feed.Image.URL, feed.Link); u != "" {
+			return u
+		}
+	}
+	if feed.ITunesExt != nil {
+		return normalize.ImageURL(feed.ITunesExt.Image, feed.Link)
+	}
+	return ""
+}
+
+// mediaThumbnails returns the media:thumbnail elements of an item, whether
+// attached to the item, a media:group, or a media:content.
+func mediaThumbnails(exts ext.Extensions) []ext.Extension {
+	media := exts["media"]
+	if media == nil {
+		return nil
+	}
+	out := append([]ext.Extension(nil), media["thumbnail"]...)
+	for _, g := range media["group"] {
+		out = append(out, g.Children["thumbnail"]...)
+	}
+	for _, c := range mediaContents(exts) {
+		out = append(out, c.Children["thumbnail"]...)
+	}
+	return out
+}
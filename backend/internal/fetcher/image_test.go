@@ -0,0 +1,54 @@
+package fetcher
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/fujidaiti/poppo-press/backend/internal/testutil"
+)
+
+func TestFetchAllSources_ChoosesLeadImages(t *testing.T) {
+	database, cleanup := testutil.OpenTestDB(t, "admin-pass")
+	defer cleanup()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/rss+xml")
+		fmt.Fprint(w, `<?xml version="1.0"?>
+<rss version="2.0" xmlns:media="http://search.yahoo.com/mrss/"><channel><title>Pics</title><link>https://ex/</link>
+<image><url>https://ex/logo.png</url><title>Pics</title><link>https://ex/</link></image>
+<item><guid>thumb</guid><title>Thumb</title><link>https://ex/thumb</link>
+  <description><![CDATA[<p><img src="/inline.jpg"></p>]]></description>
+  <media:thumbnail url="https://cdn.ex/thumb.jpg"/>
+</item>
+<item><guid>inline</guid><title>Inline</title><link>https://ex/inline</link>
+  <description><![CDATA[<p><img src="https://ex/pixel.gif"><img src="/photo.jpg" width="640"></p>]]></description>
+</item>
+<item><guid>none</guid><title>None</title><link>https://ex/none</link>
+  <description><![CDATA[<p>Text <img src="/open.gif" width="1" height="1"></p>]]></description>
+</item>
+</channel></rss>`)
+	}))
+	defer srv.Close()
+	srcID := insertSource(t, database, srv.URL)
+
+	if _, err := FetchAllSources(context.Background(), database, testutil.HTTPClient(t), Options{}); err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	for guid, want := range map[string]string{"thumb": "https://cdn.ex/thumb.jpg", "inline": "https://ex/photo.jpg", "none": ""} {
+		var got sql.NullString
+		if err := database.QueryRow("SELECT image_url FROM article WHERE canonical_id = ?", guid).Scan(&got); err != nil {
+			t.Fatalf("query %s: %v", guid, err)
+		}
+		if got.String != want {
+			t.Errorf("%s: image %q, want %q", guid, got.String, want)
+		}
+	}
+	var logo string
+	if err := database.QueryRow("SELECT IFNULL(image_url, '') FROM source WHERE id = ?", srcID).Scan(&logo); err != nil || logo != "https://ex/logo.png" {
+		t.Fatalf("source image: %q %v", logo, err)
+	}
+}
@@ -0,0 +1,114 @@
+package fetcher
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/mmcdole/gofeed"
+
+	"github.com/fujidaiti/poppo-press/backend/internal/db"
+	"github.com/fujidaiti/poppo-press/backend/internal/normalize"
+)
+
+// maxResolvePerFetch bounds how many feed-proxy links a single source fetch
+// may follow.
+const maxResolvePerFetch = 10
+
+// linkedPage is what was learned by visiting an item's link.
+type linkedPage struct {
+	body string // main content extracted from the page; "" when not extracted
+	url  string // where the link really points; "" when unknown
+}
+
+// articleURL returns the canonical URL stored for an item: the resolved page
+// URL when known, else FeedBurner's original link, else the item link, all
+// passed through normalize.CanonicalURL.
+func articleURL(item *gofeed.Item, page linkedPage) string {
+	link := page.url
+	if link == "" {
+		link = origLink(item)
+	}
+	if link == "" {
+		link = item.Link
+	}
+	return normalize.CanonicalURL(link)
+}
+
+// provisionalURL reports whether the URL articleURL returns for an item is
+// only its feed proxy link, not resolved on this fetch; see
+// db.UpsertArticleParams.ProvisionalURL.
+func provisionalURL(item *gofeed.Item, page linkedPage) bool {
+	return page.url == "" && origLink(item) == "" && normalize.IsFeedProxy(item.Link)
+}
+
+// origLink returns the feedburner:origLink of an item, which FeedBurner adds
+// next to its proxied link.
+func origLink(item *gofeed.Item) string {
+	for _, e := range item.Extensions["feedburner"]["origLink"] {
+		if v := strings.TrimSpace(e.Value); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// resolveProxyLinks follows the links of new items that point at a feed
+// proxy and lack an original link, recording the final URL in pages (which
+// may be nil). Items already stored are skipped since their URL is kept.
+func resolveProxyLinks(ctx context.Context, database *sql.DB, client *http.Client, sourceID int64, feed *gofeed.Feed, pages map[int]linkedPage) map[int]linkedPage {
+	resolved := 0
+	for i, item := range feed.Items {
+		if resolved >= maxResolvePerFetch || ctx.Err() != nil {
+			break
+		}
+		if pages[i].url != "" || origLink(item) != "" || !normalize.IsFeedProxy(item.Link) {
+			continue
+		}
+		exists, err := db.ArticleExists(ctx, database, sourceID, itemCanonicalID(item))
+		if err != nil || exists {
+			continue
+		}
+		resolved++
+		final, err := followLink(ctx, client, item.Link)
+		if err != nil {
+			continue
+		}
+		if pages == nil {
+			pages = map[int]linkedPage{}
+		}
+		p := pages[i]
+		p.url = final
+		pages[i] = p
+	}
+	return pages
+}
+
+// followLink issues a HEAD request and returns the URL the redirects end at.
+func followLink(ctx context.Context, client *http.Client, link string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, link, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	_ = resp.Body.Close()
+	return resp.Request.URL.String(), nil
+}
+
+// pageCanonical returns the canonical URL of a downloaded page: its
+// rel=canonical link resolved against the final URL, or the final URL
+// itself. A canonical link to the site root is ignored, as sites that
+// template it badly point every page there.
+func pageCanonical(final *url.URL, rel string) string {
+	if rel != "" {
+		if u, err := final.Parse(rel); err == nil && (u.Scheme == "http" || u.Scheme == "https") && strings.Trim(u.Path, "/") != "" {
+			return u.String()
+		}
+	}
+	return final.String()
+}
@@ -0,0 +1,67 @@
+package fetcher
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/fujidaiti/poppo-press/backend/internal/testutil"
+)
+
+func TestFetchAllSources_CanonicalizesArticleURLs(t *testing.T) {
+	database, cleanup := testutil.OpenTestDB(t, "admin-pass")
+	defer cleanup()
+
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Host == "feedproxy.google.com" {
+			http.Redirect(w, r, srv.URL+"/proxied?utm_source=feedburner", http.StatusMovedPermanently)
+			return
+		}
+		if r.URL.Path != "/feed" {
+			return
+		}
+		w.Header().Set("Content-Type", "application/rss+xml")
+		fmt.Fprint(w, `<?xml version="1.0"?>
+<rss version="2.0" xmlns:feedburner="http://rssnamespace.org/feedburner/ext/1.0"><channel><title>Links</title>
+<item><guid>tracked</guid><title>Tracked</title><link>HTTPS://Ex.org/post?utm_source=rss&amp;id=7#more</link></item>
+<item><guid>orig</guid><title>Orig</title><link>http://feedproxy.google.com/~r/ex/~3/orig/</link>
+  <feedburner:origLink>https://ex.org/orig?fbclid=abc</feedburner:origLink></item>
+<item><guid>proxied</guid><title>Proxied</title><link>http://feedproxy.google.com/~r/ex/~3/proxied/</link></item>
+</channel></rss>`)
+	}))
+	defer srv.Close()
+	// route every host to the test server so the feed proxy can be followed
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, srv.Listener.Addr().String())
+		},
+	}}
+	id := insertSource(t, database, srv.URL+"/feed")
+
+	for pass := 1; pass <= 2; pass++ {
+		makeDue(t, database, id)
+		if _, err := FetchAllSources(context.Background(), database, client, Options{}); err != nil {
+			t.Fatalf("fetch: %v", err)
+		}
+		for guid, want := range map[string]string{
+			"tracked": "https://ex.org/post?id=7",
+			"orig":    "https://ex.org/orig",
+			// proxy links of known articles are not followed again
+			"proxied": srv.URL + "/proxied",
+		} {
+			var got string
+			if err := database.QueryRow("SELECT canonical_url FROM article WHERE canonical_id = ?", guid).Scan(&got); err != nil {
+				t.Fatalf("query %s: %v", guid, err)
+			}
+			if got != want {
+				t.Errorf("pass %d, %s: url %q, want %q", pass, guid, got, want)
+			}
+		}
+		// as stored before URLs were canonicalized
+		mustExec(t, database, "UPDATE article SET canonical_url = 'HTTPS://Ex.org/post?utm_source=rss&id=7#more' WHERE canonical_id = 'tracked'")
+	}
+}
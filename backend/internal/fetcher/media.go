@@ -0,0 +1,140 @@
+package fetcher
+
+import (
+	"mime"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/mmcdole/gofeed"
+	ext "github.com/mmcdole/gofeed/extensions"
+
+	"github.com/fujidaiti/poppo-press/backend/internal/db"
+)
+
+// extKinds maps file extensions to media kinds for enclosures whose MIME type
+// is missing or generic.
+var extKinds = map[string]string{
+	".mp3": db.MediaAudio, ".m4a": db.MediaAudio, ".aac": db.MediaAudio, ".ogg": db.MediaAudio,
+	".oga": db.MediaAudio, ".opus": db.MediaAudio, ".wav": db.MediaAudio, ".flac": db.MediaAudio,
+	".mp4": db.MediaVideo, ".m4v": db.MediaVideo, ".mov": db.MediaVideo, ".webm": db.MediaVideo,
+	".mkv": db.MediaVideo,
+	".jpg": db.MediaImage, ".jpeg": db.MediaImage, ".png": db.MediaImage, ".gif": db.MediaImage,
+	".webp": db.MediaImage,
+}
+
+// itemEnclosures collects the media attached to a feed item: RSS/Atom
+// enclosures and JSON Feed attachments first, then Media RSS content
+// (including content inside media:group). URLs are resolved against the item
+// link and deduplicated; only http(s) URLs are kept. The iTunes duration
+// applies to audio and video entries that state none of their own.
+func itemEnclosures(item *gofeed.Item) []db.Enclosure {
+	var out []db.Enclosure
+	seen := map[string]bool{}
+	add := func(rawURL, mimeType, length, duration, medium string) {
+		u := resolveMediaURL(item.Link, rawURL)
+		if u == "" || seen[u] {
+			return
+		}
+		seen[u] = true
+		n, _ := strconv.ParseInt(strings.TrimSpace(length), 10, 64)
+		out = append(out, db.Enclosure{
+			URL:      u,
+			MIMEType: strings.TrimSpace(mimeType),
+			Length:   max(n, 0),
+			Duration: parseDuration(duration),
+			Kind:     mediaKind(mimeType, u, medium),
+		})
+	}
+	for _, e := range item.Enclosures {
+		add(e.URL, e.Type, e.Length, "", "")
+	}
+	for _, c := range mediaContents(item.Extensions) {
+		add(c.Attrs["url"], c.Attrs["type"], c.Attrs["fileSize"], c.Attrs["duration"], c.Attrs["medium"])
+	}
+	if item.ITunesExt != nil {
+		if d := parseDuration(item.ITunesExt.Duration); d > 0 {
+			for i := range out {
+				if out[i].Duration == 0 && (out[i].Kind == db.MediaAudio || out[i].Kind == db.MediaVideo) {
+					out[i].Duration = d
+				}
+			}
+		}
+	}
+	return out
+}
+
+// mediaContents returns the media:content elements of an item, including
+// those grouped under media:group.
+func mediaContents(exts ext.Extensions) []ext.Extension {
+	media := exts["media"]
+	if media == nil {
+		return nil
+	}
+	out := append([]ext.Extension(nil), media["content"]...)
+	for _, g := range media["group"] {
+		out = append(out, g.Children["content"]...)
+	}
+	return out
+}
+
+// resolveMediaURL makes ref absolute against the item link and returns it
+// when it is an http(s) URL, or "" otherwise.
+func resolveMediaURL(base, ref string) string {
+	r, err := url.Parse(strings.TrimSpace(ref))
+	if err != nil || ref == "" {
+		return ""
+	}
+	if b, err := url.Parse(base); err == nil {
+		r = b.ResolveReference(r)
+	}
+	if r.Scheme != "http" && r.Scheme != "https" {
+		return ""
+	}
+	return r.String()
+}
+
+// mediaKind classifies an enclosure by its Media RSS medium, then its MIME
+// type, then its file extension.
+func mediaKind(mimeType, rawURL, medium string) string {
+	switch medium {
+	case db.MediaAudio, db.MediaVideo, db.MediaImage:
+		return medium
+	}
+	if mt, _, err := mime.ParseMediaType(mimeType); err == nil {
+		major, _, _ := strings.Cut(mt, "/")
+		switch major {
+		case db.MediaAudio, db.MediaVideo, db.MediaImage:
+			return major
+		}
+	}
+	if u, err := url.Parse(rawURL); err == nil {
+		if k, ok := extKinds[strings.ToLower(path.Ext(u.Path))]; ok {
+			return k
+		}
+	}
+	return db.MediaOther
+}
+
+// parseDuration reads a duration given in seconds ("3600", "3600.5") or as
+// "MM:SS" / "HH:MM:SS", returning whole seconds or 0 when malformed.
+func parseDuration(s string) int64 {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0
+	}
+	parts := strings.Split(s, ":")
+	if len(parts) > 3 {
+		return 0
+	}
+	var total float64
+	for _, part := range parts {
+		v, err := strconv.ParseFloat(part, 64)
+		if err != nil || v < 0 {
+			return 0
+		}
+		total = total*60 + v
+	}
+	return int64(total)
+}
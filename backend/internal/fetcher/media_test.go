@@ -0,0 +1,67 @@
+package fetcher
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/fujidaiti/poppo-press/backend/internal/db"
+	"github.com/fujidaiti/poppo-press/backend/internal/testutil"
+)
+
+func TestFetchAllSources_StoresEnclosures(t *testing.T) {
+	database, cleanup := testutil.OpenTestDB(t, "admin-pass")
+	defer cleanup()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/rss+xml")
+		fmt.Fprint(w, `<?xml version="1.0"?>
+<rss version="2.0" xmlns:itunes="http://www.itunes.com/dtds/podcast-1.0.dtd" xmlns:media="http://search.yahoo.com/mrss/"><channel><title>Cast</title>
+<item><guid>ep-1</guid><title>Episode 1</title><link>https://ex/ep1</link>
+  <enclosure url="/audio/ep1.mp3" length="12345" type="audio/mpeg"/>
+  <itunes:duration>1:02:03</itunes:duration>
+</item>
+<item><guid>clip-1</guid><title>Clip</title><link>https://ex/clip</link>
+  <media:group>
+    <media:content url="https://cdn.ex/clip.webm" duration="90"/>
+    <media:content url="javascript:alert(1)" type="video/mp4"/>
+  </media:group>
+</item>
+</channel></rss>`)
+	}))
+	defer srv.Close()
+	insertSource(t, database, srv.URL)
+
+	if _, err := FetchAllSources(context.Background(), database, testutil.HTTPClient(t), Options{}); err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	var ep, clip int64
+	_ = database.QueryRow("SELECT id FROM article WHERE canonical_id = 'ep-1'").Scan(&ep)
+	_ = database.QueryRow("SELECT id FROM article WHERE canonical_id = 'clip-1'").Scan(&clip)
+	// listings ask for every article; more ids than SQLite binds at once
+	ids := make([]int64, 0, 40002)
+	for i := range int64(40000) {
+		ids = append(ids, 1_000_000+i)
+	}
+	encs, err := db.ListEnclosures(context.Background(), database, append(ids, ep, clip))
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	want := db.Enclosure{URL: "https://ex/audio/ep1.mp3", MIMEType: "audio/mpeg", Length: 12345, Duration: 3723, Kind: db.MediaAudio}
+	if len(encs[ep]) != 1 || encs[ep][0] != want {
+		t.Fatalf("episode enclosures: %+v", encs[ep])
+	}
+	if len(encs[clip]) != 1 || encs[clip][0].Kind != db.MediaVideo || encs[clip][0].Duration != 90 {
+		t.Fatalf("clip enclosures: %+v", encs[clip])
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	for in, want := range map[string]int64{"": 0, "3600": 3600, "90.7": 90, "12:34": 754, "1:02:03": 3723, "1:2:3:4": 0, "abc": 0} {
+		if got := parseDuration(in); got != want {
+			t.Errorf("parseDuration(%q) = %d, want %d", in, got, want)
+		}
+	}
+}
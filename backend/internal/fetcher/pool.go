@@ -0,0 +1,230 @@
+package fetcher
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fujidaiti/poppo-press/backend/internal/config"
+	"github.com/fujidaiti/poppo-press/backend/internal/credentials"
+	"github.com/fujidaiti/poppo-press/backend/internal/db"
+)
+
+// Options tunes how a fetch run spreads work across sources. Zero values fall
+// back to the defaults below.
+type Options struct {
+	Workers       int           // number of sources fetched concurrently
+	PerHost       int           // max concurrent fetches against a single host
+	SourceTimeout time.Duration // deadline for one source, independent of the run deadline
+	BackoffBase   time.Duration // delay after the first consecutive failure
+	BackoffMax    time.Duration // upper bound for backoff and Retry-After delays
+
+	// Polling intervals: DefaultInterval applies when neither the user nor
+	// the feed specifies one; every interval is clamped to [MinInterval,
+	// MaxInterval].
+	DefaultInterval time.Duration
+	MinInterval     time.Duration
+	MaxInterval     time.Duration
+
+	// RedirectThreshold is the number of consecutive fetches permanently
+	// redirected to the same URL after which the source URL is rewritten.
+	RedirectThreshold int
+
+	// Credentials opens the sealed credentials of sources that require
+	// authentication; such sources fail with ClassCredentials when nil.
+	Credentials *credentials.Box
+
+	// Backfill bounds how far Backfill walks a feed's archives: at most
+	// BackfillPages older documents (negative: none), stopping at the first
+	// one whose items are all older than BackfillMaxAge (0: no limit).
+	BackfillPages  int
+	BackfillMaxAge time.Duration
+}
+
+// FromConfig returns the fetch options set in cfg, opening source
+// credentials with box.
+func FromConfig(cfg config.Config, box *credentials.Box) Options {
+	return Options{
+		Workers:           cfg.FetchWorkers,
+		PerHost:           cfg.FetchPerHost,
+		SourceTimeout:     cfg.FetchSourceTimeout,
+		BackoffBase:       cfg.FetchBackoffBase,
+		BackoffMax:        cfg.FetchBackoffMax,
+		DefaultInterval:   cfg.FetchInterval,
+		MinInterval:       cfg.FetchIntervalMin,
+		MaxInterval:       cfg.FetchIntervalMax,
+		RedirectThreshold: cfg.FetchRedirects,
+		Credentials:       box,
+		BackfillPages:     cfg.BackfillPages,
+		BackfillMaxAge:    cfg.BackfillMaxAge,
+	}
+}
+
+const (
+	defaultWorkers       = 8
+	defaultPerHost       = 2
+	defaultSourceTimeout = 20 * time.Second
+	defaultBackoffBase   = 10 * time.Minute
+	defaultBackoffMax    = 24 * time.Hour
+	defaultInterval      = time.Hour
+	defaultMinInterval   = 15 * time.Minute
+	defaultMaxInterval   = 24 * time.Hour
+	defaultRedirects     = 3
+	defaultBackfillPages = 10
+)
+
+// withDefaults returns a copy of o with unset fields replaced by defaults.
+func (o Options) withDefaults() Options {
+	if o.Workers <= 0 {
+		o.Workers = defaultWorkers
+	}
+	if o.PerHost <= 0 {
+		o.PerHost = defaultPerHost
+	}
+	if o.SourceTimeout <= 0 {
+		o.SourceTimeout = defaultSourceTimeout
+	}
+	if o.BackoffBase <= 0 {
+		o.BackoffBase = defaultBackoffBase
+	}
+	if o.BackoffMax <= 0 {
+		o.BackoffMax = defaultBackoffMax
+	}
+	if o.DefaultInterval <= 0 {
+		o.DefaultInterval = defaultInterval
+	}
+	if o.MinInterval <= 0 {
+		o.MinInterval = defaultMinInterval
+	}
+	if o.MaxInterval <= 0 {
+		o.MaxInterval = defaultMaxInterval
+	}
+	if o.RedirectThreshold <= 0 {
+		o.RedirectThreshold = defaultRedirects
+	}
+	if o.BackfillPages == 0 {
+		o.BackfillPages = defaultBackfillPages
+	}
+	return o
+}
+
+// fetchFunc performs the network part of fetching one source.
+type fetchFunc func(ctx context.Context, s db.SourceFetchRow) (*fetchOutcome, error)
+
+// deliverFunc receives the outcome for the source at index i. It is invoked
+// from a single goroutine in ascending index order.
+type deliverFunc func(i int, out *fetchOutcome, err error)
+
+// run fetches sources on a bounded worker pool, honoring per-host limits and
+// per-source timeouts, and hands outcomes to deliver in source order. It
+// returns once every source has been delivered. Sources that cannot start
+// before ctx ends are delivered with ctx's error.
+func run(ctx context.Context, sources []db.SourceFetchRow, opts Options, fetch fetchFunc, deliver deliverFunc) {
+	type indexed struct {
+		i   int
+		out *fetchOutcome
+		err error
+	}
+	jobs := make(chan int)
+	done := make(chan indexed)
+	hosts := newHostLimiter(opts.PerHost)
+
+	workers := min(opts.Workers, len(sources))
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				out, err := fetchOne(ctx, hosts, opts.SourceTimeout, sources[i], fetch)
+				done <- indexed{i: i, out: out, err: err}
+			}
+		}()
+	}
+	go func() {
+		for i := range sources {
+			jobs <- i
+		}
+		close(jobs)
+		wg.Wait()
+		close(done)
+	}()
+
+	// Buffer out-of-order completions and release them in index order.
+	pending := make(map[int]indexed)
+	next := 0
+	for r := range done {
+		pending[r.i] = r
+		for {
+			p, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			deliver(p.i, p.out, p.err)
+			next++
+		}
+	}
+}
+
+// fetchOne waits for a slot on the source's host and fetches it under its
+// own timeout.
+func fetchOne(ctx context.Context, hosts *hostLimiter, timeout time.Duration, s db.SourceFetchRow, fetch fetchFunc) (*fetchOutcome, error) {
+	host := hostOf(s.URL)
+	if err := hosts.acquire(ctx, host); err != nil {
+		return nil, err
+	}
+	defer hosts.release(host)
+	sctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return fetch(sctx, s)
+}
+
+// hostLimiter caps the number of in-flight requests per host.
+type hostLimiter struct {
+	mu    sync.Mutex
+	limit int
+	sems  map[string]chan struct{}
+}
+
+// newHostLimiter returns a limiter allowing limit concurrent requests per host.
+func newHostLimiter(limit int) *hostLimiter {
+	return &hostLimiter{limit: limit, sems: make(map[string]chan struct{})}
+}
+
+// acquire blocks until a slot for host is free or ctx ends.
+func (h *hostLimiter) acquire(ctx context.Context, host string) error {
+	h.mu.Lock()
+	sem, ok := h.sems[host]
+	if !ok {
+		sem = make(chan struct{}, h.limit)
+		h.sems[host] = sem
+	}
+	h.mu.Unlock()
+	select {
+	case sem <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// release frees a slot previously acquired for host.
+func (h *hostLimiter) release(host string) {
+	h.mu.Lock()
+	sem := h.sems[host]
+	h.mu.Unlock()
+	<-sem
+}
+
+// hostOf returns the lowercased host of rawURL, or rawURL itself when it
+// cannot be parsed so that malformed URLs still share a bucket.
+func hostOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return rawURL
+	}
+	return strings.ToLower(u.Hostname())
+}
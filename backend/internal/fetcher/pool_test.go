@@ -0,0 +1,102 @@
+package fetcher
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fujidaiti/poppo-press/backend/internal/db"
+	"github.com/fujidaiti/poppo-press/backend/internal/testutil"
+)
+
+func TestRun_PerHostCapAndOrderedDelivery(t *testing.T) {
+	var sources []db.SourceFetchRow
+	for i := range 12 {
+		host := []string{"a.example", "b.example", "c.example"}[i%3]
+		sources = append(sources, db.SourceFetchRow{ID: int64(i + 1), URL: fmt.Sprintf("https://%s/feed/%d", host, i)})
+	}
+
+	var mu sync.Mutex
+	inFlight := map[string]int{}
+	peak := map[string]int{}
+	fetch := func(ctx context.Context, s db.SourceFetchRow) (*fetchOutcome, error) {
+		h := hostOf(s.URL)
+		mu.Lock()
+		inFlight[h]++
+		peak[h] = max(peak[h], inFlight[h])
+		mu.Unlock()
+		// finish later sources first to exercise reordering
+		time.Sleep(time.Duration(len(sources)-int(s.ID)) * time.Millisecond)
+		mu.Lock()
+		inFlight[h]--
+		mu.Unlock()
+		return &fetchOutcome{notModified: true}, nil
+	}
+
+	var order []int
+	run(context.Background(), sources, Options{Workers: 6, PerHost: 2, SourceTimeout: time.Second}, fetch, func(i int, out *fetchOutcome, err error) {
+		order = append(order, i)
+	})
+
+	for i, got := range order {
+		if got != i {
+			t.Fatalf("delivery out of order: %v", order)
+		}
+	}
+	if len(order) != len(sources) {
+		t.Fatalf("delivered %d of %d", len(order), len(sources))
+	}
+	for h, p := range peak {
+		if p > 2 {
+			t.Fatalf("host %s peaked at %d concurrent fetches", h, p)
+		}
+	}
+}
+
+func TestFetchAllSources_SlowSourceDoesNotStarveOthers(t *testing.T) {
+	database, cleanup := testutil.OpenTestDB(t, "admin-pass")
+	defer cleanup()
+
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer slow.Close()
+	defer close(release)
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/rss+xml")
+		fmt.Fprintf(w, `<?xml version="1.0"?><rss version="2.0"><channel><title>T</title><item><guid>%s</guid><title>A</title><link>https://ex/a</link></item></channel></rss>`, r.URL.Path)
+	}))
+	defer fast.Close()
+
+	slowID := insertSource(t, database, slow.URL+"/slow")
+	var fastIDs []int64
+	for i := range 5 {
+		fastIDs = append(fastIDs, insertSource(t, database, fmt.Sprintf("%s/fast/%d", fast.URL, i)))
+	}
+
+	start := time.Now()
+	results, err := FetchAllSources(context.Background(), database, testutil.HTTPClient(t), Options{Workers: 2, PerHost: 10, SourceTimeout: 200 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("run took %s; slow source was not bounded", elapsed)
+	}
+	if len(results) != 6 || results[0].SourceID != slowID || results[0].Err == nil {
+		t.Fatalf("expected slow source to fail first in results, got %+v", results)
+	}
+	for i, id := range fastIDs {
+		if r := results[i+1]; r.SourceID != id || r.Err != nil || r.Items != 1 {
+			t.Fatalf("unexpected result for fast source %d: %+v", id, r)
+		}
+		assertArticleCount(t, database, id, 1)
+	}
+}
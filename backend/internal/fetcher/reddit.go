@@ -0,0 +1,107 @@
+package fetcher
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/fujidaiti/poppo-press/backend/internal/db"
+)
+
+// redditBase is the site Reddit permalinks are relative to.
+const redditBase = "https://www.reddit.com"
+
+// redditAdapter reads a Reddit listing in its JSON form, such as
+// https://www.reddit.com/r/golang/top/.json?t=day.
+type redditAdapter struct{}
+
+// redditConfig selects which posts become articles.
+type redditConfig struct {
+	MinScore    int  `json:"minScore"`    // skip posts with a lower score
+	IncludeNSFW bool `json:"includeNsfw"` // keep posts marked over 18
+}
+
+// redditListing is the part of a listing the adapter reads.
+type redditListing struct {
+	Data struct {
+		Children []struct {
+			Data struct {
+				Name         string  `json:"name"`
+				Title        string  `json:"title"`
+				URL          string  `json:"url"`
+				Permalink    string  `json:"permalink"`
+				Author       string  `json:"author"`
+				Subreddit    string  `json:"subreddit"`
+				CreatedUTC   float64 `json:"created_utc"`
+				SelftextHTML string  `json:"selftext_html"`
+				Score        int     `json:"score"`
+				IsSelf       bool    `json:"is_self"`
+				Over18       bool    `json:"over_18"`
+			} `json:"data"`
+		} `json:"children"`
+	} `json:"data"`
+}
+
+// Validate implements SourceAdapter. The URL must be a .json listing.
+func (redditAdapter) Validate(sourceURL string, config json.RawMessage) error {
+	var cfg redditConfig
+	if err := decodeConfig(config, &cfg); err != nil {
+		return err
+	}
+	u, err := url.Parse(sourceURL)
+	if err != nil || !strings.HasSuffix(u.Path, ".json") {
+		return errors.New("reddit sources need a .json listing URL")
+	}
+	return nil
+}
+
+// Request implements SourceAdapter.
+func (redditAdapter) Request(ctx context.Context, sourceURL string, _ json.RawMessage) (*http.Request, error) {
+	return http.NewRequestWithContext(ctx, http.MethodGet, sourceURL, nil)
+}
+
+// Parse implements SourceAdapter. Link posts point at their link, self
+// posts at their thread, whose text becomes the body. The summary links the
+// thread without the score and comment count, which change on every poll.
+func (redditAdapter) Parse(body []byte, _ string, config json.RawMessage) (AdapterResult, error) {
+	var cfg redditConfig
+	if err := decodeConfig(config, &cfg); err != nil {
+		return AdapterResult{}, err
+	}
+	var listing redditListing
+	if err := json.Unmarshal(body, &listing); err != nil {
+		return AdapterResult{}, err
+	}
+	var out AdapterResult
+	for _, c := range listing.Data.Children {
+		p := c.Data
+		if p.Name == "" || p.Title == "" || p.Score < cfg.MinScore || (p.Over18 && !cfg.IncludeNSFW) {
+			continue
+		}
+		if out.Title == "" && p.Subreddit != "" {
+			out.Title = "r/" + p.Subreddit
+		}
+		thread := redditBase + p.Permalink
+		link := p.URL
+		if p.IsSelf || link == "" {
+			link = thread
+		}
+		out.Articles = append(out.Articles, db.UpsertArticleParams{
+			CanonicalURL: link,
+			Title:        html.UnescapeString(p.Title),
+			Summary:      fmt.Sprintf(`<p><a href="%s">Comments</a></p>`, html.EscapeString(thread)),
+			// the listing carries HTML escaped once more
+			Content:     html.UnescapeString(p.SelftextHTML),
+			Author:      p.Author,
+			PublishedAt: time.Unix(int64(p.CreatedUTC), 0).UTC().Format(time.RFC3339),
+			CanonicalID: "reddit:" + p.Name,
+		})
+	}
+	return out, nil
+}
@@ -0,0 +1,50 @@
+package fetcher
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/fujidaiti/poppo-press/backend/internal/credentials"
+)
+
+// maxRedirects mirrors the limit of http.Client's default redirect policy.
+const maxRedirects = 10
+
+// redirectTracker remembers where a request was redirected and whether every
+// hop was permanent.
+type redirectTracker struct {
+	target    string
+	permanent bool
+}
+
+// trackRedirects returns a copy of client that follows redirects exactly like
+// client while recording them in the returned tracker. Targets are recorded
+// redacted of cred, since they end up in the stored source URL.
+func trackRedirects(client *http.Client, cred credentials.Credential) (*http.Client, *redirectTracker) {
+	t := &redirectTracker{permanent: true}
+	c := *client
+	policy := client.CheckRedirect
+	c.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if policy != nil {
+			if err := policy(req, via); err != nil {
+				return err
+			}
+		} else if len(via) >= maxRedirects {
+			return errors.New("stopped after 10 redirects")
+		}
+		code := req.Response.StatusCode
+		t.permanent = t.permanent && (code == http.StatusMovedPermanently || code == http.StatusPermanentRedirect)
+		t.target = cred.Redact(req.URL).String()
+		return nil
+	}
+	return &c, t
+}
+
+// movedTo returns the URL the request ended at when it was redirected only
+// permanently, and "" otherwise.
+func (t *redirectTracker) movedTo() string {
+	if !t.permanent {
+		return ""
+	}
+	return t.target
+}
@@ -0,0 +1,175 @@
+package fetcher
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/fujidaiti/poppo-press/backend/internal/credentials"
+	"github.com/fujidaiti/poppo-press/backend/internal/db"
+	"github.com/fujidaiti/poppo-press/backend/internal/testutil"
+)
+
+func TestFetchAllSources_RewritesPermanentRedirects(t *testing.T) {
+	database, cleanup := testutil.OpenTestDB(t, "admin-pass")
+	defer cleanup()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/old", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/new", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/temp", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/new", http.StatusFound)
+	})
+	mux.HandleFunc("/new", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/rss+xml")
+		_, _ = w.Write([]byte(`<?xml version="1.0"?><rss version="2.0"><channel><title>T</title></channel></rss>`))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	moved := insertSource(t, database, srv.URL+"/old")
+	temp := insertSource(t, database, srv.URL+"/temp")
+	opts := Options{RedirectThreshold: 2}
+
+	// first permanent redirect is only counted
+	if _, err := FetchAllSources(context.Background(), database, testutil.HTTPClient(t), opts); err != nil {
+		t.Fatalf("fetch 1: %v", err)
+	}
+	if got := sourceURL(t, database, moved); got != srv.URL+"/old" {
+		t.Fatalf("rewritten too early: %s", got)
+	}
+
+	// the second consecutive one rewrites the URL and keeps the old one as an alias
+	makeDue(t, database, moved)
+	makeDue(t, database, temp)
+	if _, err := FetchAllSources(context.Background(), database, testutil.HTTPClient(t), opts); err != nil {
+		t.Fatalf("fetch 2: %v", err)
+	}
+	if got := sourceURL(t, database, moved); got != srv.URL+"/new" {
+		t.Fatalf("expected rewritten url, got %s", got)
+	}
+	if id, ok, err := db.FindSourceByURL(context.Background(), database, srv.URL+"/old"); err != nil || !ok || id != moved {
+		t.Fatalf("expected old url as alias of %d, got %d %v %v", moved, id, ok, err)
+	}
+	var kind string
+	if err := database.QueryRow("SELECT kind FROM source_event WHERE source_id = ?", moved).Scan(&kind); err != nil || kind != db.SourceEventMoved {
+		t.Fatalf("expected moved event, got %q %v", kind, err)
+	}
+
+	// temporary redirects never rewrite
+	if got := sourceURL(t, database, temp); got != srv.URL+"/temp" {
+		t.Fatalf("temporary redirect rewrote url: %s", got)
+	}
+}
+
+func TestFetchAllSources_RedirectTargetsOmitQueryCredentials(t *testing.T) {
+	database, cleanup := testutil.OpenTestDB(t, "admin-pass")
+	defer cleanup()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/old", func(w http.ResponseWriter, r *http.Request) {
+		// keeps the query, and with it the token, on the new location
+		http.Redirect(w, r, "/new?"+r.URL.RawQuery, http.StatusPermanentRedirect)
+	})
+	mux.HandleFunc("/new", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("key") != "s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/rss+xml")
+		_, _ = w.Write([]byte(`<?xml version="1.0"?><rss version="2.0"><channel><title>T</title></channel></rss>`))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	box, err := credentials.NewBox(base64.StdEncoding.EncodeToString(make([]byte, 32)))
+	if err != nil {
+		t.Fatalf("box: %v", err)
+	}
+	cred := credentials.Credential{Type: credentials.TypeQuery, Param: "key", Token: "s3cret"}
+	srcID, err := db.CreateSource(context.Background(), database, db.CreateSourceParams{
+		URL: srv.URL + "/old?lang=en", AuthType: cred.Type,
+		SealCredential: func(id int64) ([]byte, error) { return box.Seal(id, cred) },
+	})
+	if err != nil {
+		t.Fatalf("create source: %v", err)
+	}
+	opts := Options{RedirectThreshold: 2, Credentials: box}
+	for i := 0; i < 2; i++ {
+		makeDue(t, database, srcID)
+		results, err := FetchAllSources(context.Background(), database, testutil.HTTPClient(t), opts)
+		if err != nil || len(results) != 1 || results[0].Err != nil {
+			t.Fatalf("fetch %d: %+v %v", i+1, results, err)
+		}
+	}
+
+	if got := sourceURL(t, database, srcID); got != srv.URL+"/new?lang=en" {
+		t.Fatalf("expected rewritten url without the token, got %s", got)
+	}
+	for _, q := range []string{
+		"SELECT url FROM source",
+		"SELECT COALESCE(redirect_url, '') FROM source",
+		"SELECT url FROM source_alias",
+		"SELECT detail FROM source_event",
+	} {
+		rows, err := database.Query(q)
+		if err != nil {
+			t.Fatalf("%s: %v", q, err)
+		}
+		for rows.Next() {
+			var v string
+			if err := rows.Scan(&v); err != nil {
+				t.Fatalf("scan: %v", err)
+			}
+			if strings.Contains(v, "s3cret") {
+				t.Errorf("%s: token stored in %q", q, v)
+			}
+		}
+		rows.Close()
+	}
+}
+
+func TestFetchAllSources_MarksGoneSourcesDead(t *testing.T) {
+	database, cleanup := testutil.OpenTestDB(t, "admin-pass")
+	defer cleanup()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusGone)
+	}))
+	defer srv.Close()
+	srcID := insertSource(t, database, srv.URL)
+
+	results, err := FetchAllSources(context.Background(), database, testutil.HTTPClient(t), Options{})
+	if err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	if len(results) != 1 || classify(results[0].Err).Class != ClassGone {
+		t.Fatalf("expected gone result, got %+v", results)
+	}
+	var status string
+	if err := database.QueryRow("SELECT status FROM source WHERE id = ?", srcID).Scan(&status); err != nil || status != db.SourceDead {
+		t.Fatalf("expected dead source, got %q %v", status, err)
+	}
+
+	// dead sources are not polled even when due
+	makeDue(t, database, srcID)
+	results, err = FetchAllSources(context.Background(), database, testutil.HTTPClient(t), Options{})
+	if err != nil {
+		t.Fatalf("fetch 2: %v", err)
+	}
+	if len(results) != 0 {
+		t.Fatalf("expected dead source to be skipped, got %+v", results)
+	}
+}
+
+func sourceURL(t *testing.T, database *sql.DB, id int64) string {
+	t.Helper()
+	var u string
+	if err := database.QueryRow("SELECT url FROM source WHERE id = ?", id).Scan(&u); err != nil {
+		t.Fatalf("source url: %v", err)
+	}
+	return u
+}
@@ -0,0 +1,154 @@
+package fetcher
+
+import (
+	"bytes"
+	"hash/fnv"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	ext "github.com/mmcdole/gofeed/extensions"
+	"github.com/mmcdole/gofeed/rss"
+)
+
+// scheduleHints are the publisher's hints about how often a feed changes.
+// Zero durations mean the hint is absent.
+type scheduleHints struct {
+	ttl          time.Duration // RSS <ttl>
+	updatePeriod time.Duration // sy:updatePeriod / sy:updateFrequency
+	maxAge       time.Duration // Cache-Control: max-age
+	skipHours    map[int]bool  // RSS <skipHours>, in UTC
+	skipDays     map[time.Weekday]bool
+}
+
+// feedHints collects the scheduling hints of a fetched feed. body may be nil
+// (e.g. on 304), in which case only the response headers contribute.
+func feedHints(h http.Header, feed *gofeed.Feed, body []byte) scheduleHints {
+	hints := scheduleHints{maxAge: maxAge(h.Get("Cache-Control"))}
+	if feed == nil {
+		return hints
+	}
+	if sy, ok := feed.Extensions["sy"]; ok {
+		period, freq := extValue(sy, "updatePeriod"), extValue(sy, "updateFrequency")
+		hints.updatePeriod = syndicationPeriod(period, freq)
+	}
+	if feed.FeedType != "rss" || body == nil {
+		return hints
+	}
+	rf, err := (&rss.Parser{}).Parse(bytes.NewReader(body))
+	if err != nil {
+		return hints
+	}
+	if n, err := strconv.Atoi(strings.TrimSpace(rf.TTL)); err == nil && n > 0 {
+		hints.ttl = time.Duration(n) * time.Minute
+	}
+	for _, v := range rf.SkipHours {
+		if n, err := strconv.Atoi(strings.TrimSpace(v)); err == nil && n >= 0 && n < 24 {
+			if hints.skipHours == nil {
+				hints.skipHours = map[int]bool{}
+			}
+			hints.skipHours[n] = true
+		}
+	}
+	for _, v := range rf.SkipDays {
+		for d := time.Sunday; d <= time.Saturday; d++ {
+			if strings.EqualFold(strings.TrimSpace(v), d.String()) {
+				if hints.skipDays == nil {
+					hints.skipDays = map[time.Weekday]bool{}
+				}
+				hints.skipDays[d] = true
+			}
+		}
+	}
+	return hints
+}
+
+// effectiveInterval picks the polling interval of a source: the user
+// override when set, otherwise the most conservative publisher hint, falling
+// back to opts.DefaultInterval. The result is clamped to the configured
+// bounds.
+func effectiveInterval(override time.Duration, hints scheduleHints, opts Options) time.Duration {
+	d := override
+	if d <= 0 {
+		d = max(hints.ttl, hints.updatePeriod, hints.maxAge)
+	}
+	if d <= 0 {
+		d = opts.DefaultInterval
+	}
+	return min(max(d, opts.MinInterval), opts.MaxInterval)
+}
+
+// nextFetchAt schedules the next fetch of a source roughly one interval after
+// now. Each source gets a stable phase within its interval, derived from its
+// id, so that sources sharing an interval do not all fire at once. Times the
+// feed asks to skip are stepped over.
+func nextFetchAt(sourceID int64, now time.Time, interval time.Duration, hints scheduleHints) time.Time {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(strconv.FormatInt(sourceID, 10)))
+	phase := time.Duration(h.Sum64() % uint64(interval))
+	// the first phase-aligned slot at least half an interval away
+	next := now.Truncate(interval).Add(phase)
+	for next.Sub(now) < interval/2 {
+		next = next.Add(interval)
+	}
+	for i := 0; i < 24*7 && hints.skips(next); i++ {
+		next = next.UTC().Truncate(time.Hour).Add(time.Hour)
+	}
+	return next
+}
+
+// skips reports whether the feed asks readers not to fetch at t.
+func (h scheduleHints) skips(t time.Time) bool {
+	t = t.UTC()
+	return h.skipHours[t.Hour()] || h.skipDays[t.Weekday()]
+}
+
+// maxAge extracts the max-age directive of a Cache-Control header.
+func maxAge(cc string) time.Duration {
+	for _, d := range strings.Split(cc, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(d), "=")
+		if !ok || !strings.EqualFold(k, "max-age") {
+			continue
+		}
+		if n, err := strconv.Atoi(strings.Trim(v, `"`)); err == nil && n > 0 {
+			return time.Duration(n) * time.Second
+		}
+	}
+	return 0
+}
+
+// syndicationPeriod converts the RSS syndication module's updatePeriod and
+// updateFrequency into an interval.
+func syndicationPeriod(period, freq string) time.Duration {
+	var base time.Duration
+	switch strings.ToLower(strings.TrimSpace(period)) {
+	case "hourly":
+		base = time.Hour
+	case "daily":
+		base = 24 * time.Hour
+	case "weekly":
+		base = 7 * 24 * time.Hour
+	case "monthly":
+		base = 30 * 24 * time.Hour
+	case "yearly":
+		base = 365 * 24 * time.Hour
+	default:
+		return 0
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(freq))
+	if err != nil || n <= 0 {
+		n = 1
+	}
+	return base / time.Duration(n)
+}
+
+// extValue returns the text of the first extension element with the given
+// name.
+func extValue(ns map[string][]ext.Extension, name string) string {
+	if es := ns[name]; len(es) > 0 {
+		return es[0].Value
+	}
+	return ""
+}
@@ -0,0 +1,76 @@
+package fetcher
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+func TestFeedHints(t *testing.T) {
+	body := []byte(`<?xml version="1.0"?><rss version="2.0" xmlns:sy="http://purl.org/rss/1.0/modules/syndication/"><channel><title>T</title>
+<ttl>90</ttl><sy:updatePeriod>daily</sy:updatePeriod><sy:updateFrequency>4</sy:updateFrequency>
+<skipHours><hour>0</hour><hour>1</hour></skipHours><skipDays><day>Sunday</day></skipDays></channel></rss>`)
+	feed, err := gofeed.NewParser().Parse(bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	h := feedHints(http.Header{"Cache-Control": {"public, max-age=600"}}, feed, body)
+	if h.ttl != 90*time.Minute || h.updatePeriod != 6*time.Hour || h.maxAge != 10*time.Minute {
+		t.Fatalf("durations: %+v", h)
+	}
+	if !h.skipHours[0] || !h.skipHours[1] || h.skipHours[2] || !h.skipDays[time.Sunday] {
+		t.Fatalf("skips: %+v", h)
+	}
+}
+
+func TestEffectiveInterval(t *testing.T) {
+	opts := Options{}.withDefaults()
+	cases := []struct {
+		name     string
+		override time.Duration
+		hints    scheduleHints
+		want     time.Duration
+	}{
+		{"default", 0, scheduleHints{}, time.Hour},
+		{"most conservative hint", 0, scheduleHints{ttl: 2 * time.Hour, maxAge: 5 * time.Minute}, 2 * time.Hour},
+		{"override wins", 30 * time.Minute, scheduleHints{ttl: 6 * time.Hour}, 30 * time.Minute},
+		{"clamped to min", 0, scheduleHints{maxAge: time.Minute}, 15 * time.Minute},
+		{"clamped to max", 0, scheduleHints{updatePeriod: 30 * 24 * time.Hour}, 24 * time.Hour},
+	}
+	for _, c := range cases {
+		if got := effectiveInterval(c.override, c.hints, opts); got != c.want {
+			t.Errorf("%s: got %s want %s", c.name, got, c.want)
+		}
+	}
+}
+
+func TestNextFetchAt_SpreadsAndSkips(t *testing.T) {
+	now := time.Date(2025, 3, 5, 10, 0, 0, 0, time.UTC) // a Wednesday
+	minutes := map[int]bool{}
+	for id := int64(1); id <= 20; id++ {
+		next := nextFetchAt(id, now, time.Hour, scheduleHints{})
+		if d := next.Sub(now); d < 30*time.Minute || d > 90*time.Minute {
+			t.Fatalf("source %d: next in %s", id, d)
+		}
+		if again := nextFetchAt(id, now, time.Hour, scheduleHints{}); !again.Equal(next) {
+			t.Fatalf("source %d: phase not stable", id)
+		}
+		minutes[next.Minute()] = true
+	}
+	if len(minutes) < 10 {
+		t.Fatalf("fetches not spread across the hour: %v", minutes)
+	}
+
+	skip := scheduleHints{skipHours: map[int]bool{10: true, 11: true}, skipDays: map[time.Weekday]bool{time.Thursday: true}}
+	next := nextFetchAt(1, now, time.Hour, skip)
+	if next.Hour() != 12 {
+		t.Fatalf("skipHours not honored: %s", next)
+	}
+	late := time.Date(2025, 3, 5, 23, 30, 0, 0, time.UTC)
+	if next := nextFetchAt(1, late, time.Hour, skip); next.Weekday() != time.Friday {
+		t.Fatalf("skipDays not honored: %s", next)
+	}
+}
@@ -0,0 +1,219 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"syscall"
+)
+
+// ErrForbiddenAddress is returned for requests to loopback, private,
+// link-local and other non-public destinations that are not allowlisted.
+var ErrForbiddenAddress = errors.New("httpclient: destination address not allowed")
+
+// ErrBodyTooLarge is returned when a response body exceeds the size limit.
+var ErrBodyTooLarge = errors.New("httpclient: response body too large")
+
+// ErrContentType is returned by CheckContentType for responses that cannot
+// be a feed or a web page.
+var ErrContentType = errors.New("httpclient: unexpected content type")
+
+// blockedPrefixes are the destinations refused unless allowlisted: loopback,
+// private (RFC 1918, unique local), shared (CGNAT), link-local (including
+// cloud metadata endpoints), unspecified, multicast and reserved ranges, and
+// the IPv6 ranges embedding an IPv4 address (NAT64, 6to4), which could reach
+// any of the former.
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("10.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("127.0.0.0/8"),
+	netip.MustParsePrefix("169.254.0.0/16"),
+	netip.MustParsePrefix("172.16.0.0/12"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("192.168.0.0/16"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("224.0.0.0/4"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("::/128"),
+	netip.MustParsePrefix("::1/128"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("2002::/16"),
+	netip.MustParsePrefix("fc00::/7"),
+	netip.MustParsePrefix("fe80::/10"),
+	netip.MustParsePrefix("ff00::/8"),
+}
+
+// guard decides which destinations may be connected to.
+type guard struct {
+	prefixes []netip.Prefix // allowlisted addresses
+	hosts    map[string]bool
+}
+
+// newGuard parses an allowlist of CIDR prefixes, addresses and host names.
+func newGuard(allow []string) (*guard, error) {
+	g := &guard{hosts: map[string]bool{}}
+	for _, a := range allow {
+		a = strings.ToLower(strings.TrimSpace(a))
+		switch {
+		case a == "":
+		case strings.Contains(a, "/"):
+			p, err := netip.ParsePrefix(a)
+			if err != nil {
+				return nil, fmt.Errorf("httpclient: invalid allowlist entry %q", a)
+			}
+			g.prefixes = append(g.prefixes, p.Masked())
+		default:
+			if ip, err := netip.ParseAddr(a); err == nil {
+				g.prefixes = append(g.prefixes, netip.PrefixFrom(ip.Unmap(), ip.Unmap().BitLen()))
+			} else {
+				g.hosts[strings.TrimSuffix(a, ".")] = true
+			}
+		}
+	}
+	return g, nil
+}
+
+// allowedAddr reports whether ip may be connected to.
+func (g *guard) allowedAddr(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	for _, p := range g.prefixes {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+	for _, p := range blockedPrefixes {
+		if p.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// allowedHost reports whether host was allowlisted by name.
+func (g *guard) allowedHost(host string) bool {
+	return g.hosts[strings.TrimSuffix(strings.ToLower(host), ".")]
+}
+
+// checkURLHost refuses requests whose host is a blocked address literal or
+// "localhost" before they are sent. This matters when a proxy dials on the
+// client's behalf, where the dial-time check only sees the proxy.
+func (g *guard) checkURLHost(host string) error {
+	if g.allowedHost(host) {
+		return nil
+	}
+	h := strings.TrimSuffix(strings.ToLower(host), ".")
+	if h == "localhost" || strings.HasSuffix(h, ".localhost") {
+		return fmt.Errorf("%w: %s", ErrForbiddenAddress, host)
+	}
+	if ip, err := netip.ParseAddr(strings.Trim(h, "[]")); err == nil && !g.allowedAddr(ip) {
+		return fmt.Errorf("%w: %s", ErrForbiddenAddress, host)
+	}
+	return nil
+}
+
+// dialContext returns a dial function that checks every address actually
+// connected to, after DNS resolution, so that names resolving to private
+// addresses and redirects to them are refused alike. Hosts allowlisted by
+// name are dialed unchecked.
+func (g *guard) dialContext(d *net.Dialer) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	checked := *d
+	checked.Control = func(network, address string, _ syscall.RawConn) error {
+		ap, err := netip.ParseAddrPort(address)
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrForbiddenAddress, address)
+		}
+		if !g.allowedAddr(ap.Addr()) {
+			return fmt.Errorf("%w: %s", ErrForbiddenAddress, ap.Addr())
+		}
+		return nil
+	}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if host, _, err := net.SplitHostPort(addr); err == nil && g.allowedHost(host) {
+			return d.DialContext(ctx, network, addr)
+		}
+		return checked.DialContext(ctx, network, addr)
+	}
+}
+
+// limitBody rejects a response whose declared length exceeds max and
+// otherwise bounds its body, so that reading past max fails with
+// ErrBodyTooLarge instead of silently truncating.
+func limitBody(resp *http.Response, max int64) error {
+	if resp.ContentLength > max {
+		_ = resp.Body.Close()
+		return fmt.Errorf("%w: %d bytes", ErrBodyTooLarge, resp.ContentLength)
+	}
+	resp.Body = &limitedBody{rc: resp.Body, remaining: max}
+	return nil
+}
+
+// limitedBody fails reads once more than its limit has been read.
+type limitedBody struct {
+	rc        io.ReadCloser
+	remaining int64
+}
+
+// Read implements io.Reader.
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.remaining < 0 {
+		return 0, ErrBodyTooLarge
+	}
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1]
+	}
+	n, err := b.rc.Read(p)
+	b.remaining -= int64(n)
+	if b.remaining < 0 {
+		return n, ErrBodyTooLarge
+	}
+	return n, err
+}
+
+// Close implements io.Closer.
+func (b *limitedBody) Close() error { return b.rc.Close() }
+
+// binaryTypes are application types that are never feeds or web pages.
+var binaryTypes = map[string]bool{
+	"application/pdf":              true,
+	"application/zip":              true,
+	"application/gzip":             true,
+	"application/x-gzip":           true,
+	"application/x-tar":            true,
+	"application/x-bzip2":          true,
+	"application/x-7z-compressed":  true,
+	"application/x-rar-compressed": true,
+	"application/vnd.rar":          true,
+	"application/wasm":             true,
+	"application/x-msdownload":     true,
+	"application/java-archive":     true,
+	"application/msword":           true,
+}
+
+// CheckContentType returns ErrContentType when the Content-Type header of a
+// response names media that cannot hold a feed or a page: images, audio,
+// video, fonts and binary documents or archives. A missing or generic type
+// (application/octet-stream, which misconfigured servers use for feeds)
+// passes.
+func CheckContentType(h http.Header) error {
+	ct := h.Get("Content-Type")
+	if ct == "" {
+		return nil
+	}
+	mt, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return nil
+	}
+	top, _, _ := strings.Cut(mt, "/")
+	switch {
+	case top == "image", top == "audio", top == "video", top == "font", top == "model", binaryTypes[mt]:
+		return fmt.Errorf("%w: %s", ErrContentType, mt)
+	}
+	return nil
+}
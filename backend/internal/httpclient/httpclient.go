@@ -0,0 +1,208 @@
+// Package httpclient builds the HTTP client used for every outbound request
+// the server makes on behalf of sources: polling feeds, probing and
+// discovering them, downloading linked pages, and talking to WebSub hubs.
+package httpclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/fujidaiti/poppo-press/backend/internal/config"
+	"github.com/fujidaiti/poppo-press/backend/internal/version"
+)
+
+// DefaultMaxBodyBytes is the default bound of a response body.
+const DefaultMaxBodyBytes = 10 << 20
+
+// Options configures outbound requests. Zero values select the defaults.
+type Options struct {
+	// ProxyURL routes requests through an HTTP(S) proxy. When empty the
+	// standard HTTP_PROXY/HTTPS_PROXY/NO_PROXY environment variables apply.
+	ProxyURL string
+	// CAFile is a PEM bundle of extra certificate authorities trusted in
+	// addition to the system roots.
+	CAFile string
+	// UserAgent is sent with every request that does not set its own
+	// (default "poppo-press/<version> (+https://github.com/fujidaiti/poppo-press)").
+	UserAgent string
+	// Timeout bounds a whole request including reading the body (default 10s).
+	Timeout time.Duration
+	// DialTimeout bounds connecting and the TLS handshake (default 5s).
+	DialTimeout time.Duration
+	// MaxRedirects bounds the requests of a redirect chain, counted as
+	// http.Client's default policy counts them (default 10).
+	MaxRedirects int
+	// Headers are added to requests, overriding any already set, keyed by
+	// source: either a host, matching it and its subdomains, or a URL prefix
+	// containing "://".
+	Headers map[string]map[string]string
+	// AllowPrivate lists destinations exempt from the private address
+	// guard: CIDR prefixes, addresses, or host names. Loopback, private,
+	// link-local and other non-public addresses are refused otherwise.
+	AllowPrivate []string
+	// MaxBodyBytes bounds the size of a response body (default
+	// DefaultMaxBodyBytes).
+	MaxBodyBytes int64
+}
+
+// FromConfig returns the outbound options set in cfg.
+func FromConfig(cfg config.Config) Options {
+	return Options{
+		ProxyURL:     cfg.OutboundProxy,
+		CAFile:       cfg.OutboundCAFile,
+		UserAgent:    cfg.OutboundUserAgent,
+		Timeout:      cfg.OutboundTimeout,
+		DialTimeout:  cfg.OutboundDialTimeout,
+		MaxRedirects: cfg.OutboundMaxRedirects,
+		Headers:      cfg.OutboundHeaders,
+		AllowPrivate: cfg.OutboundAllowPrivate,
+		MaxBodyBytes: int64(cfg.OutboundMaxBody),
+	}
+}
+
+// withDefaults fills zero fields with their defaults.
+func (o Options) withDefaults() Options {
+	if o.UserAgent == "" {
+		o.UserAgent = "poppo-press/" + version.Version + " (+https://github.com/fujidaiti/poppo-press)"
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = 10 * time.Second
+	}
+	if o.DialTimeout <= 0 {
+		o.DialTimeout = 5 * time.Second
+	}
+	if o.MaxRedirects <= 0 {
+		o.MaxRedirects = 10
+	}
+	if o.MaxBodyBytes <= 0 {
+		o.MaxBodyBytes = DefaultMaxBodyBytes
+	}
+	return o
+}
+
+// New returns a client configured by opts. It fails when the proxy URL or
+// an allowlist entry is malformed, or the CA bundle cannot be read or holds
+// no certificate.
+func New(opts Options) (*http.Client, error) {
+	opts = opts.withDefaults()
+	g, err := newGuard(opts.AllowPrivate)
+	if err != nil {
+		return nil, err
+	}
+	proxy := http.ProxyFromEnvironment
+	if opts.ProxyURL != "" {
+		u, err := url.Parse(opts.ProxyURL)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("httpclient: invalid proxy URL %q", opts.ProxyURL)
+		}
+		proxy = http.ProxyURL(u)
+	}
+	// the proxy is typically on a private network; it is trusted to apply
+	// its own policy, while request URLs are still checked by host
+	for _, probe := range []string{"http://example.com/", "https://example.com/"} {
+		req, _ := http.NewRequest(http.MethodGet, probe, nil)
+		if u, err := proxy(req); err == nil && u != nil {
+			g.hosts[strings.ToLower(u.Hostname())] = true
+		}
+	}
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if opts.CAFile != "" {
+		pem, err := os.ReadFile(opts.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("httpclient: read CA bundle: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("httpclient: no certificates in %s", opts.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	transport := &http.Transport{
+		Proxy:                 proxy,
+		DialContext:           g.dialContext(&net.Dialer{Timeout: opts.DialTimeout, KeepAlive: 30 * time.Second}),
+		TLSClientConfig:       tlsConfig,
+		TLSHandshakeTimeout:   opts.DialTimeout,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}
+	maxRedirects := opts.MaxRedirects
+	return &http.Client{
+		Timeout: opts.Timeout,
+		Transport: &guardedTransport{
+			base: transport, guard: g, userAgent: opts.UserAgent, headers: opts.Headers, maxBody: opts.MaxBodyBytes,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+			return nil
+		},
+	}, nil
+}
+
+// Default returns a client with the default options.
+func Default() *http.Client {
+	// the defaults read no files and parse no URLs, so New cannot fail
+	c, _ := New(Options{})
+	return c
+}
+
+// guardedTransport refuses requests to forbidden hosts, sets the User-Agent
+// and per-source headers, and bounds response bodies.
+type guardedTransport struct {
+	base      http.RoundTripper
+	guard     *guard
+	userAgent string
+	headers   map[string]map[string]string
+	maxBody   int64
+}
+
+// RoundTrip implements http.RoundTripper on a copy of req.
+func (t *guardedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.guard.checkURLHost(req.URL.Hostname()); err != nil {
+		return nil, err
+	}
+	req = req.Clone(req.Context())
+	if req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", t.userAgent)
+	}
+	for key, hs := range t.headers {
+		if !matches(key, req.URL) {
+			continue
+		}
+		for k, v := range hs {
+			req.Header.Set(k, v)
+		}
+	}
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := limitBody(resp, t.maxBody); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// matches reports whether a header override key applies to u: a URL prefix
+// when it contains "://", otherwise a host matching u's host or a parent
+// domain of it.
+func matches(key string, u *url.URL) bool {
+	if strings.Contains(key, "://") {
+		return strings.HasPrefix(u.String(), key)
+	}
+	host, key := strings.ToLower(u.Hostname()), strings.ToLower(key)
+	return host == key || strings.HasSuffix(host, "."+key)
+}
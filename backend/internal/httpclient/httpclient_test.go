@@ -0,0 +1,191 @@
+package httpclient
+
+import (
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// loopback allows the addresses httptest servers listen on.
+var loopback = []string{"127.0.0.0/8", "::1"}
+
+func TestNew_HeadersAndRedirects(t *testing.T) {
+	var ua, token string
+	hops := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/loop" {
+			hops++
+			http.Redirect(w, r, "/loop", http.StatusFound)
+			return
+		}
+		ua, token = r.Header.Get("User-Agent"), r.Header.Get("X-Token")
+	}))
+	defer srv.Close()
+
+	client, err := New(Options{MaxRedirects: 2, AllowPrivate: loopback, Headers: map[string]map[string]string{
+		srv.URL + "/private": {"X-Token": "secret", "User-Agent": "Mozilla/5.0"},
+	}})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	get := func(path string) error {
+		resp, err := client.Get(srv.URL + path)
+		if err == nil {
+			_ = resp.Body.Close()
+		}
+		return err
+	}
+	if err := get("/public"); err != nil || !strings.HasPrefix(ua, "poppo-press/") || token != "" {
+		t.Fatalf("public: ua=%q token=%q err=%v", ua, token, err)
+	}
+	if err := get("/private/feed"); err != nil || ua != "Mozilla/5.0" || token != "secret" {
+		t.Fatalf("private: ua=%q token=%q err=%v", ua, token, err)
+	}
+	if err := get("/loop"); err == nil || hops != 2 {
+		t.Fatalf("expected redirect limit after 2 requests, got %d hops, err=%v", hops, err)
+	}
+}
+
+func TestNew_ProxyAndCustomCA(t *testing.T) {
+	tlsSrv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("internal"))
+	}))
+	defer tlsSrv.Close()
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: tlsSrv.Certificate().Raw})
+	if err := os.WriteFile(caFile, cert, 0o600); err != nil {
+		t.Fatalf("write ca: %v", err)
+	}
+	client, err := New(Options{CAFile: caFile, AllowPrivate: loopback})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	resp, err := client.Get(tlsSrv.URL)
+	if err != nil {
+		t.Fatalf("tls get with custom CA: %v", err)
+	}
+	_ = resp.Body.Close()
+
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+	}))
+	defer proxy.Close()
+	client, err = New(Options{ProxyURL: proxy.URL})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	resp, err = client.Get("http://feeds.internal.example/rss")
+	if err != nil {
+		t.Fatalf("proxied get: %v", err)
+	}
+	_ = resp.Body.Close()
+	if proxied != "http://feeds.internal.example/rss" {
+		t.Fatalf("proxy saw %q", proxied)
+	}
+
+	if _, err := New(Options{CAFile: filepath.Join(t.TempDir(), "missing.pem")}); err == nil {
+		t.Fatalf("expected error for missing CA bundle")
+	}
+}
+
+func TestNew_BlocksPrivateDestinations(t *testing.T) {
+	hit := false
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hit = true
+		if r.URL.Path == "/bounce" {
+			// 127.0.0.2 is loopback too but not allowlisted below
+			http.Redirect(w, r, strings.Replace(srv.URL, "127.0.0.1", "127.0.0.2", 1)+"/", http.StatusFound)
+		}
+	}))
+	defer srv.Close()
+
+	client := Default()
+	for _, u := range []string{
+		srv.URL, "http://localhost:1/", "http://169.254.169.254/latest/meta-data/", "http://[::1]:1/",
+		"http://[64:ff9b::7f00:1]:1/",  // NAT64 of 127.0.0.1
+		"http://[2002:a9fe:a9fe::]:1/", // 6to4 of 169.254.169.254
+	} {
+		if _, err := client.Get(u); !errors.Is(err, ErrForbiddenAddress) {
+			t.Fatalf("%s: expected forbidden address, got %v", u, err)
+		}
+	}
+	if hit {
+		t.Fatalf("blocked request reached the server")
+	}
+
+	client, err := New(Options{AllowPrivate: []string{"127.0.0.1"}})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("allowlisted get: %v", err)
+	}
+	_ = resp.Body.Close()
+	if _, err := client.Get(srv.URL + "/bounce"); !errors.Is(err, ErrForbiddenAddress) {
+		t.Fatalf("expected redirect to a blocked address to fail, got %v", err)
+	}
+
+	if _, err := New(Options{AllowPrivate: []string{"10.0.0.0/33"}}); err == nil {
+		t.Fatalf("expected error for malformed allowlist entry")
+	}
+}
+
+func TestNew_LimitsBodySize(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := strings.Repeat("x", 64)
+		if r.URL.Path == "/declared" {
+			w.Header().Set("Content-Length", fmt.Sprint(len(body)))
+		} else {
+			// flushing first forces a chunked response of unknown length
+			w.(http.Flusher).Flush()
+		}
+		_, _ = io.WriteString(w, body)
+	}))
+	defer srv.Close()
+	client, err := New(Options{AllowPrivate: loopback, MaxBodyBytes: 32})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	if _, err := client.Get(srv.URL + "/declared"); !errors.Is(err, ErrBodyTooLarge) {
+		t.Fatalf("declared length: expected body too large, got %v", err)
+	}
+	resp, err := client.Get(srv.URL + "/chunked")
+	if err != nil {
+		t.Fatalf("chunked get: %v", err)
+	}
+	defer resp.Body.Close()
+	if _, err := io.ReadAll(resp.Body); !errors.Is(err, ErrBodyTooLarge) {
+		t.Fatalf("chunked: expected body too large, got %v", err)
+	}
+}
+
+func TestCheckContentType(t *testing.T) {
+	for ct, ok := range map[string]bool{
+		"":                                   true,
+		"application/rss+xml; charset=utf-8": true,
+		"text/html":                          true,
+		"application/octet-stream":           true,
+		"image/png":                          false,
+		"video/mp4":                          false,
+		"application/pdf":                    false,
+		"application/zip":                    false,
+	} {
+		h := http.Header{}
+		if ct != "" {
+			h.Set("Content-Type", ct)
+		}
+		if err := CheckContentType(h); (err == nil) != ok {
+			t.Fatalf("%q: got %v", ct, err)
+		}
+	}
+}
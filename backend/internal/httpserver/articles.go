@@ -5,38 +5,70 @@ import (
 	"encoding/json"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 
 	"github.com/fujidaiti/poppo-press/backend/internal/db"
+	"github.com/fujidaiti/poppo-press/backend/internal/normalize"
 )
 
 func registerArticleRoutes(database *sql.DB, r chi.Router) {
 	r.With(authMiddleware(database)).Route("/articles", func(r chi.Router) {
 		r.Get("/", func(w http.ResponseWriter, r *http.Request) {
 			devID := r.Context().Value(ctxDeviceID{}).(int64)
+			format, ok := bodyFormat(w, r)
+			if !ok {
+				return
+			}
+			media, ok := mediaFilter(w, r)
+			if !ok {
+				return
+			}
+			since, ok := sinceParam(w, r)
+			if !ok {
+				return
+			}
 			readState := r.URL.Query().Get("readState")
 			if readState != "read" && readState != "unread" {
 				readState = "all"
 			}
-			list, err := db.ListArticles(r.Context(), database, devID, readState)
+			filter := db.ArticleFilter{ReadState: readState, Media: media, Since: since}
+			for _, t := range r.URL.Query()["tag"] {
+				if t = normalize.Tag(t); t != "" {
+					filter.Tags = append(filter.Tags, t)
+				}
+			}
+			list, err := db.ListArticles(r.Context(), database, devID, filter)
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, "internal", "list fail")
+				return
+			}
+			encs, tags, err := articleExtras(r, database, list)
 			if err != nil {
 				writeError(w, http.StatusInternalServerError, "internal", "list fail")
 				return
 			}
 			type out struct {
-				ID           int64  `json:"id"`
-				SourceID     int64  `json:"sourceId"`
-				CanonicalURL string `json:"canonicalUrl"`
-				Title        string `json:"title"`
-				Summary      string `json:"summary"`
-				Author       string `json:"author"`
-				PublishedAt  string `json:"publishedAt"`
-				IsRead       bool   `json:"isRead"`
+				ID           int64          `json:"id"`
+				SourceID     int64          `json:"sourceId"`
+				CanonicalURL string         `json:"canonicalUrl"`
+				Title        string         `json:"title"`
+				Summary      string         `json:"summary"`
+				Author       string         `json:"author"`
+				PublishedAt  string         `json:"publishedAt"`
+				IsRead       bool           `json:"isRead"`
+				Updated      bool           `json:"updated"`
+				RevisedAt    *string        `json:"revisedAt"`
+				ImageURL     *string        `json:"imageUrl"`
+				SourceImage  *string        `json:"sourceImageUrl"`
+				Tags         []string       `json:"tags"`
+				MediaKind    *string        `json:"mediaKind"`
+				Enclosures   []enclosureOut `json:"enclosures"`
 			}
 			resp := make([]out, 0, len(list))
 			for _, a := range list {
-				resp = append(resp, out{ID: a.ID, SourceID: a.SourceID, CanonicalURL: a.CanonicalURL, Title: a.Title, Summary: a.Summary, Author: a.Author, PublishedAt: a.PublishedAt, IsRead: a.IsRead})
+				resp = append(resp, out{ID: a.ID, SourceID: a.SourceID, CanonicalURL: a.CanonicalURL, Title: a.Title, Summary: normalize.Render(a.Summary, format), Author: a.Author, PublishedAt: a.PublishedAt, IsRead: a.IsRead, Updated: a.Updated, RevisedAt: nullString(a.RevisedAt), ImageURL: nullString(a.ImageURL), SourceImage: nullString(a.SourceImage), Tags: tagList(tags[a.ID]), MediaKind: mediaKind(encs[a.ID]), Enclosures: toEnclosureOut(encs[a.ID])})
 			}
 			w.Header().Set("Content-Type", "application/json")
 			_ = json.NewEncoder(w).Encode(resp)
@@ -49,17 +81,55 @@ func registerArticleRoutes(database *sql.DB, r chi.Router) {
 				writeError(w, http.StatusBadRequest, "bad_request", "invalid id")
 				return
 			}
+			format, ok := bodyFormat(w, r)
+			if !ok {
+				return
+			}
 			a, err := db.GetArticle(r.Context(), database, devID, id)
 			if err != nil {
 				writeError(w, http.StatusNotFound, "not_found", "article not found")
 				return
 			}
+			encs, tags, err := articleExtras(r, database, []db.ArticleListRow{a.ArticleListRow})
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, "internal", "detail fail")
+				return
+			}
 			w.Header().Set("Content-Type", "application/json")
 			_ = json.NewEncoder(w).Encode(map[string]any{
-				"id": a.ID, "sourceId": a.SourceID, "canonicalUrl": a.CanonicalURL, "title": a.Title, "summary": a.Summary, "author": a.Author, "publishedAt": a.PublishedAt, "isRead": a.IsRead,
+				"id": a.ID, "sourceId": a.SourceID, "canonicalUrl": a.CanonicalURL, "title": a.Title, "summary": normalize.Render(a.Summary, format), "content": normalize.Render(a.Content, format), "author": a.Author, "publishedAt": a.PublishedAt, "isRead": a.IsRead,
+				"updated": a.Updated, "revisedAt": nullString(a.RevisedAt),
+				"imageUrl": nullString(a.ImageURL), "sourceImageUrl": nullString(a.SourceImage), "tags": tagList(tags[a.ID]),
+				"mediaKind": mediaKind(encs[a.ID]), "enclosures": toEnclosureOut(encs[a.ID]),
 			})
 		})
 
+		r.Get("/{id}/revisions", func(w http.ResponseWriter, r *http.Request) {
+			devID := r.Context().Value(ctxDeviceID{}).(int64)
+			id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, "bad_request", "invalid id")
+				return
+			}
+			format, ok := bodyFormat(w, r)
+			if !ok {
+				return
+			}
+			a, err := db.GetArticle(r.Context(), database, devID, id)
+			if err != nil {
+				writeError(w, http.StatusNotFound, "not_found", "article not found")
+				return
+			}
+			revs, err := db.ListArticleRevisions(r.Context(), database, id)
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, "internal", "revisions fail")
+				return
+			}
+			current := db.ArticleVersion{Title: a.Title, Summary: a.Summary, Content: a.Content, PublishedAt: a.PublishedAt}
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(revisionDiffs(revs, current, format))
+		})
+
 		r.Post("/{id}/read", func(w http.ResponseWriter, r *http.Request) {
 			devID := r.Context().Value(ctxDeviceID{}).(int64)
 			id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
@@ -82,3 +152,151 @@ func registerArticleRoutes(database *sql.DB, r chi.Router) {
 		})
 	})
 }
+
+// bodyFormat reads the optional ?format= query parameter selecting how
+// article summaries and bodies are rendered. On an invalid value it writes a
+// 400 response and returns false.
+func bodyFormat(w http.ResponseWriter, r *http.Request) (normalize.Format, bool) {
+	f, ok := normalize.ParseFormat(r.URL.Query().Get("format"))
+	if !ok {
+		writeError(w, http.StatusBadRequest, "bad_request", "format must be html, text, or markdown")
+	}
+	return f, ok
+}
+
+// mediaFilter reads the optional ?media= query parameter filtering articles
+// by their enclosures. On an invalid value it writes a 400 response and
+// returns false.
+func mediaFilter(w http.ResponseWriter, r *http.Request) (string, bool) {
+	m := r.URL.Query().Get("media")
+	if !db.ValidMediaFilter(m) {
+		writeError(w, http.StatusBadRequest, "bad_request", "media must be audio, video, any, or none")
+		return "", false
+	}
+	return m, true
+}
+
+// enclosureOut is the JSON shape of an article enclosure.
+type enclosureOut struct {
+	URL             string `json:"url"`
+	Type            string `json:"type"`
+	Kind            string `json:"kind"`
+	Length          *int64 `json:"length"`
+	DurationSeconds *int64 `json:"durationSeconds"`
+}
+
+// articleExtras loads the enclosures and tags of the listed articles.
+func articleExtras(r *http.Request, database *sql.DB, list []db.ArticleListRow) (map[int64][]db.Enclosure, map[int64][]string, error) {
+	ids := make([]int64, len(list))
+	for i, a := range list {
+		ids[i] = a.ID
+	}
+	encs, err := db.ListEnclosures(r.Context(), database, ids)
+	if err != nil {
+		return nil, nil, err
+	}
+	tags, err := db.ListArticleTags(r.Context(), database, ids)
+	if err != nil {
+		return nil, nil, err
+	}
+	return encs, tags, nil
+}
+
+// tagList returns tags as a JSON array, never null.
+func tagList(tags []string) []string {
+	if tags == nil {
+		return []string{}
+	}
+	return tags
+}
+
+// sinceParam reads the optional ?since= query parameter, an RFC 3339
+// timestamp or a YYYY-MM-DD date (midnight UTC). On an invalid value it
+// writes a 400 response and returns false.
+func sinceParam(w http.ResponseWriter, r *http.Request) (time.Time, bool) {
+	v := r.URL.Query().Get("since")
+	if v == "" {
+		return time.Time{}, true
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, true
+	}
+	if t, err := time.Parse(time.DateOnly, v); err == nil {
+		return t, true
+	}
+	writeError(w, http.StatusBadRequest, "bad_request", "since must be an RFC 3339 timestamp or YYYY-MM-DD")
+	return time.Time{}, false
+}
+
+// toEnclosureOut converts enclosures to their JSON shape; unknown lengths and
+// durations become null.
+func toEnclosureOut(encs []db.Enclosure) []enclosureOut {
+	out := make([]enclosureOut, 0, len(encs))
+	for _, e := range encs {
+		o := enclosureOut{URL: e.URL, Type: e.MIMEType, Kind: e.Kind}
+		if e.Length > 0 {
+			o.Length = &e.Length
+		}
+		if e.Duration > 0 {
+			o.DurationSeconds = &e.Duration
+		}
+		out = append(out, o)
+	}
+	return out
+}
+
+// mediaKind returns "audio" or "video" for articles carrying such media, and
+// nil otherwise.
+func mediaKind(encs []db.Enclosure) *string {
+	if k := db.MediaKindOf(encs); k != "" {
+		return &k
+	}
+	return nil
+}
+
+// nullString maps "" to a JSON null.
+func nullString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// fieldChange is the before and after value of one changed article field.
+type fieldChange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// revisionOut describes one upstream change of an article: the fields that
+// differed between the superseded version and its successor.
+type revisionOut struct {
+	ID         int64                  `json:"id"`
+	ReplacedAt string                 `json:"replacedAt"`
+	Changes    map[string]fieldChange `json:"changes"`
+}
+
+// revisionDiffs pairs each superseded version with the version that replaced
+// it (the next revision, or current for the latest) and keeps only the
+// fields that changed. Summary and body are rendered in format.
+func revisionDiffs(revs []db.ArticleRevision, current db.ArticleVersion, format normalize.Format) []revisionOut {
+	out := make([]revisionOut, 0, len(revs))
+	for i, rev := range revs {
+		next := current
+		if i+1 < len(revs) {
+			next = revs[i+1].ArticleVersion
+		}
+		changes := map[string]fieldChange{}
+		add := func(field, from, to string) {
+			if from != to {
+				changes[field] = fieldChange{From: from, To: to}
+			}
+		}
+		add("title", rev.Title, next.Title)
+		add("summary", normalize.Render(rev.Summary, format), normalize.Render(next.Summary, format))
+		add("content", normalize.Render(rev.Content, format), normalize.Render(next.Content, format))
+		add("publishedAt", rev.PublishedAt, next.PublishedAt)
+		out = append(out, revisionOut{ID: rev.ID, ReplacedAt: rev.ReplacedAt, Changes: changes})
+	}
+	return out
+}
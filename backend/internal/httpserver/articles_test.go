@@ -2,13 +2,16 @@ package httpserver
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 	"time"
 
+	"github.com/fujidaiti/poppo-press/backend/internal/db"
 	"github.com/fujidaiti/poppo-press/backend/internal/testutil"
 )
 
@@ -22,7 +25,7 @@ func TestArticlesListDetailAndReadToggle(t *testing.T) {
 		t.Fatalf("insert source: %v", err)
 	}
 	srcID, _ := res.LastInsertId()
-	mustExec(t, db, `INSERT INTO article(id, source_id, canonical_url, title, summary, published_at, created_at, canonical_id) VALUES(?,?,?,?,?,?,?,?)`, 101, srcID, "https://ex/a", "A", "sa", time.Now().Add(-time.Hour).UTC().Format(time.RFC3339), time.Now().UTC().Format(time.RFC3339), "aid-101")
+	mustExec(t, db, `INSERT INTO article(id, source_id, canonical_url, title, summary, content, published_at, created_at, canonical_id) VALUES(?,?,?,?,?,?,?,?,?)`, 101, srcID, "https://ex/a", "A", "sa", "<p>body a</p>", time.Now().Add(-time.Hour).UTC().Format(time.RFC3339), time.Now().UTC().Format(time.RFC3339), "aid-101")
 	mustExec(t, db, `INSERT INTO article(id, source_id, canonical_url, title, summary, published_at, created_at, canonical_id) VALUES(?,?,?,?,?,?,?,?)`, 102, srcID, "https://ex/b", "B", "sb", time.Now().UTC().Format(time.RFC3339), time.Now().UTC().Format(time.RFC3339), "aid-102")
 
 	srv := New(db)
@@ -91,8 +94,9 @@ func TestArticlesListDetailAndReadToggle(t *testing.T) {
 		t.Fatalf("detail status: %d", resp3.StatusCode)
 	}
 	var ad struct {
-		ID     int64 `json:"id"`
-		IsRead bool  `json:"isRead"`
+		ID      int64  `json:"id"`
+		Content string `json:"content"`
+		IsRead  bool   `json:"isRead"`
 	}
 	if err := json.NewDecoder(resp3.Body).Decode(&ad); err != nil {
 		t.Fatalf("decode detail: %v", err)
@@ -101,6 +105,35 @@ func TestArticlesListDetailAndReadToggle(t *testing.T) {
 	if !ad.IsRead {
 		t.Fatalf("expected isRead true, got false")
 	}
+	if ad.Content != "<p>body a</p>" {
+		t.Fatalf("expected article body in detail, got %q", ad.Content)
+	}
+
+	// detail rendered as plain text; unknown formats are rejected
+	reqT, _ := http.NewRequest(http.MethodGet, ts.URL+"/v1/articles/101?format=text", nil)
+	reqT.Header.Set("Authorization", "Bearer "+lr.Token)
+	respT, err := http.DefaultClient.Do(reqT)
+	if err != nil {
+		t.Fatalf("detail text: %v", err)
+	}
+	var at struct {
+		Content string `json:"content"`
+	}
+	_ = json.NewDecoder(respT.Body).Decode(&at)
+	_ = respT.Body.Close()
+	if at.Content != "body a" {
+		t.Fatalf("expected text body, got %q", at.Content)
+	}
+	reqB, _ := http.NewRequest(http.MethodGet, ts.URL+"/v1/articles/101?format=pdf", nil)
+	reqB.Header.Set("Authorization", "Bearer "+lr.Token)
+	respB, err := http.DefaultClient.Do(reqB)
+	if err != nil {
+		t.Fatalf("detail pdf: %v", err)
+	}
+	_ = respB.Body.Close()
+	if respB.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 for unknown format, got %d", respB.StatusCode)
+	}
 
 	// filter read
 	req4, _ := http.NewRequest(http.MethodGet, ts.URL+"/v1/articles?readState=read", nil)
@@ -149,9 +182,120 @@ func TestArticlesListDetailAndReadToggle(t *testing.T) {
 	}
 }
 
+func TestArticlesAndEditions_MediaAndImages(t *testing.T) {
+	database, cleanup := testutil.OpenTestDB(t, "admin-pass")
+	defer cleanup()
+	now := time.Now().UTC().Format(time.RFC3339)
+	mustExec(t, database, "INSERT INTO source(id, url, image_url) VALUES(1, 'https://ex/feed', 'https://ex/logo.png')")
+	for _, id := range []int{201, 202, 203} {
+		mustExec(t, database, `INSERT INTO article(id, source_id, canonical_url, title, published_at, canonical_id) VALUES(?,1,?,?,?,?)`, id, fmt.Sprintf("https://ex/%d", id), "T", now, fmt.Sprintf("aid-%d", id))
+	}
+	mustExec(t, database, "UPDATE article SET image_url = 'https://ex/lead.jpg' WHERE id = 203")
+	ctx := context.Background()
+	if err := db.ReplaceArticleEnclosures(ctx, database, 201, []db.Enclosure{{URL: "https://ex/ep.mp3", MIMEType: "audio/mpeg", Duration: 60, Kind: db.MediaAudio}}); err != nil {
+		t.Fatalf("enclosures: %v", err)
+	}
+	if err := db.ReplaceArticleEnclosures(ctx, database, 202, []db.Enclosure{{URL: "https://ex/v.mp4", Kind: db.MediaVideo}}); err != nil {
+		t.Fatalf("enclosures: %v", err)
+	}
+	mustExec(t, database, "INSERT INTO edition(id, local_date, published_at) VALUES(1, '2025-10-19', ?)", now)
+	for pos, id := range []int{201, 202, 203} {
+		mustExec(t, database, "INSERT INTO edition_article(edition_id, article_id, position) VALUES(1, ?, ?)", id, pos)
+	}
+	ts := httptest.NewServer(New(database).Handler())
+	defer ts.Close()
+	token := loginToken(t, ts.URL)
+
+	type article struct {
+		ID          int64   `json:"id"`
+		ImageURL    *string `json:"imageUrl"`
+		SourceImage *string `json:"sourceImageUrl"`
+		MediaKind   *string `json:"mediaKind"`
+		Enclosures  []struct {
+			URL             string `json:"url"`
+			Kind            string `json:"kind"`
+			DurationSeconds *int64 `json:"durationSeconds"`
+		} `json:"enclosures"`
+	}
+	resp := sendJSON(t, http.MethodGet, ts.URL+"/v1/articles?media=audio", token, nil)
+	var list []article
+	_ = json.NewDecoder(resp.Body).Decode(&list)
+	_ = resp.Body.Close()
+	if len(list) != 1 || list[0].ID != 201 || list[0].MediaKind == nil || *list[0].MediaKind != "audio" {
+		t.Fatalf("audio filter: %+v", list)
+	}
+	if e := list[0].Enclosures; len(e) != 1 || e[0].URL != "https://ex/ep.mp3" || e[0].DurationSeconds == nil || *e[0].DurationSeconds != 60 {
+		t.Fatalf("enclosures: %+v", e)
+	}
+
+	resp = sendJSON(t, http.MethodGet, ts.URL+"/v1/editions/1?media=none", token, nil)
+	var ed struct {
+		Articles []article `json:"articles"`
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&ed)
+	_ = resp.Body.Close()
+	if len(ed.Articles) != 1 || ed.Articles[0].ID != 203 || ed.Articles[0].MediaKind != nil {
+		t.Fatalf("edition media=none: %+v", ed.Articles)
+	}
+	if a := ed.Articles[0]; a.ImageURL == nil || *a.ImageURL != "https://ex/lead.jpg" || a.SourceImage == nil || *a.SourceImage != "https://ex/logo.png" {
+		t.Fatalf("edition images: %+v", a)
+	}
+	if list[0].ImageURL != nil {
+		t.Fatalf("expected no lead image for 201, got %q", *list[0].ImageURL)
+	}
+
+	resp = sendJSON(t, http.MethodGet, ts.URL+"/v1/editions/1?media=podcast", token, nil)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 for unknown media filter, got %d", resp.StatusCode)
+	}
+}
+
 func mustExec(t *testing.T, db *sql.DB, q string, args ...any) {
 	t.Helper()
 	if _, err := db.Exec(q, args...); err != nil {
 		t.Fatalf("exec: %v", err)
 	}
 }
+
+func TestArticles_ListBeyondSQLiteVariableLimit(t *testing.T) {
+	database, cleanup := testutil.OpenTestDB(t, "admin-pass")
+	defer cleanup()
+	const n = 33000 // more ids than SQLite binds in one statement
+	mustExec(t, database, "INSERT INTO source(id, url) VALUES(1, 'https://ex/feed')")
+	mustExec(t, database, `WITH RECURSIVE seq(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM seq WHERE i < ?)
+INSERT INTO article(id, source_id, canonical_url, title, published_at, canonical_id)
+SELECT i, 1, 'https://ex/' || i, 'T', printf('2025-01-01T00:00:%02dZ', i % 60), 'aid-' || i FROM seq`, n)
+	if err := db.ReplaceArticleEnclosures(context.Background(), database, n, []db.Enclosure{{URL: "https://ex/ep.mp3", Kind: db.MediaAudio}}); err != nil {
+		t.Fatalf("enclosures: %v", err)
+	}
+	mustExec(t, database, "INSERT INTO tag(id, name) VALUES(1, 'go')")
+	mustExec(t, database, "INSERT INTO article_tag(article_id, tag_id) VALUES(?, 1)", n)
+	ts := httptest.NewServer(New(database).Handler())
+	defer ts.Close()
+	token := loginToken(t, ts.URL)
+
+	resp := sendJSON(t, http.MethodGet, ts.URL+"/v1/articles", token, nil)
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	var list []struct {
+		ID         int64    `json:"id"`
+		Tags       []string `json:"tags"`
+		Enclosures []struct {
+			URL string `json:"url"`
+		} `json:"enclosures"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(list) != n {
+		t.Fatalf("expected %d articles, got %d", n, len(list))
+	}
+	for _, a := range list {
+		if (a.ID == n) != (len(a.Enclosures) == 1) || (a.ID == n) != (len(a.Tags) == 1) {
+			t.Fatalf("unexpected extras of article %d: %+v %v", a.ID, a.Enclosures, a.Tags)
+		}
+	}
+}
@@ -7,15 +7,18 @@ import (
 	"strconv"
 
 	"github.com/go-chi/chi/v5"
+
+	"github.com/fujidaiti/poppo-press/backend/internal/db"
+	"github.com/fujidaiti/poppo-press/backend/internal/normalize"
 )
 
 func registerEditionRoutes(database *sql.DB, r chi.Router) {
 	r.With(authMiddleware(database)).Route("/editions", func(r chi.Router) {
 		r.Get("/", func(w http.ResponseWriter, r *http.Request) {
 			rows, err := database.QueryContext(r.Context(), `
-SELECT e.id, e.local_date, e.published_at, COUNT(ea.article_id) as cnt
+SELECT e.id, e.local_date, e.slot, e.published_at, e.cutoff_at, COUNT(ea.article_id) as cnt
 FROM edition e LEFT JOIN edition_article ea ON e.id = ea.edition_id
-GROUP BY e.id, e.local_date, e.published_at
+GROUP BY e.id, e.local_date, e.slot, e.published_at, e.cutoff_at
 ORDER BY e.id DESC`)
 			if err != nil {
 				writeError(w, http.StatusInternalServerError, "internal", "list fail")
@@ -24,20 +27,25 @@ ORDER BY e.id DESC`)
 			type out struct {
 				ID           int64   `json:"id"`
 				LocalDate    string  `json:"localDate"`
+				Slot         string  `json:"slot"`
 				PublishedAt  *string `json:"publishedAt"`
+				CutoffAt     *string `json:"cutoffAt"`
 				ArticleCount int     `json:"articleCount"`
 			}
 			var list []out
 			for rows.Next() {
 				var o out
-				var pub sql.NullString
-				if err := rows.Scan(&o.ID, &o.LocalDate, &pub, &o.ArticleCount); err != nil {
+				var pub, cutoff sql.NullString
+				if err := rows.Scan(&o.ID, &o.LocalDate, &o.Slot, &pub, &cutoff, &o.ArticleCount); err != nil {
 					writeError(w, http.StatusInternalServerError, "internal", "scan fail")
 					return
 				}
 				if pub.Valid {
 					o.PublishedAt = &pub.String
 				}
+				if cutoff.Valid {
+					o.CutoffAt = &cutoff.String
+				}
 				list = append(list, o)
 			}
 			_ = rows.Err()
@@ -52,10 +60,23 @@ ORDER BY e.id DESC`)
 				writeError(w, http.StatusBadRequest, "bad_request", "invalid id")
 				return
 			}
-			var localDate string
-			var publishedAt *string
-			var pub sql.NullString
-			if err := database.QueryRowContext(r.Context(), `SELECT local_date, published_at FROM edition WHERE id = ?`, id).Scan(&localDate, &pub); err != nil {
+			format, ok := bodyFormat(w, r)
+			if !ok {
+				return
+			}
+			media, ok := mediaFilter(w, r)
+			if !ok {
+				return
+			}
+			view := r.URL.Query().Get("view")
+			if view != "" && view != "list" && view != "clusters" {
+				writeError(w, http.StatusBadRequest, "bad_request", "view must be list or clusters")
+				return
+			}
+			var localDate, slot string
+			var publishedAt, cutoffAt *string
+			var pub, cutoff sql.NullString
+			if err := database.QueryRowContext(r.Context(), `SELECT local_date, slot, published_at, cutoff_at FROM edition WHERE id = ?`, id).Scan(&localDate, &slot, &pub, &cutoff); err != nil {
 				writeError(w, http.StatusNotFound, "not_found", "edition not found")
 				return
 			}
@@ -63,37 +84,95 @@ ORDER BY e.id DESC`)
 				v := pub.String
 				publishedAt = &v
 			}
-			rows, err := database.QueryContext(r.Context(), `
-SELECT a.id, a.source_id, a.canonical_url, a.title, a.summary, a.author, a.published_at
-FROM edition_article ea JOIN article a ON ea.article_id = a.id
-WHERE ea.edition_id = ? ORDER BY ea.position`, id)
+			if cutoff.Valid {
+				cutoffAt = &cutoff.String
+			}
+			list, err := db.ListEditionArticles(r.Context(), database, id, media)
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, "internal", "query fail")
+				return
+			}
+			encs, tags, err := articleExtras(r, database, list)
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, "internal", "query fail")
+				return
+			}
+			alts, err := db.ListEditionAlternates(r.Context(), database, id)
 			if err != nil {
 				writeError(w, http.StatusInternalServerError, "internal", "query fail")
 				return
 			}
 			type art struct {
-				ID           int64  `json:"id"`
-				SourceID     int64  `json:"sourceId"`
-				CanonicalURL string `json:"canonicalUrl"`
-				Title        string `json:"title"`
-				Summary      string `json:"summary"`
-				Author       string `json:"author"`
-				PublishedAt  string `json:"publishedAt"`
-			}
-			var arts []art
-			for rows.Next() {
-				var a art
-				if err := rows.Scan(&a.ID, &a.SourceID, &a.CanonicalURL, &a.Title, &a.Summary, &a.Author, &a.PublishedAt); err != nil {
-					writeError(w, http.StatusInternalServerError, "internal", "scan fail")
-					return
-				}
-				arts = append(arts, a)
+				ID           int64          `json:"id"`
+				SourceID     int64          `json:"sourceId"`
+				CanonicalURL string         `json:"canonicalUrl"`
+				Title        string         `json:"title"`
+				Summary      string         `json:"summary"`
+				Author       string         `json:"author"`
+				PublishedAt  string         `json:"publishedAt"`
+				ImageURL     *string        `json:"imageUrl"`
+				SourceImage  *string        `json:"sourceImageUrl"`
+				Tags         []string       `json:"tags"`
+				MediaKind    *string        `json:"mediaKind"`
+				Enclosures   []enclosureOut `json:"enclosures"`
+				Alternates   []alternateOut `json:"alternates"`
+				ClusterID    int64          `json:"clusterId"`
+			}
+			arts := make([]art, 0, len(list))
+			for _, a := range list {
+				arts = append(arts, art{ID: a.ID, SourceID: a.SourceID, CanonicalURL: a.CanonicalURL, Title: a.Title, Summary: normalize.Render(a.Summary, format), Author: a.Author, PublishedAt: a.PublishedAt, ImageURL: nullString(a.ImageURL), SourceImage: nullString(a.SourceImage), Tags: tagList(tags[a.ID]), MediaKind: mediaKind(encs[a.ID]), Enclosures: toEnclosureOut(encs[a.ID]), Alternates: toAlternateOut(alts[a.ID]), ClusterID: a.ClusterID})
 			}
-			_ = rows.Err()
 			w.Header().Set("Content-Type", "application/json")
+			if view != "clusters" {
+				_ = json.NewEncoder(w).Encode(map[string]any{
+					"id": id, "localDate": localDate, "slot": slot, "publishedAt": publishedAt, "cutoffAt": cutoffAt, "articles": arts,
+				})
+				return
+			}
+			// Clusters keep the order of their first entry. The primary is the
+			// cluster's own article, or its first entry left by the media filter.
+			type cluster struct {
+				ID      int64 `json:"id"`
+				Primary art   `json:"primary"`
+				Related []art `json:"related"`
+			}
+			clusters := []*cluster{}
+			byID := map[int64]*cluster{}
+			for _, a := range arts {
+				c, ok := byID[a.ClusterID]
+				if !ok {
+					c = &cluster{ID: a.ClusterID, Primary: a, Related: []art{}}
+					byID[a.ClusterID] = c
+					clusters = append(clusters, c)
+					continue
+				}
+				if a.ID == a.ClusterID {
+					c.Related = append([]art{c.Primary}, c.Related...)
+					c.Primary = a
+					continue
+				}
+				c.Related = append(c.Related, a)
+			}
 			_ = json.NewEncoder(w).Encode(map[string]any{
-				"id": id, "localDate": localDate, "publishedAt": publishedAt, "articles": arts,
+				"id": id, "localDate": localDate, "slot": slot, "publishedAt": publishedAt, "cutoffAt": cutoffAt, "clusters": clusters,
 			})
 		})
 	})
 }
+
+// alternateOut is the JSON form of db.Alternate.
+type alternateOut struct {
+	ArticleID   int64   `json:"articleId"`
+	SourceID    int64   `json:"sourceId"`
+	SourceTitle *string `json:"sourceTitle"`
+	URL         string  `json:"url"`
+}
+
+// toAlternateOut converts alternates for JSON, never returning nil.
+func toAlternateOut(alts []db.Alternate) []alternateOut {
+	out := make([]alternateOut, 0, len(alts))
+	for _, a := range alts {
+		out = append(out, alternateOut{ArticleID: a.ArticleID, SourceID: a.SourceID, SourceTitle: nullString(a.SourceTitle), URL: a.URL})
+	}
+	return out
+}
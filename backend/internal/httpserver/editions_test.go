@@ -0,0 +1,63 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/fujidaiti/poppo-press/backend/internal/testutil"
+)
+
+func TestEditionClustersView(t *testing.T) {
+	database, cleanup := testutil.OpenTestDB(t, "admin-pass")
+	defer cleanup()
+	now := time.Now().UTC().Format(time.RFC3339)
+	mustExec(t, database, "INSERT INTO source(id, url) VALUES(1, 'https://ex/feed')")
+	mustExec(t, database, "INSERT INTO edition(id, local_date, published_at) VALUES(1, '2025-10-19', ?)", now)
+	// 402 and 404 cover the story whose primary is 403; 401 stands alone
+	for pos, e := range [][2]int64{{402, 403}, {401, 401}, {403, 403}, {404, 403}} {
+		mustExec(t, database, `INSERT INTO article(id, source_id, canonical_url, title, published_at, canonical_id) VALUES(?,1,?,'T',?,?)`,
+			e[0], "https://ex/"+itoa(e[0]), now, "aid-"+itoa(e[0]))
+		mustExec(t, database, "INSERT INTO edition_article(edition_id, article_id, position, cluster_id) VALUES(1, ?, ?, ?)", e[0], pos+1, e[1])
+	}
+	ts := httptest.NewServer(New(database).Handler())
+	defer ts.Close()
+	token := loginToken(t, ts.URL)
+
+	resp := sendJSON(t, http.MethodGet, ts.URL+"/v1/editions/1?view=clusters", token, nil)
+	var ed struct {
+		Slot     string `json:"slot"`
+		Clusters []struct {
+			ID      int64 `json:"id"`
+			Primary struct {
+				ID int64 `json:"id"`
+			} `json:"primary"`
+			Related []struct {
+				ID int64 `json:"id"`
+			} `json:"related"`
+		} `json:"clusters"`
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&ed)
+	_ = resp.Body.Close()
+	if ed.Slot != "daily" {
+		t.Fatalf("expected the daily slot, got %q", ed.Slot)
+	}
+	if len(ed.Clusters) != 2 {
+		t.Fatalf("expected 2 clusters, got %+v", ed.Clusters)
+	}
+	c := ed.Clusters[0]
+	if c.ID != 403 || c.Primary.ID != 403 || len(c.Related) != 2 || c.Related[0].ID != 402 || c.Related[1].ID != 404 {
+		t.Fatalf("unexpected first cluster: %+v", c)
+	}
+	if c := ed.Clusters[1]; c.Primary.ID != 401 || len(c.Related) != 0 {
+		t.Fatalf("unexpected second cluster: %+v", c)
+	}
+
+	resp = sendJSON(t, http.MethodGet, ts.URL+"/v1/editions/1?view=tree", token, nil)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 for bad view, got %d", resp.StatusCode)
+	}
+}
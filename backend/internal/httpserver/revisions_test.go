@@ -0,0 +1,91 @@
+package httpserver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/fujidaiti/poppo-press/backend/internal/db"
+	"github.com/fujidaiti/poppo-press/backend/internal/testutil"
+)
+
+func TestArticleRevisionsAndUpdatedFlag(t *testing.T) {
+	database, cleanup := testutil.OpenTestDB(t, "admin-pass")
+	defer cleanup()
+	ctx := context.Background()
+	mustExec(t, database, "INSERT INTO source(id, url) VALUES(1, 'https://ex/feed')")
+	now := time.Now().UTC()
+	upsert := func(title, summary string, at time.Time) int64 {
+		t.Helper()
+		id, err := db.UpsertArticleByCanonicalID(ctx, database, db.UpsertArticleParams{
+			SourceID: 1, CanonicalURL: "https://ex/a", Title: title, Summary: summary,
+			PublishedAt: now.Add(-time.Hour).Format(time.RFC3339), UpdatedAt: at.Format(time.RFC3339), CanonicalID: "aid-a",
+		})
+		if err != nil {
+			t.Fatalf("upsert: %v", err)
+		}
+		return id
+	}
+	id := upsert("Launch", "<p>first</p>", now.Add(-time.Hour))
+	// an identical refetch is not a revision
+	upsert("Launch", "<p>first</p>", now.Add(-time.Hour))
+
+	ts := httptest.NewServer(New(database).Handler())
+	defer ts.Close()
+	token := loginToken(t, ts.URL)
+	resp := sendJSON(t, http.MethodPost, ts.URL+"/v1/articles/"+itoa(id)+"/read", token, map[string]bool{"isRead": true})
+	_ = resp.Body.Close()
+	mustExec(t, database, "UPDATE read_state SET updated_at = datetime('now', '-10 minutes')")
+
+	upsert("Launch (corrected)", "<p>second</p>", now)
+
+	resp = sendJSON(t, http.MethodGet, ts.URL+"/v1/articles/"+itoa(id), token, nil)
+	var art struct {
+		Updated   bool    `json:"updated"`
+		RevisedAt *string `json:"revisedAt"`
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&art)
+	_ = resp.Body.Close()
+	if !art.Updated || art.RevisedAt == nil {
+		t.Fatalf("expected updated article, got %+v", art)
+	}
+
+	resp = sendJSON(t, http.MethodGet, ts.URL+"/v1/articles/"+itoa(id)+"/revisions?format=text", token, nil)
+	var revs []struct {
+		ReplacedAt string `json:"replacedAt"`
+		Changes    map[string]struct {
+			From string `json:"from"`
+			To   string `json:"to"`
+		} `json:"changes"`
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&revs)
+	_ = resp.Body.Close()
+	if len(revs) != 1 || len(revs[0].Changes) != 2 {
+		t.Fatalf("unexpected revisions: %+v", revs)
+	}
+	if c := revs[0].Changes["title"]; c.From != "Launch" || c.To != "Launch (corrected)" {
+		t.Fatalf("unexpected title change: %+v", c)
+	}
+	if c := revs[0].Changes["summary"]; c.From != "first" || c.To != "second" {
+		t.Fatalf("unexpected summary change: %+v", c)
+	}
+
+	// reading the new version clears the flag
+	resp = sendJSON(t, http.MethodPost, ts.URL+"/v1/articles/"+itoa(id)+"/read", token, map[string]bool{"isRead": true})
+	_ = resp.Body.Close()
+	resp = sendJSON(t, http.MethodGet, ts.URL+"/v1/articles/"+itoa(id), token, nil)
+	_ = json.NewDecoder(resp.Body).Decode(&art)
+	_ = resp.Body.Close()
+	if art.Updated {
+		t.Fatalf("expected flag cleared after re-reading")
+	}
+
+	resp = sendJSON(t, http.MethodGet, ts.URL+"/v1/articles/999/revisions", token, nil)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", resp.StatusCode)
+	}
+}
@@ -5,6 +5,7 @@ package httpserver
 import (
 	"context"
 	"encoding/json"
+	"log"
 	"net/http"
 	"time"
 
@@ -14,7 +15,11 @@ import (
 	"database/sql"
 
 	"github.com/fujidaiti/poppo-press/backend/internal/auth"
+	"github.com/fujidaiti/poppo-press/backend/internal/credentials"
 	"github.com/fujidaiti/poppo-press/backend/internal/db"
+	"github.com/fujidaiti/poppo-press/backend/internal/discovery"
+	"github.com/fujidaiti/poppo-press/backend/internal/fetcher"
+	"github.com/fujidaiti/poppo-press/backend/internal/httpclient"
 	"github.com/fujidaiti/poppo-press/backend/internal/version"
 )
 
@@ -22,19 +27,99 @@ import (
 // It is responsible for wiring health and version routes and returning the
 // http.Handler used by the HTTP server.
 type Server struct {
-	mux *chi.Mux
-	db  *sql.DB
+	mux      *chi.Mux
+	db       *sql.DB
+	client   *http.Client
+	box      *credentials.Box
+	backfill *fetcher.Options // nil unless sources are fetched when added
+	rewriter *discovery.Rewriter
+	maxPush  int64 // bound of WebSub push bodies
+}
+
+// Option customizes a Server built by New.
+type Option func(*Server)
+
+// WithHTTPClient sets the client used for outbound requests, such as probing
+// feeds when a source is added (default httpclient.Default()).
+func WithHTTPClient(client *http.Client) Option {
+	return func(s *Server) { s.client = client }
+}
+
+// WithCredentials sets the box sealing source credentials. Without it,
+// sources cannot be added with credentials.
+func WithCredentials(box *credentials.Box) Option {
+	return func(s *Server) { s.box = box }
+}
+
+// WithRewriter sets the rules mapping web URLs of well-known sites to their
+// feeds when sources are added (default: the built-in rules).
+func WithRewriter(rw *discovery.Rewriter) Option {
+	return func(s *Server) { s.rewriter = rw }
+}
+
+// WithMaxPushBody bounds the size of feeds pushed by WebSub hubs, as
+// outbound responses are bounded (default httpclient.DefaultMaxBodyBytes).
+func WithMaxPushBody(n int64) Option {
+	return func(s *Server) { s.maxPush = n }
+}
+
+// WithBackfill makes the server fetch each source right after it is added,
+// in the background, walking its feed archive as bounded by opts (see
+// fetcher.Backfill). Without it, new sources wait for their first poll.
+func WithBackfill(opts fetcher.Options) Option {
+	return func(s *Server) { s.backfill = &opts }
+}
+
+// backfillTimeout bounds a background backfill.
+const backfillTimeout = 10 * time.Minute
+
+// backfillHold is how long a new source stays off the polling schedule so
+// that the scheduler does not fetch it while its backfill does: as long as
+// a backfill may run, or not at all without WithBackfill. The backfill's
+// first fetch schedules the next regular poll.
+func (s *Server) backfillHold() time.Duration {
+	if s.backfill == nil {
+		return 0
+	}
+	return backfillTimeout
+}
+
+// startBackfill runs fetcher.Backfill for a new source in the background.
+// It is a no-op unless WithBackfill was given.
+func (s *Server) startBackfill(id int64) {
+	if s.backfill == nil {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), backfillTimeout)
+		defer cancel()
+		if err := fetcher.Backfill(ctx, s.db, s.client, *s.backfill, id); err != nil {
+			log.Printf("backfill source %d: %v", id, err)
+		}
+	}()
 }
 
 // New constructs a Server with standard middleware (RealIP, RequestID, Logger,
 // Recoverer) and registers the /health and /version endpoints.
-func New(database *sql.DB) *Server {
+func New(database *sql.DB, opts ...Option) *Server {
+	s := &Server{db: database}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.client == nil {
+		s.client = httpclient.Default()
+	}
+	if s.rewriter == nil {
+		s.rewriter = discovery.NewRewriter(nil)
+	}
+	if s.maxPush <= 0 {
+		s.maxPush = httpclient.DefaultMaxBodyBytes
+	}
 	r := chi.NewRouter()
 	r.Use(middleware.RealIP)
 	r.Use(middleware.RequestID)
 	r.Use(jsonLogger)
 	r.Use(middleware.Recoverer)
-	r.Use(limitBody(1 << 20)) // 1MB
 
 	r.Get("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
@@ -53,76 +138,86 @@ func New(database *sql.DB) *Server {
 
 	// v1 routes
 	r.Route("/v1", func(r chi.Router) {
-		r.Route("/auth", func(r chi.Router) {
-			// Rate limit login per IP: 5 requests per minute
-			rl := newRateLimiter(5, time.Minute)
-			r.With(rl.Middleware).Post("/login", func(w http.ResponseWriter, r *http.Request) {
-				type req struct{ Username, Password, DeviceName string }
-				var body req
-				if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-					writeError(w, http.StatusBadRequest, "bad_request", "invalid json")
-					return
-				}
-				if body.Username == "" || body.Password == "" || body.DeviceName == "" {
-					writeError(w, http.StatusBadRequest, "validation_failed", "missing fields")
-					return
-				}
-				phc, err := db.GetUserPasswordHash(r.Context(), database, body.Username)
-				if err != nil || phc == "" {
-					writeError(w, http.StatusUnauthorized, "unauthorized", "invalid credentials")
-					return
-				}
-				ok, _ := auth.VerifyPassword(body.Password, phc)
-				if !ok {
-					writeError(w, http.StatusUnauthorized, "unauthorized", "invalid credentials")
-					return
-				}
-				token, err := auth.GenerateToken()
-				if err != nil {
-					writeError(w, http.StatusInternalServerError, "internal", "failed to generate token")
-					return
-				}
-				id, err := db.CreateOrUpdateDeviceToken(r.Context(), database, body.DeviceName, auth.HashToken(token))
-				if err != nil {
-					writeError(w, http.StatusInternalServerError, "internal", "failed to persist token")
-					return
-				}
-				w.Header().Set("Content-Type", "application/json")
-				_ = json.NewEncoder(w).Encode(map[string]any{"token": token, "deviceId": id})
+		r.Group(func(r chi.Router) {
+			r.Use(limitBody(1 << 20)) // 1MB
+			r.Route("/auth", func(r chi.Router) {
+				// Rate limit login per IP: 5 requests per minute
+				rl := newRateLimiter(5, time.Minute)
+				r.With(rl.Middleware).Post("/login", func(w http.ResponseWriter, r *http.Request) {
+					type req struct{ Username, Password, DeviceName string }
+					var body req
+					if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+						writeError(w, http.StatusBadRequest, "bad_request", "invalid json")
+						return
+					}
+					if body.Username == "" || body.Password == "" || body.DeviceName == "" {
+						writeError(w, http.StatusBadRequest, "validation_failed", "missing fields")
+						return
+					}
+					phc, err := db.GetUserPasswordHash(r.Context(), database, body.Username)
+					if err != nil || phc == "" {
+						writeError(w, http.StatusUnauthorized, "unauthorized", "invalid credentials")
+						return
+					}
+					ok, _ := auth.VerifyPassword(body.Password, phc)
+					if !ok {
+						writeError(w, http.StatusUnauthorized, "unauthorized", "invalid credentials")
+						return
+					}
+					token, err := auth.GenerateToken()
+					if err != nil {
+						writeError(w, http.StatusInternalServerError, "internal", "failed to generate token")
+						return
+					}
+					id, err := db.CreateOrUpdateDeviceToken(r.Context(), database, body.DeviceName, auth.HashToken(token))
+					if err != nil {
+						writeError(w, http.StatusInternalServerError, "internal", "failed to persist token")
+						return
+					}
+					w.Header().Set("Content-Type", "application/json")
+					_ = json.NewEncoder(w).Encode(map[string]any{"token": token, "deviceId": id})
+				})
+				r.With(authMiddleware(database)).Post("/logout", func(w http.ResponseWriter, r *http.Request) {
+					devID := r.Context().Value(ctxDeviceID{}).(int64)
+					if err := db.RevokeDeviceToken(r.Context(), database, devID); err != nil {
+						writeError(w, http.StatusInternalServerError, "internal", "failed to revoke")
+						return
+					}
+					w.WriteHeader(http.StatusNoContent)
+				})
 			})
-			r.With(authMiddleware(database)).Post("/logout", func(w http.ResponseWriter, r *http.Request) {
-				devID := r.Context().Value(ctxDeviceID{}).(int64)
-				if err := db.RevokeDeviceToken(r.Context(), database, devID); err != nil {
-					writeError(w, http.StatusInternalServerError, "internal", "failed to revoke")
-					return
-				}
-				w.WriteHeader(http.StatusNoContent)
+
+			// protected test route for M2 DoD
+			r.With(authMiddleware(database)).Get("/protected/ping", func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				_ = json.NewEncoder(w).Encode(map[string]string{"pong": "ok"})
 			})
-		})
 
-		// protected test route for M2 DoD
-		r.With(authMiddleware(database)).Get("/protected/ping", func(w http.ResponseWriter, r *http.Request) {
-			w.Header().Set("Content-Type", "application/json")
-			_ = json.NewEncoder(w).Encode(map[string]string{"pong": "ok"})
-		})
+			// M3 Sources API
+			registerSourcesRoutes(database, s.client, s.box, s.rewriter, s.backfillHold(), s.startBackfill, r)
+
+			// M5 Editions API
+			registerEditionRoutes(database, r)
 
-		// M3 Sources API
-		registerSourcesRoutes(database, r)
+			// M6 Articles API
+			registerArticleRoutes(database, r)
 
-		// M5 Editions API
-		registerEditionRoutes(database, r)
+			// Tags derived from feed categories
+			registerTagRoutes(database, r)
 
-		// M6 Articles API
-		registerArticleRoutes(database, r)
+			// M7 Read Later API
+			registerReadLaterRoutes(database, r)
 
-		// M7 Read Later API
-		registerReadLaterRoutes(database, r)
+			// M8 Devices API
+			registerDeviceRoutes(database, r)
+		})
 
-		// M8 Devices API
-		registerDeviceRoutes(database, r)
+		// WebSub hub callbacks (public), bounded like fetched feeds
+		registerWebSubRoutes(database, s.maxPush, r)
 	})
 
-	return &Server{mux: r, db: database}
+	s.mux = r
+	return s
 }
 
 // Handler returns the underlying http.Handler to serve requests.
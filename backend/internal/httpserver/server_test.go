@@ -87,7 +87,7 @@ func TestSourcesAPI(t *testing.T) {
 	db, cleanup := testutil.OpenTestDB(t, "admin-pass")
 	defer cleanup()
 
-	srv := New(db)
+	srv := New(db, WithHTTPClient(testutil.HTTPClient(t)))
 	ts := httptest.NewServer(srv.Handler())
 	defer ts.Close()
 
@@ -195,6 +195,18 @@ func TestSourcesAPI(t *testing.T) {
 		t.Fatalf("headers mismatch: %q %q", gotETag, gotLM)
 	}
 
+	mustExec(t, db, "INSERT INTO source_alias(url, source_id, created_at) VALUES('https://old.example/feed', ?, '2025-01-01T00:00:00Z')", cr.ID)
+	mustExec(t, db, "INSERT INTO source_event(source_id, kind, detail, created_at) VALUES(?, 'moved', 'x', '2025-01-01T00:00:00Z')", cr.ID)
+	mustExec(t, db, "INSERT INTO article(id, source_id, canonical_url, title, published_at) VALUES(900, ?, 'https://example.com/a', 'A', '2025-01-01T00:00:00Z')", cr.ID)
+	mustExec(t, db, "INSERT INTO article_enclosure(article_id, url) VALUES(900, 'https://example.com/a.mp3')")
+	mustExec(t, db, "INSERT INTO tag(id, name) VALUES(900, 'go')")
+	mustExec(t, db, "INSERT INTO article_tag(article_id, tag_id) VALUES(900, 900)")
+	mustExec(t, db, "INSERT INTO article_revision(article_id, title, replaced_at) VALUES(900, 'old', '2025-01-01T00:00:00Z')")
+	mustExec(t, db, "INSERT INTO edition(id, local_date) VALUES(900, '2025-01-01')")
+	mustExec(t, db, "INSERT INTO edition_article(edition_id, article_id, position) VALUES(900, 900, 0)")
+	mustExec(t, db, "INSERT INTO edition_alternate(edition_id, article_id, alternate_id) VALUES(900, 900, 901)")
+	mustExec(t, db, "INSERT INTO bookmark(article_id) VALUES(900)")
+
 	// DELETE
 	req5, _ := http.NewRequest(http.MethodDelete, fmt.Sprintf(ts.URL+"/v1/sources/%d", cr.ID), nil)
 	req5.Header.Set("Authorization", "Bearer "+lr.Token)
@@ -225,6 +237,23 @@ func TestSourcesAPI(t *testing.T) {
 	if len(list2) != 0 {
 		t.Fatalf("expected empty, got %d", len(list2))
 	}
+	// nothing referring to the source is left behind
+	for _, table := range []string{"source_health", "source_alias", "source_event", "websub_subscription", "source_credential", "source_backfill"} {
+		var n int
+		if err := db.QueryRow("SELECT COUNT(1) FROM "+table+" WHERE source_id = ?", cr.ID).Scan(&n); err != nil || n != 0 {
+			t.Fatalf("%s: %d rows left (%v)", table, n, err)
+		}
+	}
+	for _, table := range []string{"article_enclosure", "article_tag", "article_revision", "edition_article", "edition_alternate", "bookmark"} {
+		var n int
+		if err := db.QueryRow("SELECT COUNT(1) FROM " + table + " WHERE article_id = 900").Scan(&n); err != nil || n != 0 {
+			t.Fatalf("%s: %d rows left (%v)", table, n, err)
+		}
+	}
+	var n int
+	if err := db.QueryRow("SELECT COUNT(1) FROM article WHERE source_id = ?", cr.ID).Scan(&n); err != nil || n != 0 {
+		t.Fatalf("article: %d rows left (%v)", n, err)
+	}
 }
 
 func querySourceHeaders(t *testing.T, database *sql.DB, id int64, etag, lastMod *string) error {
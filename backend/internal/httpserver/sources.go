@@ -1,6 +1,7 @@
 package httpserver
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
@@ -10,39 +11,168 @@ import (
 	"time"
 
 	"github.com/go-chi/chi/v5"
-	"github.com/mmcdole/gofeed"
 
 	"database/sql"
 
+	"github.com/fujidaiti/poppo-press/backend/internal/credentials"
 	"github.com/fujidaiti/poppo-press/backend/internal/db"
+	"github.com/fujidaiti/poppo-press/backend/internal/discovery"
+	"github.com/fujidaiti/poppo-press/backend/internal/fetcher"
+	"github.com/fujidaiti/poppo-press/backend/internal/httpclient"
+	"github.com/fujidaiti/poppo-press/backend/internal/scrape"
 )
 
-func registerSourcesRoutes(database *sql.DB, r chi.Router) {
+// registerSourcesRoutes mounts the sources API. Feed URLs are rewritten by
+// rw before probing; added is called with the id of each source created,
+// which is kept off the polling schedule for hold so that a fetch started by
+// added does not race the scheduler's.
+func registerSourcesRoutes(database *sql.DB, client *http.Client, box *credentials.Box, rw *discovery.Rewriter, hold time.Duration, added func(id int64), r chi.Router) {
 	r.With(authMiddleware(database)).Route("/sources", func(r chi.Router) {
 		r.Post("/", func(w http.ResponseWriter, r *http.Request) {
-			type req struct{ URL string }
-			var body req
+			var body struct {
+				sourceRequest
+				ContentMode string `json:"contentMode"`
+			}
 			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
 				writeError(w, http.StatusBadRequest, "bad_request", "invalid json")
 				return
 			}
-			if !isValidHTTPURL(body.URL) {
-				writeError(w, http.StatusBadRequest, "validation_failed", "invalid url")
+			if body.ContentMode == "" {
+				body.ContentMode = db.ContentModeFeed
+			}
+			if body.ContentMode != db.ContentModeFeed && body.ContentMode != db.ContentModeExtract {
+				writeError(w, http.StatusBadRequest, "validation_failed", "invalid contentMode")
 				return
 			}
-			title, etag, lastMod, err := probeFeed(r.Context(), body.URL)
-			if err != nil {
-				writeError(w, http.StatusBadRequest, "validation_failed", "unreachable or invalid feed")
+			probeClient, msg := body.prepare(client, box, rw)
+			if msg != "" {
+				writeError(w, http.StatusBadRequest, "validation_failed", msg)
+				return
+			}
+			if _, found, err := db.FindSourceByURL(r.Context(), database, body.URL); err != nil {
+				writeError(w, http.StatusInternalServerError, "internal", "failed to check source")
 				return
+			} else if found {
+				writeError(w, http.StatusConflict, "conflict", "source already exists")
+				return
+			}
+			params := db.CreateSourceParams{URL: body.URL, ContentMode: body.ContentMode, Kind: body.Kind}
+			if body.Kind == db.SourceKindScrape {
+				feed, err := scrape.Fetch(r.Context(), probeClient, body.URL, *body.Scrape)
+				if err != nil {
+					writeError(w, http.StatusBadRequest, "validation_failed", probeErrorMessage(err))
+					return
+				}
+				cfg, _ := json.Marshal(body.Scrape)
+				params.Title, params.Config = feed.Title, string(cfg)
+			} else if _, ok := fetcher.Adapter(body.Kind); ok {
+				res, err := fetcher.ProbeAdapter(r.Context(), probeClient, body.Kind, body.URL, body.Config)
+				if err != nil {
+					writeError(w, http.StatusBadRequest, "validation_failed", probeErrorMessage(err))
+					return
+				}
+				params.Title, params.Config = res.Title, string(body.Config)
+			} else {
+				feed, candidates, err := probeFeed(r.Context(), probeClient, body.URL)
+				if err != nil && body.OriginalURL != body.URL {
+					// the site may not be what the rewrite rule took it for
+					feed, candidates, err = probeFeed(r.Context(), probeClient, body.OriginalURL)
+				}
+				if err != nil {
+					writeError(w, http.StatusBadRequest, "validation_failed", probeErrorMessage(err))
+					return
+				}
+				if feed == nil {
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(http.StatusMultipleChoices)
+					_ = json.NewEncoder(w).Encode(map[string]any{
+						"error":      map[string]any{"code": "multiple_feeds", "message": "the page offers several feeds; add one of the candidates"},
+						"candidates": candidates,
+					})
+					return
+				}
+				if _, found, err := db.FindSourceByURL(r.Context(), database, feed.URL); err != nil {
+					writeError(w, http.StatusInternalServerError, "internal", "failed to check source")
+					return
+				} else if found {
+					writeError(w, http.StatusConflict, "conflict", "source already exists")
+					return
+				}
+				params.URL, params.Title, params.ETag, params.LastModified = feed.URL, feed.Title, feed.ETag, feed.LastModified
+			}
+			if cred := body.Auth; cred != nil {
+				params.AuthType = cred.Type
+				params.SealCredential = func(id int64) ([]byte, error) { return box.Seal(id, *cred) }
 			}
-			id, err := db.CreateSource(r.Context(), database, body.URL, title, etag, lastMod)
+			if hold > 0 {
+				params.HoldUntil = time.Now().Add(hold)
+			}
+			id, err := db.CreateSource(r.Context(), database, params)
 			if err != nil {
 				writeError(w, http.StatusInternalServerError, "internal", "failed to persist source")
 				return
 			}
+			added(id)
 			w.Header().Set("Content-Type", "application/json")
 			w.WriteHeader(http.StatusCreated)
-			_ = json.NewEncoder(w).Encode(map[string]any{"id": id})
+			_ = json.NewEncoder(w).Encode(map[string]any{"id": id, "url": params.URL, "originalUrl": body.OriginalURL})
+		})
+
+		// preview shows the items a scraper or adapter configuration
+		// yields, so that it can be tried out before the source is added
+		r.Post("/preview", func(w http.ResponseWriter, r *http.Request) {
+			var body sourceRequest
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				writeError(w, http.StatusBadRequest, "bad_request", "invalid json")
+				return
+			}
+			if body.Kind == "" {
+				body.Kind = db.SourceKindScrape
+			}
+			if body.Kind == db.SourceKindFeed {
+				writeError(w, http.StatusBadRequest, "validation_failed", "feed sources cannot be previewed")
+				return
+			}
+			probeClient, msg := body.prepare(client, box, rw)
+			if msg != "" {
+				writeError(w, http.StatusBadRequest, "validation_failed", msg)
+				return
+			}
+			type item struct {
+				Title       string  `json:"title"`
+				URL         *string `json:"url"`
+				PublishedAt *string `json:"publishedAt"`
+				Summary     *string `json:"summary"`
+			}
+			if body.Kind != db.SourceKindScrape {
+				res, err := fetcher.ProbeAdapter(r.Context(), probeClient, body.Kind, body.URL, body.Config)
+				if err != nil {
+					writeError(w, http.StatusBadRequest, "validation_failed", probeErrorMessage(err))
+					return
+				}
+				items := make([]item, 0, len(res.Articles))
+				for _, a := range res.Articles {
+					items = append(items, item{Title: a.Title, URL: nullString(a.CanonicalURL), PublishedAt: nullString(a.PublishedAt), Summary: nullString(a.Summary)})
+				}
+				w.Header().Set("Content-Type", "application/json")
+				_ = json.NewEncoder(w).Encode(map[string]any{"title": res.Title, "items": items})
+				return
+			}
+			feed, err := scrape.Fetch(r.Context(), probeClient, body.URL, *body.Scrape)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, "validation_failed", probeErrorMessage(err))
+				return
+			}
+			items := make([]item, 0, len(feed.Items))
+			for _, it := range feed.Items {
+				var published string
+				if it.PublishedParsed != nil {
+					published = it.PublishedParsed.UTC().Format(time.RFC3339)
+				}
+				items = append(items, item{Title: it.Title, URL: nullString(it.Link), PublishedAt: nullString(published), Summary: nullString(it.Description)})
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(map[string]any{"title": feed.Title, "items": items})
 		})
 
 		r.Get("/", func(w http.ResponseWriter, r *http.Request) {
@@ -51,20 +181,140 @@ func registerSourcesRoutes(database *sql.DB, r chi.Router) {
 				writeError(w, http.StatusInternalServerError, "internal", "failed to list sources")
 				return
 			}
-			type out struct {
-				ID        int64  `json:"id"`
-				URL       string `json:"url"`
-				Title     string `json:"title"`
+			type health struct {
+				LastAttemptAt       *string `json:"lastAttemptAt"`
+				LastSuccessAt       *string `json:"lastSuccessAt"`
+				ConsecutiveFailures int     `json:"consecutiveFailures"`
+				LastErrorClass      *string `json:"lastErrorClass"`
+				LastErrorMessage    *string `json:"lastErrorMessage"`
+				NextFetchAt         *string `json:"nextFetchAt"`
+			}
+			type push struct {
+				HubURL         string  `json:"hubUrl"`
+				State          string  `json:"state"`
+				LeaseExpiresAt *string `json:"leaseExpiresAt"`
+			}
+			type auth struct {
+				Type string `json:"type"`
+			}
+			type backfill struct {
+				State      string  `json:"state"`
+				Pages      int     `json:"pages"`
+				Items      int     `json:"items"`
+				Error      *string `json:"error"`
+				StartedAt  string  `json:"startedAt"`
+				FinishedAt *string `json:"finishedAt"`
+			}
+			type event struct {
+				Kind      string `json:"kind"`
+				Detail    string `json:"detail"`
 				CreatedAt string `json:"createdAt"`
 			}
+			type out struct {
+				ID                          int64            `json:"id"`
+				URL                         string           `json:"url"`
+				Title                       string           `json:"title"`
+				ImageURL                    *string          `json:"imageUrl"`
+				ContentMode                 string           `json:"contentMode"`
+				Kind                        string           `json:"kind"`
+				Scrape                      *scrape.Config   `json:"scrape"`
+				Config                      *json.RawMessage `json:"config"`
+				Status                      string           `json:"status"`
+				CreatedAt                   string           `json:"createdAt"`
+				PollIntervalSeconds         *int64           `json:"pollIntervalSeconds"`
+				PollIntervalOverrideSeconds *int64           `json:"pollIntervalOverrideSeconds"`
+				Health                      health           `json:"health"`
+				Push                        *push            `json:"push"`
+				Aliases                     []string         `json:"aliases"`
+				Events                      []event          `json:"events"`
+				Auth                        *auth            `json:"auth"`
+				Backfill                    *backfill        `json:"backfill"`
+			}
 			resp := make([]out, 0, len(rows))
 			for _, r := range rows {
-				resp = append(resp, out{ID: r.ID, URL: r.URL, Title: r.Title, CreatedAt: r.CreatedAt})
+				h := r.Health
+				var p *push
+				if r.Push != nil {
+					p = &push{HubURL: r.Push.HubURL, State: r.Push.State, LeaseExpiresAt: r.Push.LeaseExpiresAt}
+				}
+				aliases := r.Aliases
+				if aliases == nil {
+					aliases = []string{}
+				}
+				events := make([]event, 0, len(r.Events))
+				for _, e := range r.Events {
+					events = append(events, event{Kind: e.Kind, Detail: e.Detail, CreatedAt: e.CreatedAt})
+				}
+				var a *auth
+				if r.AuthType != "" {
+					a = &auth{Type: r.AuthType}
+				}
+				var bf *backfill
+				if b := r.Backfill; b != nil {
+					bf = &backfill{State: b.State, Pages: b.Pages, Items: b.Items, Error: b.Error, StartedAt: b.StartedAt, FinishedAt: b.FinishedAt}
+				}
+				var sc *scrape.Config
+				var cfg *json.RawMessage
+				if r.Kind == db.SourceKindScrape && r.Config != "" {
+					sc = &scrape.Config{}
+					_ = json.Unmarshal([]byte(r.Config), sc)
+				} else if r.Kind != db.SourceKindFeed {
+					raw := json.RawMessage(r.Config)
+					if r.Config == "" {
+						raw = json.RawMessage("{}")
+					}
+					cfg = &raw
+				}
+				resp = append(resp, out{Auth: a, Backfill: bf, Kind: r.Kind, Scrape: sc, Config: cfg, ID: r.ID, URL: r.URL, Title: r.Title, ImageURL: nullString(r.ImageURL), ContentMode: r.ContentMode, Status: r.Status, CreatedAt: r.CreatedAt, PollIntervalSeconds: r.PollInterval, PollIntervalOverrideSeconds: r.PollIntervalOverride, Aliases: aliases, Events: events, Health: health{
+					LastAttemptAt:       h.LastAttemptAt,
+					LastSuccessAt:       h.LastSuccessAt,
+					ConsecutiveFailures: h.ConsecutiveFailures,
+					LastErrorClass:      h.LastErrorClass,
+					LastErrorMessage:    h.LastErrorMessage,
+					NextFetchAt:         h.NextFetchAt,
+				}, Push: p})
 			}
 			w.Header().Set("Content-Type", "application/json")
 			_ = json.NewEncoder(w).Encode(resp)
 		})
 
+		r.Patch("/{id}", func(w http.ResponseWriter, r *http.Request) {
+			id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, "bad_request", "invalid id")
+				return
+			}
+			var body struct {
+				// PollIntervalSeconds overrides the polling interval; null or
+				// 0 reverts to the interval derived from the feed.
+				PollIntervalSeconds *int64 `json:"pollIntervalSeconds"`
+			}
+			dec := json.NewDecoder(r.Body)
+			dec.DisallowUnknownFields()
+			if err := dec.Decode(&body); err != nil {
+				writeError(w, http.StatusBadRequest, "bad_request", "invalid json")
+				return
+			}
+			var override time.Duration
+			if body.PollIntervalSeconds != nil {
+				if *body.PollIntervalSeconds < 0 {
+					writeError(w, http.StatusBadRequest, "validation_failed", "pollIntervalSeconds must not be negative")
+					return
+				}
+				override = time.Duration(*body.PollIntervalSeconds) * time.Second
+			}
+			ok, err := db.SetSourcePollOverride(r.Context(), database, id, override)
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, "internal", "failed to update")
+				return
+			}
+			if !ok {
+				writeError(w, http.StatusNotFound, "not_found", "source not found")
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		})
+
 		r.Delete("/{id}", func(w http.ResponseWriter, r *http.Request) {
 			idStr := chi.URLParam(r, "id")
 			id, err := strconv.ParseInt(idStr, 10, 64)
@@ -86,6 +336,83 @@ func registerSourcesRoutes(database *sql.DB, r chi.Router) {
 	})
 }
 
+// sourceRequest says how to reach a source being added or previewed.
+type sourceRequest struct {
+	URL    string                  `json:"url"`
+	Kind   string                  `json:"kind"`
+	Scrape *scrape.Config          `json:"scrape"`
+	Config json.RawMessage         `json:"config"` // settings of an adapter kind
+	Auth   *credentials.Credential `json:"auth"`
+	// OriginalURL is URL as given, without credentials, before rewrite
+	// rules applied.
+	OriginalURL string `json:"-"`
+}
+
+// prepare validates the request and returns the client to probe the source
+// with, applying its credential. Credentials in the URL are moved to Auth,
+// since the URL is listed and logged. Feed URLs matching a rewrite rule of
+// rw are replaced with the feed they map to. It returns a message for the
+// client when the request is invalid.
+func (sr *sourceRequest) prepare(client *http.Client, box *credentials.Box, rw *discovery.Rewriter) (*http.Client, string) {
+	if !isValidHTTPURL(sr.URL) {
+		return nil, "invalid url"
+	}
+	switch sr.Kind {
+	case "":
+		sr.Kind = db.SourceKindFeed
+	case db.SourceKindFeed, db.SourceKindScrape:
+	default:
+		a, ok := fetcher.Adapter(sr.Kind)
+		if !ok {
+			return nil, "invalid kind"
+		}
+		if err := a.Validate(sr.URL, sr.Config); err != nil {
+			return nil, err.Error()
+		}
+		// stored compacted, and as an object when omitted
+		var buf bytes.Buffer
+		if len(sr.Config) == 0 || json.Compact(&buf, sr.Config) != nil || buf.String() == "null" {
+			buf.Reset()
+			buf.WriteString("{}")
+		}
+		sr.Config = buf.Bytes()
+	}
+	if sr.Kind == db.SourceKindScrape {
+		if sr.Scrape == nil {
+			return nil, "scrape selectors are required"
+		}
+		if err := sr.Scrape.Validate(); err != nil {
+			return nil, err.Error()
+		}
+	}
+	if u, _ := url.Parse(sr.URL); u.User != nil {
+		if sr.Auth != nil {
+			return nil, "credentials given both in url and auth"
+		}
+		pass, _ := u.User.Password()
+		sr.Auth = &credentials.Credential{Type: credentials.TypeBasic, Username: u.User.Username(), Password: pass}
+		u.User = nil
+		sr.URL = u.String()
+	}
+	sr.OriginalURL = sr.URL
+	if sr.Kind == db.SourceKindFeed {
+		if feedURL, _, ok := rw.Rewrite(sr.URL); ok {
+			sr.URL = feedURL
+		}
+	}
+	if sr.Auth == nil {
+		return client, ""
+	}
+	if err := sr.Auth.Validate(); err != nil {
+		return nil, err.Error()
+	}
+	if box == nil {
+		return nil, "credentials require a server secret key"
+	}
+	u, _ := url.Parse(sr.URL)
+	return sr.Auth.Client(client, u.Host), ""
+}
+
 func isValidHTTPURL(s string) bool {
 	u, err := url.ParseRequestURI(s)
 	if err != nil {
@@ -100,26 +427,24 @@ func isValidHTTPURL(s string) bool {
 	return true
 }
 
-func probeFeed(ctx context.Context, rawURL string) (string, string, string, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
-	if err != nil {
-		return "", "", "", err
-	}
-	client := &http.Client{Timeout: 5 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", "", "", err
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return "", "", "", errors.New("bad status")
+// probeErrorMessage describes why a URL could not be subscribed to.
+func probeErrorMessage(err error) string {
+	switch {
+	case errors.Is(err, httpclient.ErrForbiddenAddress):
+		return "destination address not allowed"
+	case errors.Is(err, httpclient.ErrBodyTooLarge):
+		return "response too large"
+	case errors.Is(err, httpclient.ErrContentType):
+		return "response is not a feed or web page"
+	case errors.Is(err, scrape.ErrNoItems):
+		return "no items matched the selectors"
 	}
-	parser := gofeed.NewParser()
-	feed, err := parser.Parse(resp.Body)
-	if err != nil {
-		return "", "", "", err
-	}
-	etag := resp.Header.Get("ETag")
-	lastMod := resp.Header.Get("Last-Modified")
-	return feed.Title, etag, lastMod, nil
+	return "unreachable or invalid feed"
+}
+
+// probeFeed resolves a user-supplied URL to a feed, discovering feeds
+// advertised by web pages. It returns either the feed or, when a page offers
+// several, the candidates to choose from.
+func probeFeed(ctx context.Context, client *http.Client, rawURL string) (*discovery.Feed, []discovery.Candidate, error) {
+	return discovery.Probe(ctx, client, rawURL)
 }
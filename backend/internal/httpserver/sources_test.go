@@ -0,0 +1,563 @@
+package httpserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fujidaiti/poppo-press/backend/internal/credentials"
+	"github.com/fujidaiti/poppo-press/backend/internal/db"
+	"github.com/fujidaiti/poppo-press/backend/internal/discovery"
+	"github.com/fujidaiti/poppo-press/backend/internal/fetcher"
+	"github.com/fujidaiti/poppo-press/backend/internal/testutil"
+)
+
+func TestSourcesAPI_Autodiscovery(t *testing.T) {
+	database, cleanup := testutil.OpenTestDB(t, "admin-pass")
+	defer cleanup()
+	ts := httptest.NewServer(New(database, WithHTTPClient(testutil.HTTPClient(t))).Handler())
+	defer ts.Close()
+	token := loginToken(t, ts.URL)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/single/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<html><head><link rel="alternate" type="application/atom+xml" href="/atom.xml"></head></html>`)
+	})
+	mux.HandleFunc("/multi/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<html><head>
+<link rel="alternate" type="application/rss+xml" title="Everything" href="/all.rss">
+<link rel="alternate" type="application/rss+xml" title="Go posts" href="/go.rss">
+</head></html>`)
+	})
+	mux.HandleFunc("/atom.xml", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<?xml version="1.0"?><feed xmlns="http://www.w3.org/2005/Atom"><title>Atom Blog</title></feed>`)
+	})
+	site := httptest.NewServer(mux)
+	defer site.Close()
+
+	// a page with one advertised feed subscribes to that feed
+	resp := postJSON(t, ts.URL+"/v1/sources", token, map[string]string{"url": site.URL + "/single/"})
+	var created struct {
+		ID  int64  `json:"id"`
+		URL string `json:"url"`
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&created)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated || created.URL != site.URL+"/atom.xml" {
+		t.Fatalf("expected discovered feed, got %d %+v", resp.StatusCode, created)
+	}
+
+	// a page with several feeds returns the choices
+	resp = postJSON(t, ts.URL+"/v1/sources", token, map[string]string{"url": site.URL + "/multi/"})
+	var choice struct {
+		Candidates []struct {
+			URL   string `json:"url"`
+			Title string `json:"title"`
+		} `json:"candidates"`
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&choice)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusMultipleChoices || len(choice.Candidates) != 2 || choice.Candidates[1].Title != "Go posts" {
+		t.Fatalf("expected 300 with candidates, got %d %+v", resp.StatusCode, choice)
+	}
+}
+
+func TestSourcesAPI_RewritesWellKnownURLs(t *testing.T) {
+	database, cleanup := testutil.OpenTestDB(t, "admin-pass")
+	defer cleanup()
+	feeds := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing.xml" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/rss+xml")
+		fmt.Fprint(w, `<?xml version="1.0"?><rss version="2.0"><channel><title>Videos</title></channel></rss>`)
+	}))
+	defer feeds.Close()
+	rules := []discovery.Rule{}
+	for _, r := range [][3]string{
+		{"video", `^https://video\.example/c/(\w+)$`, feeds.URL + "/feeds/$1.xml"},
+		{"broken", `^(https?://[^/]+)/p/\w+$`, feeds.URL + "/missing.xml"},
+	} {
+		rule, err := discovery.CompileRule(r[0], r[1], r[2])
+		if err != nil {
+			t.Fatalf("rule: %v", err)
+		}
+		rules = append(rules, rule)
+	}
+	ts := httptest.NewServer(New(database, WithHTTPClient(testutil.HTTPClient(t)), WithRewriter(discovery.NewRewriter(rules))).Handler())
+	defer ts.Close()
+	token := loginToken(t, ts.URL)
+
+	add := func(url string) (int, map[string]any) {
+		t.Helper()
+		resp := postJSON(t, ts.URL+"/v1/sources", token, map[string]any{"url": url})
+		defer resp.Body.Close()
+		var out map[string]any
+		_ = json.NewDecoder(resp.Body).Decode(&out)
+		return resp.StatusCode, out
+	}
+	code, out := add("https://video.example/c/abc")
+	if code != http.StatusCreated || out["url"] != feeds.URL+"/feeds/abc.xml" || out["originalUrl"] != "https://video.example/c/abc" {
+		t.Fatalf("unexpected rewrite: %d %v", code, out)
+	}
+	if code, _ := add("https://video.example/c/abc"); code != http.StatusConflict {
+		t.Fatalf("expected the rewritten URL to conflict, got %d", code)
+	}
+	// a rule that leads nowhere falls back to the URL as given
+	code, out = add(feeds.URL + "/p/feed")
+	if code != http.StatusCreated || out["url"] != feeds.URL+"/p/feed" || out["originalUrl"] != feeds.URL+"/p/feed" {
+		t.Fatalf("unexpected fallback: %d %v", code, out)
+	}
+}
+
+func TestSourcesAPI_RefusesPrivateDestinations(t *testing.T) {
+	database, cleanup := testutil.OpenTestDB(t, "admin-pass")
+	defer cleanup()
+	ts := httptest.NewServer(New(database).Handler())
+	defer ts.Close()
+	token := loginToken(t, ts.URL)
+
+	hit := false
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hit = true
+	}))
+	defer site.Close()
+
+	for _, u := range []string{site.URL + "/feed", "http://169.254.169.254/latest/meta-data/"} {
+		resp := postJSON(t, ts.URL+"/v1/sources", token, map[string]string{"url": u})
+		var e struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&e)
+		_ = resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest || e.Error.Message != "destination address not allowed" {
+			t.Fatalf("%s: expected refusal, got %d %+v", u, resp.StatusCode, e)
+		}
+	}
+	if hit {
+		t.Fatalf("refused request reached the server")
+	}
+}
+
+func TestSourcesAPI_AddsCredentialsRedacted(t *testing.T) {
+	database, cleanup := testutil.OpenTestDB(t, "admin-pass")
+	defer cleanup()
+	box, err := credentials.NewBox(base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32)))
+	if err != nil {
+		t.Fatalf("box: %v", err)
+	}
+	ts := httptest.NewServer(New(database, WithHTTPClient(testutil.HTTPClient(t)), WithCredentials(box)).Handler())
+	defer ts.Close()
+	token := loginToken(t, ts.URL)
+
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, _ := r.BasicAuth()
+		if r.Header.Get("Authorization") != "Bearer s3cret" && (user != "me" || pass != "pw-s3cret") {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, `<?xml version="1.0"?><rss version="2.0"><channel><title>Private</title></channel></rss>`)
+	}))
+	defer site.Close()
+
+	resp := postJSON(t, ts.URL+"/v1/sources", token, map[string]any{"url": site.URL + "/a.xml"})
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected unauthenticated add to fail, got %d", resp.StatusCode)
+	}
+	resp = postJSON(t, ts.URL+"/v1/sources", token, map[string]any{"url": site.URL + "/a.xml", "auth": map[string]string{"type": "bearer", "token": "s3cret"}})
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected add with bearer token, got %d", resp.StatusCode)
+	}
+	// credentials in the URL are moved out of it
+	withUser := strings.Replace(site.URL, "http://", "http://me:pw-s3cret@", 1) + "/b.xml"
+	resp = postJSON(t, ts.URL+"/v1/sources", token, map[string]any{"url": withUser})
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected add with credentials in url, got %d", resp.StatusCode)
+	}
+
+	resp = sendJSON(t, http.MethodGet, ts.URL+"/v1/sources", token, nil)
+	raw, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if strings.Contains(string(raw), "s3cret") {
+		t.Fatalf("listing leaks a secret: %s", raw)
+	}
+	var list []struct {
+		URL  string `json:"url"`
+		Auth *struct {
+			Type string `json:"type"`
+		} `json:"auth"`
+	}
+	_ = json.Unmarshal(raw, &list)
+	if len(list) != 2 || list[0].Auth == nil || list[0].Auth.Type != "bearer" || list[1].Auth == nil || list[1].Auth.Type != "basic" || list[1].URL != site.URL+"/b.xml" {
+		t.Fatalf("unexpected sources: %s", raw)
+	}
+
+	// without a server key credentials are refused
+	ts2 := httptest.NewServer(New(database, WithHTTPClient(testutil.HTTPClient(t))).Handler())
+	defer ts2.Close()
+	resp = postJSON(t, ts2.URL+"/v1/sources", token, map[string]any{"url": site.URL + "/c.xml", "auth": map[string]string{"type": "bearer", "token": "s3cret"}})
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected refusal without key, got %d", resp.StatusCode)
+	}
+}
+
+func TestSourcesAPI_ScrapePreviewAndAdd(t *testing.T) {
+	database, cleanup := testutil.OpenTestDB(t, "admin-pass")
+	defer cleanup()
+	ts := httptest.NewServer(New(database, WithHTTPClient(testutil.HTTPClient(t))).Handler())
+	defer ts.Close()
+	token := loginToken(t, ts.URL)
+
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<html><head><title>No Feed Here</title></head><body>
+<div class="entry"><h3><a href="/p/1">Hello</a></h3><time datetime="2025-01-02">2 Jan</time></div>
+<div class="entry"><h3><a href="/p/2">World</a></h3></div></body></html>`)
+	}))
+	defer site.Close()
+	selectors := map[string]string{"item": ".entry", "title": "h3", "date": "time"}
+
+	resp := postJSON(t, ts.URL+"/v1/sources/preview", token, map[string]any{"url": site.URL, "scrape": selectors})
+	var preview struct {
+		Title string `json:"title"`
+		Items []struct {
+			Title       string  `json:"title"`
+			URL         string  `json:"url"`
+			PublishedAt *string `json:"publishedAt"`
+		} `json:"items"`
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&preview)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || preview.Title != "No Feed Here" || len(preview.Items) != 2 ||
+		preview.Items[0].URL != site.URL+"/p/1" || preview.Items[0].PublishedAt == nil || preview.Items[1].PublishedAt != nil {
+		t.Fatalf("unexpected preview: %d %+v", resp.StatusCode, preview)
+	}
+
+	for _, bad := range []map[string]any{
+		{"url": site.URL, "scrape": map[string]string{"item": ".entry"}},
+		{"url": site.URL, "scrape": map[string]string{"item": ".missing", "title": "h3"}},
+		{"url": site.URL},
+	} {
+		resp = postJSON(t, ts.URL+"/v1/sources/preview", token, bad)
+		_ = resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("%v: expected 400, got %d", bad, resp.StatusCode)
+		}
+	}
+
+	resp = postJSON(t, ts.URL+"/v1/sources", token, map[string]any{"url": site.URL, "kind": "scrape", "scrape": selectors})
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected scrape source created, got %d", resp.StatusCode)
+	}
+	resp = sendJSON(t, http.MethodGet, ts.URL+"/v1/sources", token, nil)
+	var list []struct {
+		Title  string            `json:"title"`
+		Kind   string            `json:"kind"`
+		Scrape map[string]string `json:"scrape"`
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&list)
+	_ = resp.Body.Close()
+	if len(list) != 1 || list[0].Kind != "scrape" || list[0].Title != "No Feed Here" || list[0].Scrape["item"] != ".entry" {
+		t.Fatalf("unexpected sources: %+v", list)
+	}
+}
+
+func TestSourcesAPI_AdapterSources(t *testing.T) {
+	database, cleanup := testutil.OpenTestDB(t, "admin-pass")
+	defer cleanup()
+	ts := httptest.NewServer(New(database, WithHTTPClient(testutil.HTTPClient(t))).Handler())
+	defer ts.Close()
+	token := loginToken(t, ts.URL)
+
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"hits":[{"objectID":"7","title":"Big","url":"https://big.example/","points":90},{"objectID":"8","title":"Small","points":1}]}`)
+	}))
+	defer api.Close()
+	source := map[string]any{"url": api.URL + "/api/v1/search?tags=front_page", "kind": "hn", "config": map[string]int{"minPoints": 10}}
+
+	resp := postJSON(t, ts.URL+"/v1/sources/preview", token, source)
+	var preview struct {
+		Items []struct {
+			URL string `json:"url"`
+		} `json:"items"`
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&preview)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || len(preview.Items) != 1 || preview.Items[0].URL != "https://big.example/" {
+		t.Fatalf("unexpected preview: %d %+v", resp.StatusCode, preview)
+	}
+
+	for _, bad := range []map[string]any{
+		{"url": api.URL + "/api/v1/search", "kind": "hn", "config": map[string]int{"minPonts": 10}},
+		{"url": api.URL + "/repos/o/r", "kind": "github"},
+		{"url": api.URL, "kind": "nope"},
+	} {
+		resp = postJSON(t, ts.URL+"/v1/sources", token, bad)
+		_ = resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("%v: expected 400, got %d", bad, resp.StatusCode)
+		}
+	}
+
+	resp = postJSON(t, ts.URL+"/v1/sources", token, source)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected adapter source created, got %d", resp.StatusCode)
+	}
+	resp = sendJSON(t, http.MethodGet, ts.URL+"/v1/sources", token, nil)
+	var list []struct {
+		Title  string         `json:"title"`
+		Kind   string         `json:"kind"`
+		Config map[string]int `json:"config"`
+		Scrape any            `json:"scrape"`
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&list)
+	_ = resp.Body.Close()
+	if len(list) != 1 || list[0].Kind != "hn" || list[0].Title != "Hacker News: front_page" || list[0].Config["minPoints"] != 10 || list[0].Scrape != nil {
+		t.Fatalf("unexpected sources: %+v", list)
+	}
+}
+
+func TestSourcesAPI_BackfillsNewSources(t *testing.T) {
+	database, cleanup := testutil.OpenTestDB(t, "admin-pass")
+	defer cleanup()
+	ts := httptest.NewServer(New(database, WithHTTPClient(testutil.HTTPClient(t)), WithBackfill(fetcher.Options{})).Handler())
+	defer ts.Close()
+	token := loginToken(t, ts.URL)
+
+	feed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/rss+xml")
+		item := "now"
+		if r.URL.Path == "/feed" {
+			w.Header().Set("Link", `</archive>; rel="prev-archive"`)
+		} else {
+			item = "then"
+		}
+		fmt.Fprintf(w, `<?xml version="1.0"?><rss version="2.0"><channel><title>Archived</title><item><guid>%s</guid><title>%s</title><link>https://e/%s</link></item></channel></rss>`, item, item, item)
+	}))
+	defer feed.Close()
+
+	resp := postJSON(t, ts.URL+"/v1/sources", token, map[string]any{"url": feed.URL + "/feed"})
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected source created, got %d", resp.StatusCode)
+	}
+	type backfill struct {
+		State string `json:"state"`
+		Pages int    `json:"pages"`
+		Items int    `json:"items"`
+	}
+	var got *backfill
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		resp = sendJSON(t, http.MethodGet, ts.URL+"/v1/sources", token, nil)
+		var list []struct {
+			Backfill *backfill `json:"backfill"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&list)
+		_ = resp.Body.Close()
+		if len(list) == 1 && list[0].Backfill != nil && list[0].Backfill.State != "running" {
+			got = list[0].Backfill
+			break
+		}
+	}
+	if got == nil || got.State != "done" || got.Pages != 2 || got.Items != 2 {
+		t.Fatalf("unexpected backfill: %+v", got)
+	}
+	var n int
+	if err := database.QueryRow("SELECT COUNT(1) FROM article").Scan(&n); err != nil || n != 2 {
+		t.Fatalf("expected both documents stored, got %d (%v)", n, err)
+	}
+}
+
+func TestSourcesAPI_BackfilledSourcesWaitForThePoller(t *testing.T) {
+	database, cleanup := testutil.OpenTestDB(t, "admin-pass")
+	defer cleanup()
+	ts := httptest.NewServer(New(database, WithHTTPClient(testutil.HTTPClient(t)), WithBackfill(fetcher.Options{})).Handler())
+	defer ts.Close()
+	token := loginToken(t, ts.URL)
+
+	release := make(chan struct{})
+	var requests atomic.Int32
+	feed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) > 1 {
+			// hold the backfill's fetch; the first request is the probe
+			<-release
+		}
+		w.Header().Set("Content-Type", "application/rss+xml")
+		_, _ = w.Write([]byte(`<?xml version="1.0"?><rss version="2.0"><channel><title>T</title></channel></rss>`))
+	}))
+	defer feed.Close()
+	defer close(release)
+
+	resp := postJSON(t, ts.URL+"/v1/sources", token, map[string]any{"url": feed.URL})
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected source created, got %d", resp.StatusCode)
+	}
+	// while the backfill fetches it, the source is not due for the poller
+	due, err := db.ListSourcesForFetch(context.Background(), database, time.Now())
+	if err != nil || len(due) != 0 {
+		t.Fatalf("expected no due sources during the backfill, got %+v %v", due, err)
+	}
+}
+
+func TestSourcesAPI_PollIntervalOverride(t *testing.T) {
+	database, cleanup := testutil.OpenTestDB(t, "admin-pass")
+	defer cleanup()
+	ts := httptest.NewServer(New(database, WithHTTPClient(testutil.HTTPClient(t))).Handler())
+	defer ts.Close()
+	token := loginToken(t, ts.URL)
+	id, err := db.CreateSource(context.Background(), database, db.CreateSourceParams{URL: "https://ex/feed"})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	mustExec(t, database, "UPDATE source SET poll_interval = 3600 WHERE id = ?", id)
+	srcURL := fmt.Sprintf("%s/v1/sources/%d", ts.URL, id)
+
+	listOverride := func() (effective, override *int64) {
+		t.Helper()
+		resp := sendJSON(t, http.MethodGet, ts.URL+"/v1/sources", token, nil)
+		defer resp.Body.Close()
+		var list []struct {
+			PollIntervalSeconds         *int64 `json:"pollIntervalSeconds"`
+			PollIntervalOverrideSeconds *int64 `json:"pollIntervalOverrideSeconds"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&list); err != nil || len(list) != 1 {
+			t.Fatalf("list: %v %v", err, list)
+		}
+		return list[0].PollIntervalSeconds, list[0].PollIntervalOverrideSeconds
+	}
+
+	resp := sendJSON(t, http.MethodPatch, srcURL, token, map[string]any{"pollIntervalSeconds": 1800})
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("patch status: %d", resp.StatusCode)
+	}
+	if eff, o := listOverride(); eff == nil || *eff != 3600 || o == nil || *o != 1800 {
+		t.Fatalf("after override: %v %v", eff, o)
+	}
+
+	resp = sendJSON(t, http.MethodPatch, srcURL, token, map[string]any{"pollIntervalSeconds": nil})
+	_ = resp.Body.Close()
+	if _, o := listOverride(); o != nil {
+		t.Fatalf("override not cleared: %v", *o)
+	}
+
+	resp = sendJSON(t, http.MethodPatch, srcURL, token, map[string]any{"pollIntervalSeconds": -5})
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("negative interval status: %d", resp.StatusCode)
+	}
+	resp = sendJSON(t, http.MethodPatch, ts.URL+"/v1/sources/999", token, map[string]any{"pollIntervalSeconds": 60})
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("missing source status: %d", resp.StatusCode)
+	}
+}
+
+func TestSourcesAPI_LifecycleAndAliases(t *testing.T) {
+	database, cleanup := testutil.OpenTestDB(t, "admin-pass")
+	defer cleanup()
+	ts := httptest.NewServer(New(database, WithHTTPClient(testutil.HTTPClient(t))).Handler())
+	defer ts.Close()
+	token := loginToken(t, ts.URL)
+	ctx := context.Background()
+	id, err := db.CreateSource(ctx, database, db.CreateSourceParams{URL: "https://ex/old.xml"})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if moved, err := db.RecordPermanentRedirect(ctx, database, id, "https://ex/new.xml", 1, time.Now()); err != nil || !moved {
+		t.Fatalf("redirect: %v %v", moved, err)
+	}
+	if err := db.MarkSourceDead(ctx, database, id, "gone", time.Now()); err != nil {
+		t.Fatalf("dead: %v", err)
+	}
+
+	// the former URL is still a duplicate
+	resp := postJSON(t, ts.URL+"/v1/sources", token, map[string]string{"url": "https://ex/old.xml"})
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusConflict {
+		t.Fatalf("expected 409 for alias, got %d", resp.StatusCode)
+	}
+
+	resp = sendJSON(t, http.MethodGet, ts.URL+"/v1/sources", token, nil)
+	defer resp.Body.Close()
+	var list []struct {
+		URL     string   `json:"url"`
+		Status  string   `json:"status"`
+		Aliases []string `json:"aliases"`
+		Events  []struct {
+			Kind string `json:"kind"`
+		} `json:"events"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil || len(list) != 1 {
+		t.Fatalf("list: %v %v", err, list)
+	}
+	got := list[0]
+	if got.URL != "https://ex/new.xml" || got.Status != "dead" || len(got.Aliases) != 1 || got.Aliases[0] != "https://ex/old.xml" {
+		t.Fatalf("unexpected source: %+v", got)
+	}
+	if len(got.Events) != 2 || got.Events[0].Kind != "moved" || got.Events[1].Kind != "gone" {
+		t.Fatalf("unexpected events: %+v", got.Events)
+	}
+}
+
+// loginToken logs in as the seeded admin and returns the device token.
+func loginToken(t *testing.T, baseURL string) string {
+	t.Helper()
+	resp := postJSON(t, baseURL+"/v1/auth/login", "", map[string]string{"username": "admin", "password": "admin-pass", "deviceName": "dev"})
+	defer resp.Body.Close()
+	var lr struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&lr); err != nil || lr.Token == "" {
+		t.Fatalf("login: %d %v", resp.StatusCode, err)
+	}
+	return lr.Token
+}
+
+// postJSON sends body as JSON with an optional bearer token.
+func postJSON(t *testing.T, url, token string, body any) *http.Response {
+	t.Helper()
+	return sendJSON(t, http.MethodPost, url, token, body)
+}
+
+// sendJSON sends a request with an optional JSON body and bearer token.
+func sendJSON(t *testing.T, method, url, token string, body any) *http.Response {
+	t.Helper()
+	var r io.Reader
+	if body != nil {
+		b, _ := json.Marshal(body)
+		r = bytes.NewReader(b)
+	}
+	req, _ := http.NewRequest(method, url, r)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, url, err)
+	}
+	return resp
+}
@@ -0,0 +1,35 @@
+package httpserver
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/fujidaiti/poppo-press/backend/internal/db"
+)
+
+func registerTagRoutes(database *sql.DB, r chi.Router) {
+	r.With(authMiddleware(database)).Get("/tags", func(w http.ResponseWriter, r *http.Request) {
+		since, ok := sinceParam(w, r)
+		if !ok {
+			return
+		}
+		rows, err := db.ListTags(r.Context(), database, since)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "internal", "list fail")
+			return
+		}
+		type out struct {
+			Name  string `json:"name"`
+			Count int    `json:"count"`
+		}
+		resp := make([]out, 0, len(rows))
+		for _, t := range rows {
+			resp = append(resp, out{Name: t.Name, Count: t.Count})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	})
+}
@@ -0,0 +1,69 @@
+package httpserver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/fujidaiti/poppo-press/backend/internal/db"
+	"github.com/fujidaiti/poppo-press/backend/internal/testutil"
+)
+
+func TestTagsAndTagFilter(t *testing.T) {
+	database, cleanup := testutil.OpenTestDB(t, "admin-pass")
+	defer cleanup()
+	now := time.Now().UTC()
+	mustExec(t, database, "INSERT INTO source(id, url) VALUES(1, 'https://ex/feed')")
+	articles := []struct {
+		id   int64
+		age  time.Duration
+		tags []string
+	}{
+		{301, time.Hour, []string{"golang", "release"}},
+		{302, 10 * 24 * time.Hour, []string{"golang"}},
+		{303, time.Hour, []string{"rust"}},
+	}
+	for _, a := range articles {
+		mustExec(t, database, `INSERT INTO article(id, source_id, canonical_url, title, published_at, canonical_id) VALUES(?,1,?,?,?,?)`,
+			a.id, "https://ex/"+itoa(a.id), "T", now.Add(-a.age).Format(time.RFC3339), "aid-"+itoa(a.id))
+		if err := db.ReplaceArticleTags(context.Background(), database, a.id, a.tags); err != nil {
+			t.Fatalf("tags: %v", err)
+		}
+	}
+	ts := httptest.NewServer(New(database).Handler())
+	defer ts.Close()
+	token := loginToken(t, ts.URL)
+
+	resp := sendJSON(t, http.MethodGet, ts.URL+"/v1/tags", token, nil)
+	var tags []struct {
+		Name  string `json:"name"`
+		Count int    `json:"count"`
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&tags)
+	_ = resp.Body.Close()
+	if len(tags) != 3 || tags[0].Name != "golang" || tags[0].Count != 2 {
+		t.Fatalf("unexpected tag counts: %+v", tags)
+	}
+
+	// tag names are normalized; since narrows to the last week
+	week := now.Add(-7 * 24 * time.Hour).Format(time.DateOnly)
+	resp = sendJSON(t, http.MethodGet, ts.URL+"/v1/articles?tag=%20GoLang&since="+week, token, nil)
+	var list []struct {
+		ID   int64    `json:"id"`
+		Tags []string `json:"tags"`
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&list)
+	_ = resp.Body.Close()
+	if len(list) != 1 || list[0].ID != 301 || len(list[0].Tags) != 2 {
+		t.Fatalf("unexpected filtered articles: %+v", list)
+	}
+
+	resp = sendJSON(t, http.MethodGet, ts.URL+"/v1/tags?since=yesterday", token, nil)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 for bad since, got %d", resp.StatusCode)
+	}
+}
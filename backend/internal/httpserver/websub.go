@@ -0,0 +1,62 @@
+package httpserver
+
+import (
+	"database/sql"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/fujidaiti/poppo-press/backend/internal/websub"
+)
+
+// registerWebSubRoutes mounts the public WebSub callback. Hubs call it without
+// a device token; requests are authenticated by the unguessable callback
+// token in the path and, for pushes, by the HMAC signature. Pushes to unknown
+// tokens are refused before their body is read, and bodies over maxBody
+// bytes are refused.
+func registerWebSubRoutes(database *sql.DB, maxBody int64, r chi.Router) {
+	r.Route("/websub/callback/{token}", func(r chi.Router) {
+		r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+			challenge, err := websub.Verify(r.Context(), database, chi.URLParam(r, "token"), r.URL.Query(), time.Now())
+			if err != nil {
+				if !errors.Is(err, websub.ErrUnknownSubscription) {
+					log.Printf("websub verify: %v", err)
+				}
+				http.NotFound(w, r)
+				return
+			}
+			w.Header().Set("Content-Type", "text/plain")
+			_, _ = io.WriteString(w, challenge)
+		})
+
+		r.Post("/", func(w http.ResponseWriter, r *http.Request) {
+			sub, err := websub.Subscription(r.Context(), database, chi.URLParam(r, "token"))
+			if err != nil {
+				if !errors.Is(err, websub.ErrUnknownSubscription) {
+					log.Printf("websub push: %v", err)
+				}
+				http.NotFound(w, r)
+				return
+			}
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBody))
+			if err != nil {
+				var tooLarge *http.MaxBytesError
+				if errors.As(err, &tooLarge) {
+					writeError(w, http.StatusRequestEntityTooLarge, "too_large", "body too large")
+					return
+				}
+				writeError(w, http.StatusBadRequest, "bad_request", "unreadable body")
+				return
+			}
+			if _, err := websub.Receive(r.Context(), database, sub, r.Header, body); err != nil {
+				// per spec, bad signatures and payloads are acknowledged but ignored
+				log.Printf("websub push ignored: %v", err)
+			}
+			w.WriteHeader(http.StatusAccepted)
+		})
+	})
+}
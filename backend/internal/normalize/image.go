@@ -0,0 +1,51 @@
+package normalize
+
+import (
+	"net/url"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// ImageURL resolves raw against base and returns it when it is an http(s)
+// URL that does not look like a tracking beacon, or "" otherwise.
+func ImageURL(raw, base string) string {
+	if raw == "" || trackerRe.MatchString(raw) {
+		return ""
+	}
+	baseURL, _ := url.Parse(base)
+	u, ok := safeURL(raw, baseURL, false)
+	if !ok {
+		return ""
+	}
+	return u
+}
+
+// FirstImage returns the absolute URL of the first image in an HTML fragment
+// that is not a tracking pixel, or "" when there is none.
+func FirstImage(fragment, base string) string {
+	nodes, err := parseFragment(fragment)
+	if err != nil {
+		return ""
+	}
+	var find func(n *html.Node) string
+	find = func(n *html.Node) string {
+		if n.Type == html.ElementNode && n.DataAtom == atom.Img && !isTracker(n) {
+			if u := ImageURL(attrOf(n, "src"), base); u != "" {
+				return u
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if u := find(c); u != "" {
+				return u
+			}
+		}
+		return ""
+	}
+	for _, n := range nodes {
+		if u := find(n); u != "" {
+			return u
+		}
+	}
+	return ""
+}
@@ -0,0 +1,99 @@
+package normalize
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSanitizeHTML_StripsDangerousMarkup(t *testing.T) {
+	in := `<div style="color:red" onclick="x()"><p class="lead">Hello <b>world</b><script>alert(1)</script></p>` +
+		`<img src="/a.png" alt="chart" width="600"><img src="https://t.example/pixel.gif" width="1" height="1">` +
+		`<a href="javascript:alert(1)">bad</a> <a href="/post" target="_blank">good</a><iframe src="https://evil"></iframe></div>`
+	got := SanitizeHTML(in, "https://blog.example/feed")
+	want := `<p>Hello <b>world</b></p><img src="https://blog.example/a.png" alt="chart"/><a>bad</a> <a href="https://blog.example/post">good</a>`
+	if got != want {
+		t.Fatalf("sanitize:\n got %s\nwant %s", got, want)
+	}
+}
+
+func TestSanitizeHTML_DoubleEscapedMarkup(t *testing.T) {
+	got := SanitizeHTML(`&lt;p&gt;Tom &amp;amp; Jerry&lt;/p&gt;`, "")
+	if got != `<p>Tom &amp; Jerry</p>` {
+		t.Fatalf("got %s", got)
+	}
+}
+
+func TestToText(t *testing.T) {
+	in := `<h2>Title</h2><p>First   line<br>second &amp; more</p><ul><li>one</li><li>two</li></ul><blockquote><p>quoted</p></blockquote>`
+	want := "Title\n\nFirst line\nsecond & more\n\n- one\n- two\n\n> quoted"
+	if got := ToText(in); got != want {
+		t.Fatalf("text:\n got %q\nwant %q", got, want)
+	}
+}
+
+func TestToMarkdown(t *testing.T) {
+	in := `<h2>Title</h2><p>Read <a href="https://x.example/">this</a>, <em>now</em> with <code>a_b</code>.</p>` +
+		`<ol><li>one</li><li>two <strong>2</strong></li></ol><pre>if x {
+  y()
+}</pre><img src="https://x.example/i.png" alt="pic">`
+	want := strings.Join([]string{
+		"## Title",
+		"Read [this](https://x.example/), _now_ with `a_b`.",
+		"1. one\n2. two **2**",
+		"```\nif x {\n  y()\n}\n```",
+		"![pic](https://x.example/i.png)",
+	}, "\n\n")
+	if got := ToMarkdown(in); got != want {
+		t.Fatalf("markdown:\n got %q\nwant %q", got, want)
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	for in, want := range map[string]Format{"": FormatHTML, "html": FormatHTML, "text": FormatText, "markdown": FormatMarkdown} {
+		if got, ok := ParseFormat(in); !ok || got != want {
+			t.Fatalf("ParseFormat(%q) = %q, %v", in, got, ok)
+		}
+	}
+	if _, ok := ParseFormat("pdf"); ok {
+		t.Fatal("expected pdf to be rejected")
+	}
+}
+
+func TestFirstImage(t *testing.T) {
+	in := `<p><img src="https://ex/pixel.gif"><img src="/spacer.png" width="1" height="1"><img src="/lead.jpg"></p>`
+	if got := FirstImage(in, "https://ex/post"); got != "https://ex/lead.jpg" {
+		t.Fatalf("got %q", got)
+	}
+	if got := FirstImage(`<p>no images</p>`, ""); got != "" {
+		t.Fatalf("expected none, got %q", got)
+	}
+	if got := ImageURL("javascript:alert(1)", ""); got != "" {
+		t.Fatalf("unsafe image url accepted: %q", got)
+	}
+}
+
+func TestTags(t *testing.T) {
+	got := Tags([]string{" Go ", "go", "Machine\n  Learning", "", "GO"})
+	if strings.Join(got, "|") != "go|machine learning" {
+		t.Fatalf("got %q", got)
+	}
+}
+
+func TestCanonicalURL(t *testing.T) {
+	cases := map[string]string{
+		"HTTPS://Example.COM:443/post?utm_source=rss&b=2&a=1#comments":           "https://example.com/post?a=1&b=2",
+		"http://example.com?fbclid=xyz":                                          "http://example.com/",
+		"https://www.google.com/url?q=https%3A%2F%2Fex.org%2Fa%3Futm_medium%3Dx": "https://ex.org/a",
+		"https://l.facebook.com/l.php?u=https%3A%2F%2Fex.org%2Fb":                "https://ex.org/b",
+		"https://www.google.com/search?q=go":                                     "https://www.google.com/search?q=go",
+		"mailto:someone@example.com":                                             "mailto:someone@example.com",
+	}
+	for in, want := range cases {
+		if got := CanonicalURL(in); got != want {
+			t.Errorf("CanonicalURL(%q) = %q, want %q", in, got, want)
+		}
+	}
+	if !IsFeedProxy("http://feedproxy.google.com/~r/Example/~3/abc/") || IsFeedProxy("https://ex.org/") {
+		t.Fatalf("feed proxy detection")
+	}
+}
@@ -0,0 +1,296 @@
+package normalize
+
+import (
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Format names a rendition of an article body.
+type Format string
+
+// Supported renditions. HTML is the sanitized fragment as stored.
+const (
+	FormatHTML     Format = "html"
+	FormatText     Format = "text"
+	FormatMarkdown Format = "markdown"
+)
+
+// ParseFormat validates a format name; the empty string means HTML.
+func ParseFormat(s string) (Format, bool) {
+	switch Format(s) {
+	case "", FormatHTML:
+		return FormatHTML, true
+	case FormatText, FormatMarkdown:
+		return Format(s), true
+	}
+	return "", false
+}
+
+// Render converts a sanitized HTML fragment into the requested format.
+func Render(fragment string, f Format) string {
+	switch f {
+	case FormatText:
+		return ToText(fragment)
+	case FormatMarkdown:
+		return ToMarkdown(fragment)
+	}
+	return fragment
+}
+
+// ToText renders an HTML fragment as plain text: block elements become
+// paragraphs, list items are bulleted, and inline whitespace is collapsed.
+func ToText(fragment string) string {
+	return render(fragment, false)
+}
+
+// ToMarkdown renders an HTML fragment as CommonMark-style Markdown.
+func ToMarkdown(fragment string) string {
+	return render(fragment, true)
+}
+
+// render parses fragment and writes it through a renderer.
+func render(fragment string, md bool) string {
+	if strings.TrimSpace(fragment) == "" {
+		return ""
+	}
+	nodes, err := parseFragment(fragment)
+	if err != nil {
+		return ""
+	}
+	r := &renderer{md: md}
+	for _, n := range nodes {
+		r.node(n)
+	}
+	return r.String()
+}
+
+// renderer accumulates output as a list of blocks. Inline content is
+// buffered in line until a block boundary flushes it.
+type renderer struct {
+	md     bool
+	blocks []string
+	line   strings.Builder
+	prefix []string // per-nesting line prefixes (blockquote markers)
+	pre    int      // depth of <pre> nesting; whitespace is kept verbatim
+}
+
+// String joins the rendered blocks with blank lines.
+func (r *renderer) String() string {
+	r.flush()
+	return strings.Join(r.blocks, "\n\n")
+}
+
+// flush ends the current block, if any.
+func (r *renderer) flush() {
+	text := r.line.String()
+	r.line.Reset()
+	var lines []string
+	for _, l := range strings.Split(text, "\n") {
+		if r.pre == 0 {
+			l = strings.Join(strings.Fields(l), " ")
+		}
+		lines = append(lines, l)
+	}
+	text = strings.Trim(strings.Join(lines, "\n"), "\n")
+	if strings.TrimSpace(text) == "" {
+		return
+	}
+	if p := strings.Join(r.prefix, ""); p != "" {
+		text = p + strings.ReplaceAll(text, "\n", "\n"+p)
+	}
+	r.blocks = append(r.blocks, text)
+}
+
+// block renders n's children as one block prefixed by lead.
+func (r *renderer) block(n *html.Node, lead string) {
+	r.flush()
+	r.line.WriteString(lead)
+	r.children(n)
+	r.flush()
+}
+
+// inline wraps n's children in a Markdown marker when rendering Markdown.
+func (r *renderer) inline(n *html.Node, marker string) {
+	if r.md {
+		r.line.WriteString(marker)
+	}
+	r.children(n)
+	if r.md {
+		r.line.WriteString(marker)
+	}
+}
+
+// children renders each child of n in order.
+func (r *renderer) children(n *html.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		r.node(c)
+	}
+}
+
+// node renders a single node.
+func (r *renderer) node(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		text := n.Data
+		if r.md && r.pre == 0 {
+			text = escapeMarkdown(text)
+		}
+		r.line.WriteString(text)
+		return
+	case html.ElementNode:
+	default:
+		return
+	}
+	switch n.DataAtom {
+	case atom.Script, atom.Style, atom.Head, atom.Title:
+	case atom.Br:
+		if r.md {
+			r.line.WriteString("\\")
+		}
+		r.line.WriteString("\n")
+	case atom.P, atom.Div, atom.Figure, atom.Figcaption, atom.Dd, atom.Dt, atom.Table, atom.Section, atom.Article:
+		r.block(n, "")
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		lead := ""
+		if r.md {
+			lead = strings.Repeat("#", int(n.Data[1]-'0')) + " "
+		}
+		r.block(n, lead)
+	case atom.Hr:
+		r.flush()
+		if r.md {
+			r.blocks = append(r.blocks, "---")
+		}
+	case atom.Blockquote:
+		r.flush()
+		r.prefix = append(r.prefix, "> ")
+		r.children(n)
+		r.flush()
+		r.prefix = r.prefix[:len(r.prefix)-1]
+	case atom.Pre:
+		r.flush()
+		r.pre++
+		if r.md {
+			r.line.WriteString("```\n")
+		}
+		r.line.WriteString(strings.Trim(textOf(n), "\n"))
+		if r.md {
+			r.line.WriteString("\n```")
+		}
+		r.flush()
+		r.pre--
+	case atom.Ul, atom.Ol:
+		r.list(n)
+	case atom.Tr:
+		r.flush()
+		var cells []string
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type == html.ElementNode && (c.DataAtom == atom.Td || c.DataAtom == atom.Th) {
+				cells = append(cells, strings.Join(strings.Fields(render(innerHTML(c), r.md)), " "))
+			}
+		}
+		r.line.WriteString(strings.Join(cells, " | "))
+		r.flush()
+	case atom.Strong, atom.B:
+		r.inline(n, "**")
+	case atom.Em, atom.I:
+		r.inline(n, "_")
+	case atom.Del, atom.S:
+		r.inline(n, "~~")
+	case atom.Code:
+		if r.md {
+			r.line.WriteString("`" + textOf(n) + "`")
+		} else {
+			r.line.WriteString(textOf(n))
+		}
+	case atom.A:
+		href := attrOf(n, "href")
+		if !r.md || href == "" {
+			r.children(n)
+			return
+		}
+		r.line.WriteString("[")
+		r.children(n)
+		r.line.WriteString("](" + href + ")")
+	case atom.Img:
+		if r.md && attrOf(n, "src") != "" {
+			r.line.WriteString("![" + escapeMarkdown(attrOf(n, "alt")) + "](" + attrOf(n, "src") + ")")
+		} else if alt := attrOf(n, "alt"); alt != "" {
+			r.line.WriteString(alt)
+		}
+	default:
+		r.children(n)
+	}
+}
+
+// list renders the items of a <ul> or <ol> as consecutive lines of one
+// block; nested lists are indented beneath their item.
+func (r *renderer) list(n *html.Node) {
+	r.flush()
+	var lines []string
+	i := 0
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.ElementNode || c.DataAtom != atom.Li {
+			continue
+		}
+		i++
+		marker := "- "
+		if n.DataAtom == atom.Ol {
+			marker = strconv.Itoa(i) + ". "
+		}
+		sub := &renderer{md: r.md}
+		sub.children(c)
+		item := strings.Join(sub.blocksFlushed(), "\n")
+		item = strings.ReplaceAll(item, "\n", "\n"+strings.Repeat(" ", len(marker)))
+		lines = append(lines, marker+item)
+	}
+	if len(lines) > 0 {
+		r.line.WriteString(strings.Join(lines, "\n"))
+		r.pre++ // keep the list's own line breaks and indentation
+		r.flush()
+		r.pre--
+	}
+}
+
+// blocksFlushed flushes pending inline text and returns the blocks.
+func (r *renderer) blocksFlushed() []string {
+	r.flush()
+	return r.blocks
+}
+
+// innerHTML renders the children of n back to HTML.
+func innerHTML(n *html.Node) string {
+	var b strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		_ = html.Render(&b, c)
+	}
+	return b.String()
+}
+
+// textOf concatenates the text nodes beneath n.
+func textOf(n *html.Node) string {
+	var b strings.Builder
+	var walk func(*html.Node)
+	walk = func(c *html.Node) {
+		if c.Type == html.TextNode {
+			b.WriteString(c.Data)
+		}
+		for cc := c.FirstChild; cc != nil; cc = cc.NextSibling {
+			walk(cc)
+		}
+	}
+	walk(n)
+	return b.String()
+}
+
+// mdEscaper backslash-escapes characters that would otherwise be read as
+// Markdown syntax.
+var mdEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "_", `\_`, "`", "\\`", "[", `\[`, "]", `\]`)
+
+// escapeMarkdown escapes Markdown metacharacters in plain text.
+func escapeMarkdown(s string) string {
+	return mdEscaper.Replace(s)
+}
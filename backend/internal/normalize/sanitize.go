@@ -0,0 +1,174 @@
+// Package normalize cleans feed-supplied HTML against an allowlist and renders
+// it as plain text or Markdown for terminal clients.
+package normalize
+
+import (
+	"bytes"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// allowedAttrs lists, per allowed element, the attributes that survive
+// sanitization. Elements missing from the map are unwrapped (their children
+// are kept) unless they are listed in droppedElems.
+var allowedAttrs = map[atom.Atom][]string{
+	atom.A: {"href", "title"}, atom.Abbr: {"title"}, atom.B: nil, atom.Blockquote: {"cite"}, atom.Br: nil,
+	atom.Code: nil, atom.Dd: nil, atom.Del: nil, atom.Dl: nil, atom.Dt: nil, atom.Em: nil,
+	atom.Figcaption: nil, atom.Figure: nil, atom.H1: nil, atom.H2: nil, atom.H3: nil, atom.H4: nil,
+	atom.H5: nil, atom.H6: nil, atom.Hr: nil, atom.I: nil, atom.Img: {"src", "alt", "title"},
+	atom.Ins: nil, atom.Li: nil, atom.Ol: nil, atom.P: nil, atom.Pre: nil, atom.Q: {"cite"},
+	atom.S: nil, atom.Small: nil, atom.Strong: nil, atom.Sub: nil, atom.Sup: nil, atom.Table: nil,
+	atom.Tbody: nil, atom.Td: {"colspan", "rowspan"}, atom.Tfoot: nil, atom.Th: {"colspan", "rowspan"},
+	atom.Thead: nil, atom.Tr: nil, atom.U: nil, atom.Ul: nil,
+}
+
+// droppedElems are removed together with everything inside them.
+var droppedElems = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Iframe: true, atom.Object: true, atom.Embed: true,
+	atom.Noscript: true, atom.Form: true, atom.Input: true, atom.Button: true, atom.Select: true,
+	atom.Textarea: true, atom.Svg: true, atom.Math: true, atom.Template: true, atom.Head: true,
+	atom.Title: true, atom.Meta: true, atom.Link: true, atom.Audio: true, atom.Video: true,
+}
+
+// urlAttrs are attributes holding URLs, which are resolved and scheme-checked.
+var urlAttrs = map[string]bool{"href": true, "src": true, "cite": true}
+
+// trackerRe matches image URLs that are almost always tracking beacons.
+var trackerRe = regexp.MustCompile(`(?i)/(pixel|beacon|track(ing)?|open)\b|feedburner\.com/~r/|feeds\.feedburner\.com/~ff/|doubleclick\.net|/b\.gif|/t\.gif|\?utm_`)
+
+// SanitizeHTML parses an HTML fragment and returns it reduced to the
+// allowlist: scripts, styles, embeds, event handlers, inline styles, and
+// tracking pixels are removed, and relative URLs are resolved against base.
+// Input whose markup was entity-escaped twice is unescaped once first.
+func SanitizeHTML(fragment, base string) string {
+	fragment = strings.TrimSpace(fragment)
+	if fragment == "" {
+		return ""
+	}
+	if !strings.Contains(fragment, "<") && strings.Contains(fragment, "&lt;") {
+		fragment = html.UnescapeString(fragment)
+	}
+	baseURL, _ := url.Parse(base)
+	nodes, err := parseFragment(fragment)
+	if err != nil {
+		return ""
+	}
+	var buf bytes.Buffer
+	for _, n := range nodes {
+		for _, c := range clean(n, baseURL) {
+			_ = html.Render(&buf, c)
+		}
+	}
+	return strings.TrimSpace(buf.String())
+}
+
+// parseFragment parses s as the children of a <body> element.
+func parseFragment(s string) ([]*html.Node, error) {
+	ctx := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	return html.ParseFragment(strings.NewReader(s), ctx)
+}
+
+// clean returns the sanitized replacement for n: nothing, n itself with
+// filtered attributes and cleaned children, or n's cleaned children when n
+// is not allowed but its content is.
+func clean(n *html.Node, base *url.URL) []*html.Node {
+	switch n.Type {
+	case html.TextNode:
+		return []*html.Node{{Type: html.TextNode, Data: n.Data}}
+	case html.ElementNode:
+	default:
+		return nil
+	}
+	if droppedElems[n.DataAtom] {
+		return nil
+	}
+	var children []*html.Node
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		children = append(children, clean(c, base)...)
+	}
+	allowed, ok := allowedAttrs[n.DataAtom]
+	if !ok {
+		return children
+	}
+	out := &html.Node{Type: html.ElementNode, Data: n.Data, DataAtom: n.DataAtom}
+	for _, a := range n.Attr {
+		if a.Namespace != "" || !contains(allowed, a.Key) {
+			continue
+		}
+		if urlAttrs[a.Key] {
+			v, ok := safeURL(a.Val, base, n.DataAtom == atom.A)
+			if !ok {
+				continue
+			}
+			a.Val = v
+		}
+		out.Attr = append(out.Attr, html.Attribute{Key: a.Key, Val: a.Val})
+	}
+	if n.DataAtom == atom.Img && (isTracker(n) || attrOf(out, "src") == "") {
+		return nil
+	}
+	for _, c := range children {
+		out.AppendChild(c)
+	}
+	return []*html.Node{out}
+}
+
+// safeURL resolves raw against base and accepts only http(s) URLs, plus
+// mailto for links.
+func safeURL(raw string, base *url.URL, link bool) (string, bool) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return "", false
+	}
+	if base != nil && base.IsAbs() {
+		u = base.ResolveReference(u)
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https":
+		return u.String(), true
+	case "mailto":
+		return u.String(), link
+	}
+	return "", false
+}
+
+// isTracker reports whether an <img> looks like a 1x1 beacon.
+func isTracker(n *html.Node) bool {
+	w, h := attrOf(n, "width"), attrOf(n, "height")
+	if tiny(w) || tiny(h) {
+		return true
+	}
+	return trackerRe.MatchString(attrOf(n, "src"))
+}
+
+// tiny reports whether a width/height attribute is 0 or 1 pixels.
+func tiny(v string) bool {
+	v = strings.TrimSuffix(strings.TrimSpace(v), "px")
+	n, err := strconv.Atoi(v)
+	return err == nil && n <= 1
+}
+
+// attrOf returns the value of the named attribute, or "".
+func attrOf(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// contains reports whether list holds s.
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
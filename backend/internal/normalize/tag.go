@@ -0,0 +1,26 @@
+package normalize
+
+import "strings"
+
+// Tag turns a feed category into a tag name: lowercased, trimmed, and with
+// inner whitespace runs collapsed to single spaces, so that "Go", " go" and
+// "GO " are one tag. It returns "" for blank categories.
+func Tag(category string) string {
+	return strings.ToLower(strings.Join(strings.Fields(category), " "))
+}
+
+// Tags normalizes categories with Tag, dropping blanks and duplicates while
+// keeping the first-seen order.
+func Tags(categories []string) []string {
+	var out []string
+	seen := map[string]bool{}
+	for _, c := range categories {
+		t := Tag(c)
+		if t == "" || seen[t] {
+			continue
+		}
+		seen[t] = true
+		out = append(out, t)
+	}
+	return out
+}
@@ -0,0 +1,126 @@
+package normalize
+
+import (
+	"net"
+	"net/url"
+	"strings"
+)
+
+// trackingParams are query parameters that only identify a campaign, click,
+// or referrer and never select content. Parameters starting with "utm_" are
+// dropped as well.
+var trackingParams = map[string]bool{
+	"fbclid": true, "gclid": true, "dclid": true, "gbraid": true, "wbraid": true,
+	"msclkid": true, "yclid": true, "twclid": true, "igshid": true, "mc_cid": true,
+	"mc_eid": true, "_hsenc": true, "_hsmi": true, "mkt_tok": true, "oly_anon_id": true,
+	"oly_enc_id": true, "vero_id": true, "ref_src": true, "ref_url": true,
+}
+
+// redirectWrappers maps hosts that wrap outbound links to the query
+// parameter holding the destination.
+var redirectWrappers = map[string]string{
+	"www.google.com":  "url",
+	"google.com":      "url",
+	"l.facebook.com":  "u",
+	"lm.facebook.com": "u",
+	"out.reddit.com":  "url",
+	"l.instagram.com": "u",
+	"href.li":         "",
+	"www.youtube.com": "q",
+	"t.umblr.com":     "z",
+}
+
+// proxyHosts serve feed items through a redirect that can only be resolved
+// over HTTP (FeedBurner and similar).
+var proxyHosts = map[string]bool{
+	"feedproxy.google.com":     true,
+	"feeds.feedburner.com":     true,
+	"feeds2.feedburner.com":    true,
+	"feedproxy.feedburner.com": true,
+	"rss.feedsportal.com":      true,
+}
+
+// CanonicalURL returns the form of an article URL used to recognize the same
+// story across feeds: lowercase scheme and host, no default port, no
+// fragment, no tracking parameters, remaining parameters sorted by name, and
+// known redirect wrappers (Google, Facebook, Reddit outbound links)
+// unwrapped. It returns raw unchanged when it is not an absolute http(s) URL.
+func CanonicalURL(raw string) string {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || u.Host == "" {
+		return raw
+	}
+	for range 3 {
+		inner := unwrapRedirect(u)
+		if inner == nil {
+			break
+		}
+		u = inner
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return raw
+	}
+	host := strings.ToLower(u.Hostname())
+	if port := u.Port(); port != "" && !(u.Scheme == "http" && port == "80") && !(u.Scheme == "https" && port == "443") {
+		host = net.JoinHostPort(host, port)
+	}
+	u.Host = strings.TrimSuffix(host, ".")
+	u.User = nil
+	u.Fragment = ""
+	u.RawFragment = ""
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	q := u.Query()
+	for k := range q {
+		if trackingParams[strings.ToLower(k)] || strings.HasPrefix(strings.ToLower(k), "utm_") {
+			q.Del(k)
+		}
+	}
+	u.RawQuery = q.Encode()
+	u.ForceQuery = false
+	return u.String()
+}
+
+// IsFeedProxy reports whether raw points at a feed proxy whose destination
+// is only known by following its redirect.
+func IsFeedProxy(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && proxyHosts[strings.ToLower(u.Hostname())]
+}
+
+// unwrapRedirect returns the destination of a known redirect wrapper, or nil
+// when u is not one.
+func unwrapRedirect(u *url.URL) *url.URL {
+	param, ok := redirectWrappers[strings.ToLower(u.Hostname())]
+	if !ok {
+		return nil
+	}
+	var target string
+	switch {
+	case param == "":
+		// href.li puts the destination after "?"
+		target = u.RawQuery
+	case strings.HasSuffix(strings.ToLower(u.Hostname()), "google.com"):
+		if u.Path != "/url" {
+			return nil
+		}
+		target = u.Query().Get(param)
+		if target == "" {
+			target = u.Query().Get("q")
+		}
+	case strings.HasSuffix(strings.ToLower(u.Hostname()), "youtube.com"):
+		if u.Path != "/redirect" {
+			return nil
+		}
+		target = u.Query().Get(param)
+	default:
+		target = u.Query().Get(param)
+	}
+	inner, err := url.Parse(target)
+	if err != nil || inner.Host == "" || (inner.Scheme != "http" && inner.Scheme != "https") {
+		return nil
+	}
+	return inner
+}
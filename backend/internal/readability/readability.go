@@ -0,0 +1,297 @@
+// Package readability extracts the main article body from a web page using a
+// scoring heuristic in the spirit of Arc90's Readability: paragraphs vote for
+// their ancestors, link-heavy and boilerplate-looking blocks are penalized,
+// and the best-scoring block plus its related siblings form the article.
+package readability
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// ErrNoContent is returned when no block in the page looks like article text.
+var ErrNoContent = errors.New("readability: no article content found")
+
+// Article is the result of extracting a page.
+type Article struct {
+	Title     string // document <title>
+	HTML      string // main content as an HTML fragment
+	Text      string // main content as whitespace-normalized plain text
+	Canonical string // href of <link rel="canonical"> as written, or ""
+}
+
+var (
+	unlikelyRe = regexp.MustCompile(`(?i)banner|breadcrumb|combx|comment|community|cookie|disqus|extra|foot|header|menu|modal|nav|popup|promo|related|remark|rss|share|shoutbox|sidebar|skyscraper|social|sponsor|subscribe|tool|widget|\bad-|\bads\b`)
+	maybeRe    = regexp.MustCompile(`(?i)and|article|body|column|main|shadow`)
+	positiveRe = regexp.MustCompile(`(?i)article|body|content|entry|hentry|main|page|post|story|text|blog`)
+	negativeRe = regexp.MustCompile(`(?i)hidden|combx|comment|contact|foot|footer|footnote|masthead|media|meta|outbrain|promo|related|scroll|share|shoutbox|sidebar|skyscraper|sponsor|shopping|tags|tool|widget`)
+)
+
+// minParagraphLen is the shortest text that counts as a scoring paragraph.
+const minParagraphLen = 25
+
+// Extract parses an HTML page and returns its main article content.
+func Extract(r io.Reader) (Article, error) {
+	doc, err := html.Parse(r)
+	if err != nil {
+		return Article{}, err
+	}
+	title := strings.TrimSpace(textOf(find(doc, atom.Title)))
+	canonical := canonicalLink(doc)
+	body := find(doc, atom.Body)
+	if body == nil {
+		return Article{}, ErrNoContent
+	}
+	prune(body)
+
+	scores := map[*html.Node]float64{}
+	var candidates []*html.Node
+	walk(body, func(n *html.Node) {
+		if n.Type != html.ElementNode || (n.DataAtom != atom.P && n.DataAtom != atom.Pre && n.DataAtom != atom.Td) {
+			return
+		}
+		text := normalizeSpace(textOf(n))
+		if len(text) < minParagraphLen {
+			return
+		}
+		score := 1 + float64(strings.Count(text, ",")) + min(float64(len(text))/100, 3)
+		for level, anc := 0, n.Parent; anc != nil && level < 3 && anc.Type == html.ElementNode; level, anc = level+1, anc.Parent {
+			if _, ok := scores[anc]; !ok {
+				scores[anc] = initialScore(anc)
+				candidates = append(candidates, anc)
+			}
+			switch level {
+			case 0:
+				scores[anc] += score
+			case 1:
+				scores[anc] += score / 2
+			default:
+				scores[anc] += score / 6
+			}
+		}
+	})
+
+	var top *html.Node
+	for _, c := range candidates {
+		scores[c] *= 1 - linkDensity(c)
+		if top == nil || scores[c] > scores[top] {
+			top = c
+		}
+	}
+	if top == nil {
+		top = fallback(body)
+	}
+	if top == nil {
+		return Article{}, ErrNoContent
+	}
+
+	content := collect(top, scores)
+	var buf bytes.Buffer
+	for _, n := range content {
+		if err := html.Render(&buf, n); err != nil {
+			return Article{}, err
+		}
+	}
+	var text []string
+	for _, n := range content {
+		if t := normalizeSpace(textOf(n)); t != "" {
+			text = append(text, t)
+		}
+	}
+	if len(text) == 0 {
+		return Article{}, ErrNoContent
+	}
+	return Article{Title: title, HTML: buf.String(), Text: strings.Join(text, "\n\n"), Canonical: canonical}, nil
+}
+
+// collect returns the top candidate together with siblings that look like
+// part of the same article, preserving document order.
+func collect(top *html.Node, scores map[*html.Node]float64) []*html.Node {
+	if top.Parent == nil {
+		return []*html.Node{top}
+	}
+	threshold := max(10, scores[top]*0.2)
+	var out []*html.Node
+	for s := top.Parent.FirstChild; s != nil; s = s.NextSibling {
+		if s == top {
+			out = append(out, s)
+			continue
+		}
+		if s.Type != html.ElementNode {
+			continue
+		}
+		if sc, ok := scores[s]; ok && sc >= threshold {
+			out = append(out, s)
+			continue
+		}
+		if s.DataAtom == atom.P {
+			text := normalizeSpace(textOf(s))
+			ld := linkDensity(s)
+			if (len(text) > 80 && ld < 0.25) || (len(text) > 0 && ld == 0 && strings.Contains(text, ". ")) {
+				out = append(out, s)
+			}
+		}
+	}
+	return out
+}
+
+// initialScore seeds a candidate's score from its tag and class/id hints.
+func initialScore(n *html.Node) float64 {
+	var s float64
+	switch n.DataAtom {
+	case atom.Article:
+		s = 10
+	case atom.Div:
+		s = 5
+	case atom.Pre, atom.Td, atom.Blockquote:
+		s = 3
+	case atom.Address, atom.Ol, atom.Ul, atom.Dl, atom.Dd, atom.Dt, atom.Li, atom.Form:
+		s = -3
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6, atom.Th:
+		s = -5
+	}
+	return s + classWeight(n)
+}
+
+// classWeight rewards class/id names that suggest article text and punishes
+// those that suggest page chrome.
+func classWeight(n *html.Node) float64 {
+	var w float64
+	for _, v := range []string{attr(n, "class"), attr(n, "id")} {
+		if v == "" {
+			continue
+		}
+		if negativeRe.MatchString(v) {
+			w -= 25
+		}
+		if positiveRe.MatchString(v) {
+			w += 25
+		}
+	}
+	return w
+}
+
+// prune removes nodes that never carry article text, such as scripts and
+// blocks whose class/id mark them as navigation or boilerplate.
+func prune(n *html.Node) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		if c.Type == html.CommentNode || (c.Type == html.ElementNode && isJunk(c)) {
+			n.RemoveChild(c)
+		} else {
+			prune(c)
+		}
+		c = next
+	}
+}
+
+// isJunk reports whether an element should be dropped before scoring.
+func isJunk(n *html.Node) bool {
+	switch n.DataAtom {
+	case atom.Script, atom.Style, atom.Noscript, atom.Iframe, atom.Form, atom.Nav, atom.Aside, atom.Footer, atom.Header, atom.Button, atom.Input, atom.Select, atom.Textarea, atom.Svg:
+		return true
+	case atom.Body, atom.Article, atom.Main:
+		return false
+	}
+	hint := attr(n, "class") + " " + attr(n, "id")
+	return unlikelyRe.MatchString(hint) && !maybeRe.MatchString(hint)
+}
+
+// fallback picks a semantic container when no paragraph scored.
+func fallback(body *html.Node) *html.Node {
+	if n := find(body, atom.Article); n != nil {
+		return n
+	}
+	if n := find(body, atom.Main); n != nil {
+		return n
+	}
+	if normalizeSpace(textOf(body)) != "" {
+		return body
+	}
+	return nil
+}
+
+// linkDensity is the fraction of a node's text that sits inside links.
+func linkDensity(n *html.Node) float64 {
+	total := len(normalizeSpace(textOf(n)))
+	if total == 0 {
+		return 0
+	}
+	linked := 0
+	walk(n, func(c *html.Node) {
+		if c.Type == html.ElementNode && c.DataAtom == atom.A {
+			linked += len(normalizeSpace(textOf(c)))
+		}
+	})
+	return min(float64(linked)/float64(total), 1)
+}
+
+// walk visits n and its descendants in document order.
+func walk(n *html.Node, fn func(*html.Node)) {
+	fn(n)
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		walk(c, fn)
+	}
+}
+
+// find returns the first descendant element with the given tag.
+func find(n *html.Node, a atom.Atom) *html.Node {
+	var found *html.Node
+	walk(n, func(c *html.Node) {
+		if found == nil && c.Type == html.ElementNode && c.DataAtom == a {
+			found = c
+		}
+	})
+	return found
+}
+
+// canonicalLink returns the href of the first <link rel="canonical">.
+func canonicalLink(doc *html.Node) string {
+	href := ""
+	walk(doc, func(n *html.Node) {
+		if href != "" || n.Type != html.ElementNode || n.DataAtom != atom.Link {
+			return
+		}
+		for _, rel := range strings.Fields(strings.ToLower(attr(n, "rel"))) {
+			if rel == "canonical" {
+				href = strings.TrimSpace(attr(n, "href"))
+			}
+		}
+	})
+	return href
+}
+
+// textOf concatenates the text nodes beneath n.
+func textOf(n *html.Node) string {
+	if n == nil {
+		return ""
+	}
+	var b strings.Builder
+	walk(n, func(c *html.Node) {
+		if c.Type == html.TextNode {
+			b.WriteString(c.Data)
+		}
+	})
+	return b.String()
+}
+
+// attr returns the value of the named attribute, or "".
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// normalizeSpace collapses runs of whitespace into single spaces.
+func normalizeSpace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
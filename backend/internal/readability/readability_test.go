@@ -0,0 +1,54 @@
+package readability
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const page = `<!doctype html>
+<html><head><title>Example Post</title><link rel="canonical" href="https://example.com/posts/example"><script>var tracking = 1;</script></head>
+<body>
+  <div id="nav" class="menu"><a href="/">Home</a> <a href="/about">About</a> <a href="/archive">Archive</a></div>
+  <div class="sidebar"><p>Subscribe to our newsletter, follow us, and share this with your friends today.</p></div>
+  <div class="post-content">
+    <h1>Example Post</h1>
+    <p>The first paragraph of the story explains, at some length, what happened and why it matters to readers.</p>
+    <p>A second paragraph adds detail, context, and a few quotes from the people involved in the events.</p>
+    <p>Finally, the third paragraph wraps up the story, pointing at what to expect next, and when.</p>
+  </div>
+  <div class="comments"><p>Great post, thanks for writing it up, I learned a lot from this one!</p></div>
+  <footer><p>Copyright Example Inc. All rights reserved, all wrongs reversed, forever.</p></footer>
+</body></html>`
+
+func TestExtract_PicksMainContent(t *testing.T) {
+	a, err := Extract(strings.NewReader(page))
+	if err != nil {
+		t.Fatalf("extract: %v", err)
+	}
+	if a.Title != "Example Post" {
+		t.Fatalf("title: %q", a.Title)
+	}
+	if a.Canonical != "https://example.com/posts/example" {
+		t.Fatalf("canonical: %q", a.Canonical)
+	}
+	for _, want := range []string{"first paragraph", "second paragraph", "third paragraph"} {
+		if !strings.Contains(a.Text, want) {
+			t.Fatalf("missing %q in %q", want, a.Text)
+		}
+	}
+	for _, unwanted := range []string{"newsletter", "Great post", "Copyright", "Archive", "tracking"} {
+		if strings.Contains(a.Text, unwanted) || strings.Contains(a.HTML, unwanted) {
+			t.Fatalf("boilerplate %q leaked into %q", unwanted, a.HTML)
+		}
+	}
+	if !strings.Contains(a.HTML, "<p>") {
+		t.Fatalf("expected HTML fragment, got %q", a.HTML)
+	}
+}
+
+func TestExtract_EmptyPage(t *testing.T) {
+	if _, err := Extract(strings.NewReader(`<html><body><script>x()</script></body></html>`)); !errors.Is(err, ErrNoContent) {
+		t.Fatalf("expected ErrNoContent, got %v", err)
+	}
+}
@@ -0,0 +1,137 @@
+package scheduler
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fujidaiti/poppo-press/backend/internal/aggregator"
+)
+
+// slot is a daily publish time; each one produces its own edition.
+type slot struct {
+	Name         string
+	Hour, Minute int
+}
+
+// slotName restricts slot names to what reads well in URLs and listings.
+var slotName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_:-]*$`)
+
+// parseSlots parses the publish time setting: a comma-separated list of
+// "HH:MM" or "name=HH:MM" entries, e.g. "morning=07:00,evening=18:30". A
+// single unnamed time is the daily slot (aggregator.DailySlot); with several
+// slots, unnamed ones are named after their time. Slots are returned in
+// order of their time of day.
+func parseSlots(spec string) ([]slot, error) {
+	parts := strings.Split(spec, ",")
+	slots := make([]slot, 0, len(parts))
+	names, times := map[string]bool{}, map[int]bool{}
+	for _, p := range parts {
+		p = strings.TrimSpace(p)
+		name, clock, named := strings.Cut(p, "=")
+		if !named {
+			name, clock = "", p
+		}
+		name, clock = strings.TrimSpace(name), strings.TrimSpace(clock)
+		t, err := time.Parse("15:04", clock)
+		if err != nil {
+			return nil, fmt.Errorf("publish time %q: want HH:MM or name=HH:MM", p)
+		}
+		if named && !slotName.MatchString(name) {
+			return nil, fmt.Errorf("publish time %q: invalid slot name", p)
+		}
+		if !named {
+			name = aggregator.DailySlot
+			if len(parts) > 1 {
+				name = t.Format("15:04")
+			}
+		}
+		if names[name] {
+			return nil, fmt.Errorf("publish time %q: duplicate slot %s", p, name)
+		}
+		minutes := t.Hour()*60 + t.Minute()
+		if times[minutes] {
+			return nil, fmt.Errorf("publish time %q: duplicate time %s", p, clock)
+		}
+		names[name], times[minutes] = true, true
+		slots = append(slots, slot{Name: name, Hour: t.Hour(), Minute: t.Minute()})
+	}
+	sort.Slice(slots, func(i, j int) bool {
+		return slots[i].Hour*60+slots[i].Minute < slots[j].Hour*60+slots[j].Minute
+	})
+	return slots, nil
+}
+
+// publication is the edition of a slot on a local date, due at At.
+type publication struct {
+	Slot      string
+	LocalDate string
+	At        time.Time
+}
+
+// publishSchedule is the cron.Schedule of the publish slots in loc. Times
+// are computed per local date with time.Date, so a slot keeps its wall clock
+// time across DST changes and is due exactly once a day: a time skipped by
+// the clocks springing forward is shifted forward by the jump, and one
+// repeated when they fall back is due only once.
+type publishSchedule struct {
+	loc   *time.Location
+	slots []slot
+}
+
+// on returns the publications of the local date y-m-d in order.
+func (p publishSchedule) on(y int, m time.Month, d int) []publication {
+	out := make([]publication, 0, len(p.slots))
+	date := time.Date(y, m, d, 0, 0, 0, 0, time.UTC).Format("2006-01-02")
+	for _, s := range p.slots {
+		out = append(out, publication{Slot: s.Name, LocalDate: date, At: time.Date(y, m, d, s.Hour, s.Minute, 0, 0, p.loc)})
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].At.Before(out[j].At) })
+	return out
+}
+
+// Next implements cron.Schedule, returning when the first publication after
+// t is due.
+func (p publishSchedule) Next(t time.Time) time.Time {
+	return p.next(t).At
+}
+
+// next returns the first publication after t.
+func (p publishSchedule) next(t time.Time) publication {
+	lt := t.In(p.loc)
+	// the day before covers slots pushed past midnight by a DST jump
+	for day := -1; day <= 1; day++ {
+		for _, pub := range p.on(lt.Year(), lt.Month(), lt.Day()+day) {
+			if pub.At.After(t) {
+				return pub
+			}
+		}
+	}
+	return publication{}
+}
+
+// between returns the publications after from up to and including to, in
+// order.
+func (p publishSchedule) between(from, to time.Time) []publication {
+	var out []publication
+	for pub := p.next(from); !pub.At.IsZero() && !pub.At.After(to); pub = p.next(pub.At) {
+		out = append(out, pub)
+	}
+	return out
+}
+
+// last returns the latest publication due at or before t.
+func (p publishSchedule) last(t time.Time) (publication, bool) {
+	lt := t.In(p.loc)
+	for day := 1; day >= -2; day-- {
+		pubs := p.on(lt.Year(), lt.Month(), lt.Day()+day)
+		for i := len(pubs) - 1; i >= 0; i-- {
+			if !pubs[i].At.After(t) {
+				return pubs[i], true
+			}
+		}
+	}
+	return publication{}, false
+}
@@ -0,0 +1,76 @@
+package scheduler
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseSlots(t *testing.T) {
+	for _, c := range []struct {
+		spec string
+		want []slot
+	}{
+		{"08:00", []slot{{"daily", 8, 0}}},
+		{"evening=18:30, morning=07:05", []slot{{"morning", 7, 5}, {"evening", 18, 30}}},
+		{"19:00,07:00", []slot{{"07:00", 7, 0}, {"19:00", 19, 0}}},
+	} {
+		got, err := parseSlots(c.spec)
+		if err != nil || !reflect.DeepEqual(got, c.want) {
+			t.Errorf("parseSlots(%q) = %+v, %v; want %+v", c.spec, got, err, c.want)
+		}
+	}
+	for _, bad := range []string{"", "8am", "25:00", "a=07:00,a=08:00", "a=07:00,b=07:00", "bad name=07:00", "=07:00"} {
+		if _, err := parseSlots(bad); err == nil {
+			t.Errorf("parseSlots(%q): expected an error", bad)
+		}
+	}
+}
+
+func TestPublishSchedule_DST(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("no tzdata: %v", err)
+	}
+	utc := func(s string) time.Time {
+		v, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	slots, _ := parseSlots("night=02:30,morning=08:00")
+	sched := publishSchedule{loc: berlin, slots: slots}
+	for _, c := range []struct {
+		name  string
+		from  string
+		wants []string
+	}{
+		// clocks go from 02:00 to 03:00 on 2025-03-30
+		{"spring forward", "2025-03-29T00:00:00Z", []string{
+			"2025-03-29T01:30:00Z", "2025-03-29T07:00:00Z", // CET
+			"2025-03-30T01:30:00Z", "2025-03-30T06:00:00Z", // 02:30 does not exist; 08:00 CEST
+			"2025-03-31T00:30:00Z", "2025-03-31T06:00:00Z",
+		}},
+		// clocks go from 03:00 back to 02:00 on 2025-10-26
+		{"fall back", "2025-10-25T00:00:00Z", []string{
+			"2025-10-25T00:30:00Z", "2025-10-25T06:00:00Z",
+			"2025-10-26T01:30:00Z", "2025-10-26T07:00:00Z", // 02:30 once, not twice
+			"2025-10-27T01:30:00Z", "2025-10-27T07:00:00Z",
+		}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			at := utc(c.from)
+			for _, want := range c.wants {
+				at = sched.Next(at)
+				if !at.Equal(utc(want)) {
+					t.Fatalf("next = %s, want %s", at.UTC().Format(time.RFC3339), want)
+				}
+				pub, ok := sched.last(at.Add(time.Second))
+				if !ok || !pub.At.Equal(at) || pub.LocalDate != at.In(berlin).Format("2006-01-02") {
+					t.Fatalf("last(%s) = %+v", at, pub)
+				}
+			}
+		})
+	}
+}
@@ -3,14 +3,19 @@ package scheduler
 import (
 	"context"
 	"database/sql"
+	"fmt"
 	"log"
+	"net/http"
 	"time"
 
 	"github.com/robfig/cron/v3"
 
 	"github.com/fujidaiti/poppo-press/backend/internal/aggregator"
 	"github.com/fujidaiti/poppo-press/backend/internal/config"
+	"github.com/fujidaiti/poppo-press/backend/internal/credentials"
+	"github.com/fujidaiti/poppo-press/backend/internal/db"
 	"github.com/fujidaiti/poppo-press/backend/internal/fetcher"
+	"github.com/fujidaiti/poppo-press/backend/internal/websub"
 )
 
 type Scheduler struct {
@@ -24,34 +29,163 @@ func New() *Scheduler {
 func (s *Scheduler) Start() { s.c.Start() }
 func (s *Scheduler) Stop()  { ctx := s.c.Stop(); <-ctx.Done() }
 
-func (s *Scheduler) HourlyFetch(database *sql.DB) error {
-	_, err := s.c.AddFunc("0 * * * *", func() {
-		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+// FetchDue registers the polling job. Every cfg.FetchTick it fetches the
+// sources whose own schedule has come due, so each source is polled at its
+// own interval and fetches are spread out rather than bunched together. A run
+// may take up to cfg.FetchRunTimeout and is skipped while the previous one is
+// still going; a single slow source is bounded by cfg.FetchSourceTimeout and
+// does not hold back the others. Requests go through client; source
+// credentials are opened with cfg.SecretKey, which must be well-formed.
+func (s *Scheduler) FetchDue(database *sql.DB, cfg config.Config, client *http.Client) error {
+	box, err := credentials.NewBox(cfg.SecretKey)
+	if err != nil {
+		return err
+	}
+	opts := fetcher.FromConfig(cfg, box)
+	job := cron.NewChain(cron.SkipIfStillRunning(cron.DefaultLogger)).Then(cron.FuncJob(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.FetchRunTimeout)
 		defer cancel()
-		if err := fetcher.FetchAllSources(ctx, database, nil); err != nil {
+		results, err := fetcher.FetchAllSources(ctx, database, client, opts)
+		if err != nil {
 			log.Printf("fetch job error: %v", err)
-		} else {
-			log.Printf("fetch job ok")
+			return
+		}
+		failed, items := 0, 0
+		for _, r := range results {
+			if r.Err != nil {
+				failed++
+				log.Printf("fetch source %d failed: %v", r.SourceID, r.Err)
+			}
+			items += r.Items
+		}
+		if len(results) > 0 {
+			log.Printf("fetch job ok: %d sources, %d failed, %d items", len(results), failed, items)
+		}
+	}))
+	_, err = s.c.AddJob("@every "+cfg.FetchTick.String(), job)
+	return err
+}
+
+// WebSubRenew registers the job that subscribes sources to the WebSub hubs
+// their feeds advertise and renews leases before they expire. It is a no-op
+// unless cfg.PublicURL is set. Requests go through client.
+func (s *Scheduler) WebSubRenew(database *sql.DB, cfg config.Config, client *http.Client) error {
+	if cfg.PublicURL == "" {
+		return nil
+	}
+	opts := websub.Options{PublicURL: cfg.PublicURL, Lease: cfg.WebSubLease}
+	_, err := s.c.AddFunc("*/10 * * * *", func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		defer cancel()
+		n, err := websub.RenewDue(ctx, database, client, opts)
+		if err != nil {
+			log.Printf("websub renew: %v", err)
+		}
+		if n > 0 {
+			log.Printf("websub renew ok: %d subscribe requests accepted", n)
 		}
 	})
 	return err
 }
 
+// DailyAssemble registers the edition jobs: at each publish time of
+// cfg.PublishTime (see parseSlots), in the IANA zone cfg.Timezone, the
+// edition of that slot is assembled for the local date. A job that runs late,
+// after the machine slept through publish times, also assembles the editions
+// it missed, going back at most cfg.PublishCatchUp. A malformed publish time
+// or an unknown zone is an error.
 func (s *Scheduler) DailyAssemble(database *sql.DB, cfg config.Config) error {
-	loc, err := time.LoadLocation(cfg.Timezone)
+	sched, err := publishScheduleFromConfig(cfg)
 	if err != nil {
-		loc = time.Local
+		return err
 	}
-	// Run at 08:00 local time
-	_, err = s.c.AddFunc("0 0 8 * *", func() {
-		now := time.Now().In(loc)
-		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	job := cron.NewChain(cron.SkipIfStillRunning(cron.DefaultLogger)).Then(cron.FuncJob(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
 		defer cancel()
-		if err := aggregator.AssembleDailyEdition(ctx, database, loc, now); err != nil {
-			log.Printf("assemble job error: %v", err)
-		} else {
-			log.Printf("assemble job ok for %s", now.Format("2006-01-02"))
-		}
-	})
+		logAssembled(assembleDue(ctx, database, sched, time.Now(), cfg.PublishCatchUp, true))
+	}))
+	s.c.Schedule(sched, job)
+	return nil
+}
+
+// CatchUp assembles, in order and with their own windows, the editions of
+// the publish times missed while the server was down, going back at most
+// cfg.PublishCatchUp; it is meant to run at startup. Nothing is assembled
+// before the first edition.
+func (s *Scheduler) CatchUp(database *sql.DB, cfg config.Config) error {
+	sched, err := publishScheduleFromConfig(cfg)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	pubs, err := assembleDue(ctx, database, sched, time.Now(), cfg.PublishCatchUp, false)
+	logAssembled(pubs, nil)
 	return err
 }
+
+// publishScheduleFromConfig returns the schedule of cfg.PublishTime in
+// cfg.Timezone.
+func publishScheduleFromConfig(cfg config.Config) (publishSchedule, error) {
+	loc, err := time.LoadLocation(cfg.Timezone)
+	if err != nil {
+		return publishSchedule{}, fmt.Errorf("timezone %q: %w", cfg.Timezone, err)
+	}
+	slots, err := parseSlots(cfg.PublishTime)
+	if err != nil {
+		return publishSchedule{}, err
+	}
+	return publishSchedule{loc: loc, slots: slots}, nil
+}
+
+// assembleDue assembles, in order, the missing editions of the publications
+// due by now: those after the latest edition's cutoff and at most limit
+// before now (none when limit is not positive). With current set, the latest
+// publication is assembled regardless of limit, and also when there is no
+// edition yet; otherwise nothing is assembled before the first edition.
+// Editions already assembled for a slot and date are left alone. It returns
+// the publications assembled.
+func assembleDue(ctx context.Context, database *sql.DB, sched publishSchedule, now time.Time, limit time.Duration, current bool) ([]publication, error) {
+	latest, ok, err := db.LatestEditionCutoff(ctx, database)
+	if err != nil {
+		return nil, err
+	}
+	var due []publication
+	if ok {
+		from := now.Add(-max(limit, 0))
+		if latest.After(from) {
+			from = latest
+		}
+		due = sched.between(from, now)
+	}
+	if current && len(due) == 0 {
+		if pub, found := sched.last(now); found && (!ok || pub.At.After(latest)) {
+			due = append(due, pub)
+		}
+	}
+	var done []publication
+	for _, pub := range due {
+		exists, err := db.EditionExists(ctx, database, pub.LocalDate, pub.Slot)
+		if err != nil {
+			return done, err
+		}
+		if exists {
+			continue
+		}
+		if err := aggregator.AssembleEdition(ctx, database, sched.loc, pub.Slot, pub.At); err != nil {
+			return done, fmt.Errorf("edition %s %s: %w", pub.LocalDate, pub.Slot, err)
+		}
+		done = append(done, pub)
+	}
+	return done, nil
+}
+
+// logAssembled logs the outcome of assembleDue.
+func logAssembled(pubs []publication, err error) {
+	for _, pub := range pubs {
+		log.Printf("assemble job ok for %s %s", pub.LocalDate, pub.Slot)
+	}
+	if err != nil {
+		log.Printf("assemble job error: %v", err)
+	}
+}
@@ -0,0 +1,92 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/fujidaiti/poppo-press/backend/internal/aggregator"
+	"github.com/fujidaiti/poppo-press/backend/internal/testutil"
+)
+
+func TestAssembleDue_CatchesUpMissedEditions(t *testing.T) {
+	database, cleanup := testutil.OpenTestDB(t, "admin-pass")
+	defer cleanup()
+	ctx := context.Background()
+	slots, _ := parseSlots("morning=08:00,evening=18:00")
+	sched := publishSchedule{loc: time.UTC, slots: slots}
+	day := func(d, hour int) time.Time { return time.Date(2025, 10, d, hour, 0, 0, 0, time.UTC) }
+
+	if pubs, err := assembleDue(ctx, database, sched, day(20, 9), 48*time.Hour, false); err != nil || len(pubs) != 0 {
+		t.Fatalf("nothing is due before the first edition: %+v %v", pubs, err)
+	}
+	if err := aggregator.AssembleEdition(ctx, database, time.UTC, "morning", day(17, 8)); err != nil {
+		t.Fatalf("assemble: %v", err)
+	}
+	mustExec(t, database, "INSERT INTO source(id, url) VALUES(1, 'https://ex/feed')")
+	for id, at := range map[int64]time.Time{1: day(18, 12), 2: day(19, 10)} {
+		ts := at.Format(time.RFC3339)
+		mustExec(t, database, "INSERT INTO article(id, source_id, canonical_url, title, published_at, created_at, canonical_id) VALUES(?, 1, ?, 'T', ?, ?, ?)",
+			id, ts, ts, at.Format(time.DateTime), ts)
+	}
+
+	// down from the 17th's evening until the 20th at 09:00, catching up 48h
+	pubs, err := assembleDue(ctx, database, sched, day(20, 9), 48*time.Hour, false)
+	if err != nil {
+		t.Fatalf("catch up: %v", err)
+	}
+	want := []publication{
+		{"evening", "2025-10-18", day(18, 18)},
+		{"morning", "2025-10-19", day(19, 8)},
+		{"evening", "2025-10-19", day(19, 18)},
+		{"morning", "2025-10-20", day(20, 8)},
+	}
+	if !reflect.DeepEqual(pubs, want) {
+		t.Fatalf("caught up %+v, want %+v", pubs, want)
+	}
+	// the first edition caught up starts where the last one before the
+	// downtime ended, beyond the catch-up limit
+	if got := editionArticles(t, database, "2025-10-18", "evening"); !reflect.DeepEqual(got, []int64{1}) {
+		t.Fatalf("evening of the 18th holds %v", got)
+	}
+	if got := editionArticles(t, database, "2025-10-19", "evening"); !reflect.DeepEqual(got, []int64{2}) {
+		t.Fatalf("evening of the 19th holds %v", got)
+	}
+	if pubs, err := assembleDue(ctx, database, sched, day(20, 9), 48*time.Hour, false); err != nil || len(pubs) != 0 {
+		t.Fatalf("expected nothing left to catch up: %+v %v", pubs, err)
+	}
+
+	// the job assembles its own edition even with catching up disabled
+	pubs, err = assembleDue(ctx, database, sched, day(21, 8).Add(time.Second), -1, true)
+	if err != nil || len(pubs) != 1 || pubs[0].Slot != "morning" || pubs[0].LocalDate != "2025-10-21" {
+		t.Fatalf("expected the morning edition of the 21st: %+v %v", pubs, err)
+	}
+}
+
+func editionArticles(t *testing.T, database *sql.DB, localDate, slot string) []int64 {
+	t.Helper()
+	rows, err := database.Query(`SELECT ea.article_id FROM edition_article ea JOIN edition e ON e.id = ea.edition_id
+WHERE e.local_date = ? AND e.slot = ? ORDER BY ea.position`, localDate, slot)
+	if err != nil {
+		t.Fatalf("edition articles: %v", err)
+	}
+	defer rows.Close()
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			t.Fatalf("scan: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func mustExec(t *testing.T, database *sql.DB, query string, args ...any) {
+	t.Helper()
+	if _, err := database.Exec(query, args...); err != nil {
+		t.Fatalf("exec %q: %v", query, err)
+	}
+}
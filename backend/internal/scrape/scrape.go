@@ -0,0 +1,186 @@
+// Package scrape builds feeds from web pages that publish none. A source's
+// configuration names CSS selectors for the element holding each item and,
+// within it, the item's title, link, date and summary.
+package scrape
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/andybalholm/cascadia"
+	"github.com/mmcdole/gofeed"
+
+	"github.com/fujidaiti/poppo-press/backend/internal/httpclient"
+)
+
+// ErrNoItems is returned when the item selector matches nothing that has a
+// title.
+var ErrNoItems = errors.New("scrape: no items found")
+
+// Config selects the items of a page. Item and Title are required; the
+// others are optional. Title, Link, Date and Summary are matched within each
+// item element.
+type Config struct {
+	Item    string `json:"item"`
+	Title   string `json:"title"`
+	Link    string `json:"link,omitempty"`
+	Date    string `json:"date,omitempty"`
+	Summary string `json:"summary,omitempty"`
+}
+
+// Validate reports whether the required selectors are present and every
+// selector parses.
+func (c Config) Validate() error {
+	if strings.TrimSpace(c.Item) == "" || strings.TrimSpace(c.Title) == "" {
+		return errors.New("item and title selectors are required")
+	}
+	for name, sel := range map[string]string{"item": c.Item, "title": c.Title, "link": c.Link, "date": c.Date, "summary": c.Summary} {
+		if sel == "" {
+			continue
+		}
+		if _, err := cascadia.Compile(sel); err != nil {
+			return fmt.Errorf("invalid %s selector: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// dateLayouts are tried in order on date text and datetime attributes.
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"2006/01/02",
+	time.RFC1123Z,
+	time.RFC1123,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"January 2, 2006",
+	"Jan 2, 2006",
+	"2 January 2006",
+	"2 Jan 2006",
+}
+
+// Fetch downloads rawURL and builds its feed.
+func Fetch(ctx context.Context, client *http.Client, rawURL string, cfg Config) (*gofeed.Feed, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("scrape: %s: status %d", rawURL, resp.StatusCode)
+	}
+	if err := httpclient.CheckContentType(resp.Header); err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return Build(body, resp.Request.URL, cfg)
+}
+
+// Build parses an HTML page served at base into a feed titled after the
+// page. Items without a title are skipped; links are resolved against base
+// and default to the first link of the item. Items keep page order.
+func Build(body []byte, base *url.URL, cfg Config) (*gofeed.Feed, error) {
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	feed := &gofeed.Feed{
+		Title:    strings.TrimSpace(doc.Find("title").First().Text()),
+		Link:     base.String(),
+		FeedType: "scrape",
+	}
+	doc.Find(cfg.Item).Each(func(_ int, sel *goquery.Selection) {
+		title := sel.Find(cfg.Title).First()
+		text := collapse(title.Text())
+		if text == "" {
+			return
+		}
+		item := &gofeed.Item{Title: text, Link: itemLink(sel, title, cfg.Link, base)}
+		item.GUID = item.Link
+		if cfg.Date != "" {
+			if t, ok := itemDate(sel.Find(cfg.Date).First()); ok {
+				item.PublishedParsed = &t
+				item.Published = t.Format(time.RFC3339)
+			}
+		}
+		if cfg.Summary != "" {
+			if h, err := sel.Find(cfg.Summary).First().Html(); err == nil {
+				item.Description = strings.TrimSpace(h)
+			}
+		}
+		feed.Items = append(feed.Items, item)
+	})
+	if len(feed.Items) == 0 {
+		return nil, ErrNoItems
+	}
+	return feed, nil
+}
+
+// itemLink finds the link of an item: the href of the link selector's match,
+// of the title element or its enclosing anchor, or of the first anchor in
+// the item, resolved against base. It returns "" when there is none.
+func itemLink(item, title *goquery.Selection, selector string, base *url.URL) string {
+	var href string
+	switch {
+	case selector != "":
+		href, _ = item.Find(selector).First().Attr("href")
+	default:
+		if h, ok := title.Attr("href"); ok {
+			href = h
+		} else if h, ok := title.Find("a[href]").First().Attr("href"); ok {
+			href = h
+		} else if h, ok := title.Closest("a[href]").Attr("href"); ok {
+			href = h
+		} else {
+			href, _ = item.Find("a[href]").First().Attr("href")
+		}
+	}
+	href = strings.TrimSpace(href)
+	if href == "" {
+		return ""
+	}
+	u, err := base.Parse(href)
+	if err != nil {
+		return ""
+	}
+	return u.String()
+}
+
+// itemDate parses the datetime attribute of sel, falling back to its text.
+func itemDate(sel *goquery.Selection) (time.Time, bool) {
+	candidates := []string{collapse(sel.Text())}
+	if dt, ok := sel.Attr("datetime"); ok {
+		candidates = append([]string{strings.TrimSpace(dt)}, candidates...)
+	}
+	for _, c := range candidates {
+		for _, layout := range dateLayouts {
+			if t, err := time.Parse(layout, c); err == nil {
+				return t, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// collapse trims s and folds runs of whitespace into single spaces.
+func collapse(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -0,0 +1,67 @@
+package scrape
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+)
+
+const page = `<html><head><title>Example News</title></head><body>
+<nav><a href="/about">About</a></nav>
+<article class="post">
+  <h2><a href="/posts/2">Second   post</a></h2>
+  <time datetime="2025-03-02T09:00:00Z">March 2</time>
+  <p class="lede">The <b>second</b> one.</p>
+</article>
+<article class="post">
+  <h2>First post</h2>
+  <span class="date">January 5, 2025</span>
+  <a class="more" href="https://other.example/first">Read more</a>
+</article>
+<article class="post"><h2> </h2></article>
+</body></html>`
+
+func TestBuild(t *testing.T) {
+	base, _ := url.Parse("https://example.com/news/")
+	feed, err := Build([]byte(page), base, Config{Item: "article.post", Title: "h2", Date: "time, .date", Summary: ".lede"})
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	if feed.Title != "Example News" || len(feed.Items) != 2 {
+		t.Fatalf("unexpected feed: %q with %d items", feed.Title, len(feed.Items))
+	}
+	first, second := feed.Items[0], feed.Items[1]
+	if first.Title != "Second post" || first.Link != "https://example.com/posts/2" || first.GUID != first.Link {
+		t.Fatalf("unexpected first item: %+v", first)
+	}
+	if first.PublishedParsed == nil || !first.PublishedParsed.Equal(time.Date(2025, 3, 2, 9, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected first date: %v", first.PublishedParsed)
+	}
+	if first.Description != "The <b>second</b> one." {
+		t.Fatalf("unexpected summary: %q", first.Description)
+	}
+	if second.Link != "https://other.example/first" || second.PublishedParsed == nil || second.PublishedParsed.Day() != 5 || second.Description != "" {
+		t.Fatalf("unexpected second item: %+v", second)
+	}
+
+	if _, err := Build([]byte(page), base, Config{Item: "li.none", Title: "h2"}); !errors.Is(err, ErrNoItems) {
+		t.Fatalf("expected ErrNoItems, got %v", err)
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	for _, c := range []Config{
+		{Title: "h2"},
+		{Item: "article"},
+		{Item: "article", Title: "h2[", Link: "a"},
+		{Item: "article", Title: "h2", Date: ":nope("},
+	} {
+		if err := c.Validate(); err == nil {
+			t.Fatalf("expected %+v to be invalid", c)
+		}
+	}
+	if err := (Config{Item: "article", Title: "h2 a", Link: "a.more"}).Validate(); err != nil {
+		t.Fatalf("expected valid config: %v", err)
+	}
+}
@@ -0,0 +1,19 @@
+package testutil
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/fujidaiti/poppo-press/backend/internal/httpclient"
+)
+
+// HTTPClient returns an outbound client with the default options except
+// that loopback destinations, where httptest servers listen, are allowed.
+func HTTPClient(t *testing.T) *http.Client {
+	t.Helper()
+	c, err := httpclient.New(httpclient.Options{AllowPrivate: []string{"127.0.0.0/8", "::1"}})
+	if err != nil {
+		t.Fatalf("http client: %v", err)
+	}
+	return c
+}
@@ -0,0 +1,232 @@
+// Package websub subscribes sources to their WebSub (PubSubHubbub) hubs and
+// handles the hub's callbacks: verification of intent and signed content
+// distribution. Pushed feeds are ingested through the fetcher's upsert path.
+// While a subscription's lease is valid the source is not polled; once it
+// lapses, polling resumes until the subscription is renewed.
+package websub
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+
+	"github.com/fujidaiti/poppo-press/backend/internal/db"
+	"github.com/fujidaiti/poppo-press/backend/internal/fetcher"
+	"github.com/fujidaiti/poppo-press/backend/internal/httpclient"
+)
+
+// CallbackPath is the route prefix of subscription callbacks; the callback
+// token follows it.
+const CallbackPath = "/v1/websub/callback/"
+
+// Errors reported by callback handling.
+var (
+	ErrUnknownSubscription = errors.New("websub: unknown subscription")
+	ErrBadSignature        = errors.New("websub: missing or invalid signature")
+)
+
+// Options configures subscription management.
+type Options struct {
+	PublicURL   string        // externally reachable base URL of this server
+	Lease       time.Duration // lease requested from hubs (default 10 days)
+	RenewBefore time.Duration // renew leases this long before expiry (default 1h)
+	RetryAfter  time.Duration // retry failed or unverified requests after this (default 6h)
+}
+
+// withDefaults fills zero-valued options.
+func (o Options) withDefaults() Options {
+	if o.Lease <= 0 {
+		o.Lease = 240 * time.Hour
+	}
+	if o.RenewBefore <= 0 {
+		o.RenewBefore = time.Hour
+	}
+	if o.RetryAfter <= 0 {
+		o.RetryAfter = 6 * time.Hour
+	}
+	return o
+}
+
+// CallbackURL returns the public callback URL for a subscription token.
+func CallbackURL(publicURL, token string) string {
+	return strings.TrimRight(publicURL, "/") + CallbackPath + token
+}
+
+// RenewDue sends subscribe requests for every subscription that is new,
+// close to lease expiry, or due for a retry. It returns the number of
+// requests the hubs accepted.
+func RenewDue(ctx context.Context, database *sql.DB, client *http.Client, opts Options) (int, error) {
+	opts = opts.withDefaults()
+	if opts.PublicURL == "" {
+		return 0, errors.New("websub: public URL not configured")
+	}
+	if client == nil {
+		client = httpclient.Default()
+	}
+	due, err := db.ListWebSubDue(ctx, database, time.Now(), opts.RenewBefore, opts.RetryAfter)
+	if err != nil {
+		return 0, err
+	}
+	var errs []error
+	n := 0
+	for _, sub := range due {
+		if err := Subscribe(ctx, database, client, sub, opts); err != nil {
+			errs = append(errs, fmt.Errorf("source %d: %w", sub.SourceID, err))
+			continue
+		}
+		n++
+	}
+	return n, errors.Join(errs...)
+}
+
+// Subscribe asks the hub to (re)subscribe the callback of sub. The hub then
+// verifies intent asynchronously through the callback. An active
+// subscription stays active while its renewal is pending.
+func Subscribe(ctx context.Context, database *sql.DB, client *http.Client, sub db.WebSubSubscription, opts Options) error {
+	opts = opts.withDefaults()
+	now := time.Now()
+	if sub.State != db.WebSubActive {
+		if err := db.SetWebSubState(ctx, database, sub.SourceID, db.WebSubPending, nil, "", now); err != nil {
+			return err
+		}
+	}
+	form := url.Values{
+		"hub.mode":          {"subscribe"},
+		"hub.topic":         {sub.TopicURL},
+		"hub.callback":      {CallbackURL(opts.PublicURL, sub.CallbackToken)},
+		"hub.secret":        {sub.Secret},
+		"hub.lease_seconds": {strconv.Itoa(int(opts.Lease / time.Second))},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.HubURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := client.Do(req)
+	if err == nil {
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			err = fmt.Errorf("hub answered %s", resp.Status)
+		}
+	}
+	if err != nil {
+		state := db.WebSubFailed
+		if sub.State == db.WebSubActive {
+			state = db.WebSubActive // keep pushes flowing until the lease runs out
+		}
+		_ = db.SetWebSubState(ctx, database, sub.SourceID, state, nil, err.Error(), time.Now())
+		return err
+	}
+	return nil
+}
+
+// Verify answers a hub's verification-of-intent request. For a confirmed
+// subscription it records the granted lease and returns the challenge to
+// echo; a denial is recorded and acknowledged with an empty challenge.
+// Requests for unknown tokens, other topics, or unsolicited modes fail with
+// ErrUnknownSubscription.
+func Verify(ctx context.Context, database *sql.DB, token string, q url.Values, now time.Time) (string, error) {
+	sub, err := db.GetWebSubByToken(ctx, database, token)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrUnknownSubscription
+	}
+	if err != nil {
+		return "", err
+	}
+	if q.Get("hub.topic") != sub.TopicURL {
+		return "", ErrUnknownSubscription
+	}
+	switch q.Get("hub.mode") {
+	case "subscribe":
+		if sub.State != db.WebSubPending && sub.State != db.WebSubActive {
+			return "", ErrUnknownSubscription
+		}
+		lease, err := strconv.Atoi(q.Get("hub.lease_seconds"))
+		if err != nil || lease <= 0 {
+			return "", fmt.Errorf("websub: invalid lease %q", q.Get("hub.lease_seconds"))
+		}
+		expires := now.Add(time.Duration(lease) * time.Second)
+		if err := db.SetWebSubState(ctx, database, sub.SourceID, db.WebSubActive, &expires, "", now); err != nil {
+			return "", err
+		}
+		return q.Get("hub.challenge"), nil
+	case "denied":
+		reason := q.Get("hub.reason")
+		if reason == "" {
+			reason = "denied by hub"
+		}
+		return "", db.SetWebSubState(ctx, database, sub.SourceID, db.WebSubDenied, nil, reason, now)
+	}
+	return "", ErrUnknownSubscription
+}
+
+// Subscription returns the subscription of a callback token, failing with
+// ErrUnknownSubscription when there is none.
+func Subscription(ctx context.Context, database *sql.DB, token string) (db.WebSubSubscription, error) {
+	sub, err := db.GetWebSubByToken(ctx, database, token)
+	if errors.Is(err, sql.ErrNoRows) {
+		return db.WebSubSubscription{}, ErrUnknownSubscription
+	}
+	return sub, err
+}
+
+// Receive handles a content distribution request for sub, looked up with
+// Subscription: it checks the X-Hub-Signature HMAC against the subscription
+// secret and ingests the pushed feed. It returns the number of items
+// written.
+func Receive(ctx context.Context, database *sql.DB, sub db.WebSubSubscription, h http.Header, body []byte) (int, error) {
+	if !validSignature(h.Get("X-Hub-Signature"), sub.Secret, body) {
+		return 0, ErrBadSignature
+	}
+	feed, err := gofeed.NewParser().Parse(bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("websub: parse push: %w", err)
+	}
+	return fetcher.IngestFeed(ctx, database, sub.SourceID, feed)
+}
+
+// validSignature checks an X-Hub-Signature value of the form
+// "method=hexdigest" against the HMAC of body keyed with secret.
+func validSignature(header, secret string, body []byte) bool {
+	method, digest, ok := strings.Cut(header, "=")
+	if !ok {
+		return false
+	}
+	var newHash func() hash.Hash
+	switch strings.ToLower(method) {
+	case "sha1":
+		newHash = sha1.New
+	case "sha256":
+		newHash = sha256.New
+	case "sha384":
+		newHash = sha512.New384
+	case "sha512":
+		newHash = sha512.New
+	default:
+		return false
+	}
+	want, err := hex.DecodeString(digest)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(newHash, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(mac.Sum(nil), want)
+}
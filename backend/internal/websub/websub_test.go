@@ -0,0 +1,195 @@
+package websub_test
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fujidaiti/poppo-press/backend/internal/db"
+	"github.com/fujidaiti/poppo-press/backend/internal/fetcher"
+	"github.com/fujidaiti/poppo-press/backend/internal/httpserver"
+	"github.com/fujidaiti/poppo-press/backend/internal/testutil"
+	"github.com/fujidaiti/poppo-press/backend/internal/websub"
+)
+
+// fakeHub records subscribe requests so the test can play the hub's side of
+// the protocol.
+type fakeHub struct {
+	mu       sync.Mutex
+	requests []url.Values
+}
+
+func (h *fakeHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	_ = r.ParseForm()
+	h.mu.Lock()
+	h.requests = append(h.requests, r.PostForm)
+	h.mu.Unlock()
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (h *fakeHub) last() url.Values {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.requests[len(h.requests)-1]
+}
+
+const atomEntry = `<entry><id>%s</id><title>%s</title><link href="https://ex/%s"/><updated>2025-01-01T00:00:00Z</updated></entry>`
+
+func TestWebSub_SubscribeVerifyPushAndLapse(t *testing.T) {
+	database, cleanup := testutil.OpenTestDB(t, "admin-pass")
+	defer cleanup()
+	ctx := context.Background()
+
+	hub := &fakeHub{}
+	hubSrv := httptest.NewServer(hub)
+	defer hubSrv.Close()
+	var topic string
+	feedSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/atom+xml")
+		fmt.Fprintf(w, `<?xml version="1.0"?><feed xmlns="http://www.w3.org/2005/Atom"><title>T</title>
+<link rel="hub" href="%s"/><link rel="self" href="%s"/>%s</feed>`, hubSrv.URL, topic, fmt.Sprintf(atomEntry, "e1", "First", "1"))
+	}))
+	defer feedSrv.Close()
+	topic = feedSrv.URL + "/feed"
+	app := httptest.NewServer(httpserver.New(database).Handler())
+	defer app.Close()
+
+	srcID, err := db.CreateSource(ctx, database, db.CreateSourceParams{URL: feedSrv.URL})
+	if err != nil {
+		t.Fatalf("create source: %v", err)
+	}
+
+	// Polling discovers the hub
+	if _, err := fetcher.FetchAllSources(ctx, database, testutil.HTTPClient(t), fetcher.Options{}); err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	sub, err := db.GetWebSub(ctx, database, srcID)
+	if err != nil || sub.State != db.WebSubNew || sub.HubURL != hubSrv.URL || sub.TopicURL != topic {
+		t.Fatalf("expected discovered hub, got %+v (%v)", sub, err)
+	}
+
+	// The renewal job sends the subscribe request
+	opts := websub.Options{PublicURL: app.URL}
+	if n, err := websub.RenewDue(ctx, database, testutil.HTTPClient(t), opts); err != nil || n != 1 {
+		t.Fatalf("renew: %d %v", n, err)
+	}
+	form := hub.last()
+	callback := form.Get("hub.callback")
+	if form.Get("hub.mode") != "subscribe" || form.Get("hub.topic") != topic || !strings.HasPrefix(callback, app.URL+websub.CallbackPath) || form.Get("hub.secret") == "" {
+		t.Fatalf("unexpected subscribe request: %v", form)
+	}
+
+	// Verification of intent: a wrong topic is refused, the right one echoed
+	if code, _ := get(t, callback+"?"+url.Values{"hub.mode": {"subscribe"}, "hub.topic": {"https://other/"}, "hub.challenge": {"x"}, "hub.lease_seconds": {"3600"}}.Encode()); code != http.StatusNotFound {
+		t.Fatalf("wrong topic verified: %d", code)
+	}
+	code, body := get(t, callback+"?"+url.Values{"hub.mode": {"subscribe"}, "hub.topic": {topic}, "hub.challenge": {"c-123"}, "hub.lease_seconds": {"3600"}}.Encode())
+	if code != http.StatusOK || body != "c-123" {
+		t.Fatalf("verification: %d %q", code, body)
+	}
+	if due := eligible(t, database, srcID); due {
+		t.Fatal("source with an active subscription should not be polled")
+	}
+
+	// A signed push is ingested; a forged one is ignored
+	push := fmt.Sprintf(`<?xml version="1.0"?><feed xmlns="http://www.w3.org/2005/Atom"><title>T</title>%s</feed>`, fmt.Sprintf(atomEntry, "e2", "Pushed", "2"))
+	if code := post(t, callback, push, "sha256="+sign(form.Get("hub.secret"), push)); code != http.StatusAccepted {
+		t.Fatalf("push status: %d", code)
+	}
+	forged := fmt.Sprintf(`<?xml version="1.0"?><feed xmlns="http://www.w3.org/2005/Atom"><title>T</title>%s</feed>`, fmt.Sprintf(atomEntry, "e3", "Forged", "3"))
+	if code := post(t, callback, forged, "sha256="+sign("wrong", forged)); code != http.StatusAccepted {
+		t.Fatalf("forged push status: %d", code)
+	}
+	var titles string
+	if err := database.QueryRow("SELECT group_concat(title, ',') FROM (SELECT title FROM article WHERE source_id = ? ORDER BY title)", srcID).Scan(&titles); err != nil {
+		t.Fatalf("titles: %v", err)
+	}
+	if titles != "First,Pushed" {
+		t.Fatalf("unexpected articles: %s", titles)
+	}
+
+	// Unknown callbacks are refused before the body is read, and so are
+	// pushes larger than fetched feeds may be
+	if code := post(t, app.URL+websub.CallbackPath+"nope", push, ""); code != http.StatusNotFound {
+		t.Fatalf("unknown callback status: %d", code)
+	}
+	small := httptest.NewServer(httpserver.New(database, httpserver.WithMaxPushBody(int64(len(push)-1))).Handler())
+	defer small.Close()
+	if code := post(t, strings.Replace(callback, app.URL, small.URL, 1), push, "sha256="+sign(form.Get("hub.secret"), push)); code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("oversized push status: %d", code)
+	}
+
+	// Once the lease lapses, polling resumes on the regular schedule and the
+	// subscription is renewed
+	past := time.Now().Add(-time.Minute)
+	if err := db.SetWebSubState(ctx, database, srcID, db.WebSubActive, &past, "", time.Now()); err != nil {
+		t.Fatalf("expire: %v", err)
+	}
+	if _, err := database.Exec("UPDATE source_health SET next_fetch_at = ? WHERE source_id = ?", past.UTC().Format(time.RFC3339), srcID); err != nil {
+		t.Fatalf("schedule: %v", err)
+	}
+	if !eligible(t, database, srcID) {
+		t.Fatal("lapsed subscription should fall back to polling")
+	}
+	if n, err := websub.RenewDue(ctx, database, testutil.HTTPClient(t), opts); err != nil || n != 1 {
+		t.Fatalf("renew after lapse: %d %v", n, err)
+	}
+}
+
+// eligible reports whether the source would be polled now.
+func eligible(t *testing.T, database *sql.DB, id int64) bool {
+	t.Helper()
+	rows, err := db.ListSourcesForFetch(context.Background(), database, time.Now())
+	if err != nil {
+		t.Fatalf("list for fetch: %v", err)
+	}
+	for _, r := range rows {
+		if r.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func sign(secret, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func get(t *testing.T, u string) (int, string) {
+	t.Helper()
+	resp, err := http.Get(u)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(b)
+}
+
+func post(t *testing.T, u, body, signature string) int {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodPost, u, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/atom+xml")
+	if signature != "" {
+		req.Header.Set("X-Hub-Signature", signature)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	_ = resp.Body.Close()
+	return resp.StatusCode
+}
@@ -1,9 +1,11 @@
 package commands
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"strconv"
 
 	"github.com/fujidaiti/poppo-press/cli/internal/config"
@@ -35,7 +37,20 @@ func newPaperCmd() *cobra.Command {
 			if id == "" {
 				return fmt.Errorf("--id is required for now")
 			}
-			req, err := hc.NewRequest(cmd.Context(), http.MethodGet, "/v1/editions/"+id, nil)
+			format, _ := cmd.Flags().GetString("format")
+			media, _ := cmd.Flags().GetString("media")
+			q := url.Values{}
+			if format != "" {
+				q.Set("format", format)
+			}
+			if media != "" {
+				q.Set("media", media)
+			}
+			path := "/v1/editions/" + id
+			if len(q) > 0 {
+				path += "?" + q.Encode()
+			}
+			req, err := hc.NewRequest(cmd.Context(), http.MethodGet, path, nil)
 			if err != nil {
 				return err
 			}
@@ -53,8 +68,71 @@ func newPaperCmd() *cobra.Command {
 		},
 	}
 	read.Flags().String("id", "", "edition id")
+	read.Flags().String("format", "text", "summary rendition: text, markdown, or html")
+	read.Flags().String("media", "", "only articles with media: audio, video, any, or none")
 	cmd.AddCommand(read)
 
+	media := &cobra.Command{
+		Use:     "media",
+		Short:   "List the media links of an edition",
+		Example: "pp paper media --id 17\npp paper media --id 17 --kind audio",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := config.Load()
+			if err != nil {
+				return err
+			}
+			hc, err := httpc.New(c.Server, c.Token)
+			if err != nil {
+				return err
+			}
+			id, _ := cmd.Flags().GetString("id")
+			if id == "" {
+				return fmt.Errorf("--id is required for now")
+			}
+			kind, _ := cmd.Flags().GetString("kind")
+			if kind != "audio" && kind != "video" && kind != "any" {
+				return fmt.Errorf("invalid --kind %q: use audio, video, or any", kind)
+			}
+			req, err := hc.NewRequest(cmd.Context(), http.MethodGet, "/v1/editions/"+id+"?media="+url.QueryEscape(kind), nil)
+			if err != nil {
+				return err
+			}
+			resp, err := hc.Do(req)
+			if err != nil {
+				return err
+			}
+			defer resp.Body.Close()
+			var ed struct {
+				Articles []struct {
+					ID         json.Number `json:"id"`
+					Enclosures []struct {
+						URL  string `json:"url"`
+						Kind string `json:"kind"`
+					} `json:"enclosures"`
+				} `json:"articles"`
+			}
+			if err := json.NewDecoder(resp.Body).Decode(&ed); err != nil {
+				return fmt.Errorf("decode edition: %w", err)
+			}
+			w := cmd.OutOrStdout()
+			for _, a := range ed.Articles {
+				for _, e := range a.Enclosures {
+					if e.Kind != "audio" && e.Kind != "video" {
+						continue
+					}
+					if kind != "any" && e.Kind != kind {
+						continue
+					}
+					fmt.Fprintf(w, "%s %s %s\n", a.ID, e.Kind, e.URL)
+				}
+			}
+			return nil
+		},
+	}
+	media.Flags().String("id", "", "edition id")
+	media.Flags().String("kind", "any", "audio, video, or any")
+	cmd.AddCommand(media)
+
 	list := &cobra.Command{
 		Use:     "list",
 		Short:   "List recent editions",
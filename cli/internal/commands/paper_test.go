@@ -17,6 +17,9 @@ func TestPaper_List_Read(t *testing.T) {
 			_ = json.NewEncoder(w).Encode([]map[string]any{{"id": "17", "localDate": "2025-10-19", "articleCount": 2}})
 			return
 		case r.Method == http.MethodGet && r.URL.Path == "/v1/editions/17":
+			if got := r.URL.Query().Get("format"); got != "text" {
+				t.Errorf("expected plain-text summaries by default, got format=%q", got)
+			}
 			w.Header().Set("Content-Type", "application/json")
 			_ = json.NewEncoder(w).Encode(map[string]any{
 				"id":        "17",
@@ -69,3 +72,42 @@ func TestPaper_List_Read(t *testing.T) {
 		t.Fatalf("expected read output")
 	}
 }
+
+func TestPaper_Media(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", "")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/editions/17" || r.URL.Query().Get("media") != "audio" {
+			t.Fatalf("unexpected request: %s %s", r.Method, r.URL)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"id": 17,
+			"articles": []map[string]any{
+				{"id": 202, "enclosures": []map[string]any{
+					{"url": "https://ex/ep.mp3", "kind": "audio"},
+					{"url": "https://ex/cover.jpg", "kind": "image"},
+				}},
+			},
+		})
+	}))
+	t.Cleanup(srv.Close)
+
+	init := NewRootCmd()
+	init.SetArgs([]string{"init", "--server", srv.URL})
+	if err := init.Execute(); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	t.Setenv("PP_TOKEN", "tok")
+
+	var out bytes.Buffer
+	media := NewRootCmd()
+	media.SetOut(&out)
+	media.SetArgs([]string{"paper", "media", "--id", "17", "--kind", "audio"})
+	if err := media.Execute(); err != nil {
+		t.Fatalf("paper media: %v", err)
+	}
+	if got := out.String(); got != "202 audio https://ex/ep.mp3\n" {
+		t.Fatalf("unexpected output: %q", got)
+	}
+}
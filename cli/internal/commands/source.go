@@ -4,10 +4,13 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/fujidaiti/poppo-press/cli/internal/config"
 	"github.com/fujidaiti/poppo-press/cli/internal/httpc"
@@ -22,11 +25,11 @@ func newSourceCmd() *cobra.Command {
 	}
 	cmd.PersistentFlags().Bool("verbose", false, "print HTTP request/response traces")
 
-	cmd.AddCommand(&cobra.Command{
+	add := &cobra.Command{
 		Use:     "add <url>",
 		Short:   "Add a source",
 		Args:    cobra.ExactArgs(1),
-		Example: "pp source add https://example.com/feed.xml",
+		Example: "pp source add https://example.com/feed.xml\npp source add https://example.com/blog/\npp source add --pick 2 https://example.com/blog/\npp source add --extract https://example.com/summaries.xml\npp source add --auth basic:me:\"$PASS\" https://example.com/members.xml\npp source add --auth bearer:\"$TOKEN\" https://example.com/private.atom\npp source add --auth query:token=\"$TOKEN\" https://example.com/feed.rss\npp source add --scrape --item article --title 'h2 a' --date time --preview https://example.com/news/\npp source add --adapter hn --config '{\"minPoints\":100}' 'https://hn.algolia.com/api/v1/search?tags=front_page'\npp source add --adapter github https://api.github.com/repos/golang/go/tags\npp source add https://www.youtube.com/channel/UC_x5XG1OV2P6uZZ5FSM9Ttw",
 		RunE: func(cmd *cobra.Command, args []string) error {
 			c, err := config.Load()
 			if err != nil {
@@ -42,27 +45,101 @@ func newSourceCmd() *cobra.Command {
 			if err != nil {
 				return err
 			}
-			body, _ := json.Marshal(map[string]string{"url": args[0]})
-			req, err := hc.NewRequest(context.Background(), http.MethodPost, "/v1/sources", bytes.NewReader(body))
-			if err != nil {
-				return err
+			payload := map[string]any{"url": args[0]}
+			if extract, _ := cmd.Flags().GetBool("extract"); extract {
+				payload["contentMode"] = "extract"
+			}
+			if spec, _ := cmd.Flags().GetString("auth"); spec != "" {
+				a, err := parseAuth(spec)
+				if err != nil {
+					return &httpc.Error{Code: 2, Err: err}
+				}
+				payload["auth"] = a
+			}
+			preview, _ := cmd.Flags().GetBool("preview")
+			adapter, _ := cmd.Flags().GetString("adapter")
+			scrapeFlag, _ := cmd.Flags().GetBool("scrape")
+			if cfg, _ := cmd.Flags().GetString("config"); cfg != "" {
+				if adapter == "" {
+					return &httpc.Error{Code: 2, Err: errors.New("--config requires --adapter")}
+				}
+				if !json.Valid([]byte(cfg)) {
+					return &httpc.Error{Code: 2, Err: errors.New("--config must be a JSON object")}
+				}
+				payload["config"] = json.RawMessage(cfg)
+			}
+			if adapter != "" {
+				if scrapeFlag {
+					return &httpc.Error{Code: 2, Err: errors.New("--adapter and --scrape are mutually exclusive")}
+				}
+				payload["kind"] = adapter
+			} else if scrapeFlag {
+				sel := map[string]string{}
+				for _, name := range []string{"item", "title", "link", "date", "summary"} {
+					if v, _ := cmd.Flags().GetString(name); v != "" {
+						sel[name] = v
+					}
+				}
+				if sel["item"] == "" || sel["title"] == "" {
+					return &httpc.Error{Code: 2, Err: errors.New("--scrape requires --item and --title")}
+				}
+				payload["kind"] = "scrape"
+				payload["scrape"] = sel
+			} else if preview {
+				return &httpc.Error{Code: 2, Err: errors.New("--preview requires --scrape or --adapter")}
+			}
+			if preview {
+				return previewSource(cmd, hc, payload)
+			}
+			pick, _ := cmd.Flags().GetInt("pick")
+			resp, err := postSource(cmd.Context(), hc, payload)
+			var he *httpc.Error
+			if errors.As(err, &he) && he.Status == http.StatusMultipleChoices {
+				candidates := feedCandidates(he.Body)
+				if pick < 1 || pick > len(candidates) {
+					w := cmd.OutOrStdout()
+					fmt.Fprintf(w, "Multiple feeds found at %s:\n", args[0])
+					for i, c := range candidates {
+						fmt.Fprintf(w, "  %d. %s  %s\n", i+1, c.URL, c.Title)
+					}
+					return &httpc.Error{Code: 2, Status: he.Status, Body: he.Body, Err: errors.New("multiple feeds found; re-run with --pick N or one of the feed URLs")}
+				}
+				payload["url"] = candidates[pick-1].URL
+				resp, err = postSource(cmd.Context(), hc, payload)
 			}
-			req.Header.Set("Content-Type", "application/json")
-			resp, err := hc.Do(req)
 			if err != nil {
 				return err
 			}
 			defer resp.Body.Close()
 			var out struct {
-				ID any `json:"id"`
+				ID          any    `json:"id"`
+				URL         string `json:"url"`
+				OriginalURL string `json:"originalUrl"`
 			}
 			if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
 				return err
 			}
 			fmt.Fprintln(cmd.OutOrStdout(), out.ID)
+			if out.OriginalURL != "" && out.URL != "" && out.OriginalURL != out.URL {
+				// the server resolved the URL to a feed: show what was subscribed to
+				fmt.Fprintf(cmd.OutOrStdout(), "%s -> %s\n", out.OriginalURL, out.URL)
+			}
 			return nil
 		},
-	})
+	}
+	add.Flags().Bool("extract", false, "extract full text from linked pages when the feed only has summaries")
+	add.Flags().Int("pick", 0, "when the page offers several feeds, subscribe to the Nth candidate")
+	add.Flags().Bool("scrape", false, "the URL is a web page without a feed; build items from the CSS selectors below")
+	add.Flags().String("item", "", "with --scrape: selector of the element holding each item")
+	add.Flags().String("title", "", "with --scrape: selector of the item title, within the item")
+	add.Flags().String("link", "", "with --scrape: selector of the item link (default: the title's or the item's first link)")
+	add.Flags().String("date", "", "with --scrape: selector of the item date (datetime attribute or text)")
+	add.Flags().String("summary", "", "with --scrape: selector of the item summary")
+	add.Flags().Bool("preview", false, "with --scrape or --adapter: print the items the source yields instead of adding it")
+	add.Flags().String("adapter", "", "the URL is a JSON API read by a built-in adapter: hn, reddit, or github")
+	add.Flags().String("config", "", `with --adapter: adapter settings as JSON, e.g. '{"minPoints":100}'`)
+	add.Flags().String("auth", "", "credential for the feed: basic:USER:PASS, bearer:TOKEN, or query:PARAM=TOKEN (stored encrypted, never shown)")
+	cmd.AddCommand(add)
 
 	cmd.AddCommand(&cobra.Command{
 		Use:   "list",
@@ -101,6 +178,59 @@ func newSourceCmd() *cobra.Command {
 		Example: "pp source list",
 	})
 
+	edit := &cobra.Command{
+		Use:     "edit <id>",
+		Short:   "Change source settings",
+		Args:    cobra.ExactArgs(1),
+		Example: "pp source edit 12 --interval 30m\npp source edit 12 --interval auto",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := config.Load()
+			if err != nil {
+				return err
+			}
+			verbose, _ := cmd.Flags().GetBool("verbose")
+			var hc *httpc.Client
+			if verbose {
+				hc, err = httpc.New(c.Server, c.Token, httpc.WithVerbose(cmd.ErrOrStderr()))
+			} else {
+				hc, err = httpc.New(c.Server, c.Token)
+			}
+			if err != nil {
+				return err
+			}
+			id := args[0]
+			if _, err := strconv.ParseInt(id, 10, 64); err != nil {
+				return fmt.Errorf("invalid id: %s", id)
+			}
+			if !cmd.Flags().Changed("interval") {
+				return fmt.Errorf("nothing to change; pass --interval")
+			}
+			interval, _ := cmd.Flags().GetString("interval")
+			payload := map[string]any{"pollIntervalSeconds": nil}
+			if interval != "auto" {
+				d, err := time.ParseDuration(interval)
+				if err != nil || d <= 0 {
+					return fmt.Errorf("invalid --interval %q: use a duration like 30m or \"auto\"", interval)
+				}
+				payload["pollIntervalSeconds"] = int64(d / time.Second)
+			}
+			body, _ := json.Marshal(payload)
+			req, err := hc.NewRequest(cmd.Context(), http.MethodPatch, "/v1/sources/"+id, bytes.NewReader(body))
+			if err != nil {
+				return err
+			}
+			req.Header.Set("Content-Type", "application/json")
+			resp, err := hc.Do(req)
+			if err != nil {
+				return err
+			}
+			defer resp.Body.Close()
+			return nil
+		},
+	}
+	edit.Flags().String("interval", "", `polling interval (e.g. 30m, 6h), or "auto" to follow the feed's hints`)
+	cmd.AddCommand(edit)
+
 	cmd.AddCommand(&cobra.Command{
 		Use:     "rm <id>",
 		Short:   "Remove a source",
@@ -140,3 +270,89 @@ func newSourceCmd() *cobra.Command {
 
 	return cmd
 }
+
+// feedCandidate is one of the feeds offered by a web page when adding a
+// source by site URL.
+type feedCandidate struct {
+	URL   string `json:"url"`
+	Title string `json:"title"`
+}
+
+// postSource sends a create-source request.
+func postSource(ctx context.Context, hc *httpc.Client, payload map[string]any) (*http.Response, error) {
+	body, _ := json.Marshal(payload)
+	req, err := hc.NewRequest(ctx, http.MethodPost, "/v1/sources", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return hc.Do(req)
+}
+
+// previewSource prints the items a scraper or adapter source would yield, one per line
+// with its date and URL.
+func previewSource(cmd *cobra.Command, hc *httpc.Client, payload map[string]any) error {
+	body, _ := json.Marshal(payload)
+	req, err := hc.NewRequest(cmd.Context(), http.MethodPost, "/v1/sources/preview", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := hc.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var out struct {
+		Title string `json:"title"`
+		Items []struct {
+			Title       string `json:"title"`
+			URL         string `json:"url"`
+			PublishedAt string `json:"publishedAt"`
+		} `json:"items"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return err
+	}
+	w := cmd.OutOrStdout()
+	fmt.Fprintf(w, "%s (%d items)\n", out.Title, len(out.Items))
+	for i, it := range out.Items {
+		date := it.PublishedAt
+		if date == "" {
+			date = "-"
+		}
+		fmt.Fprintf(w, "%d. %s  %s  %s\n", i+1, it.Title, date, it.URL)
+	}
+	return nil
+}
+
+// parseAuth turns an --auth value into the auth object of the add request.
+func parseAuth(spec string) (map[string]string, error) {
+	kind, rest, _ := strings.Cut(spec, ":")
+	switch kind {
+	case "basic":
+		user, pass, _ := strings.Cut(rest, ":")
+		if user != "" {
+			return map[string]string{"type": kind, "username": user, "password": pass}, nil
+		}
+	case "bearer":
+		if rest != "" {
+			return map[string]string{"type": kind, "token": rest}, nil
+		}
+	case "query":
+		param, token, _ := strings.Cut(rest, "=")
+		if param != "" && token != "" {
+			return map[string]string{"type": kind, "param": param, "token": token}, nil
+		}
+	}
+	return nil, errors.New("invalid --auth: want basic:USER:PASS, bearer:TOKEN, or query:PARAM=TOKEN")
+}
+
+// feedCandidates decodes the candidate list of a 300 response.
+func feedCandidates(body []byte) []feedCandidate {
+	var out struct {
+		Candidates []feedCandidate `json:"candidates"`
+	}
+	_ = json.Unmarshal(body, &out)
+	return out.Candidates
+}
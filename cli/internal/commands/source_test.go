@@ -3,10 +3,13 @@ package commands
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+
+	"github.com/fujidaiti/poppo-press/cli/internal/httpc"
 )
 
 func TestSource_Add_List_Rm(t *testing.T) {
@@ -77,3 +80,314 @@ func TestSource_Add_List_Rm(t *testing.T) {
 		t.Fatalf("rm: %v", err)
 	}
 }
+
+func TestSource_Add_ExtractSendsContentMode(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", "")
+	var got map[string]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v1/sources" {
+			t.Fatalf("unexpected request: %s %s", r.Method, r.URL.Path)
+		}
+		_ = json.NewDecoder(r.Body).Decode(&got)
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]any{"id": 7})
+	}))
+	t.Cleanup(srv.Close)
+
+	root := NewRootCmd()
+	root.SetArgs([]string{"init", "--server", srv.URL})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	t.Setenv("PP_TOKEN", "tok")
+
+	var out bytes.Buffer
+	add := NewRootCmd()
+	add.SetOut(&out)
+	add.SetArgs([]string{"source", "add", "--extract", "https://e/x"})
+	if err := add.Execute(); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	if got["url"] != "https://e/x" || got["contentMode"] != "extract" {
+		t.Fatalf("unexpected request body: %v", got)
+	}
+}
+
+func TestSource_Add_AuthSendsCredential(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", "")
+	var got struct {
+		Auth map[string]string `json:"auth"`
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&got)
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]any{"id": 7})
+	}))
+	t.Cleanup(srv.Close)
+
+	root := NewRootCmd()
+	root.SetArgs([]string{"init", "--server", srv.URL})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	t.Setenv("PP_TOKEN", "tok")
+
+	add := NewRootCmd()
+	add.SetOut(&bytes.Buffer{})
+	add.SetArgs([]string{"source", "add", "--auth", "basic:me:p:w", "https://e/x"})
+	if err := add.Execute(); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	if got.Auth["type"] != "basic" || got.Auth["username"] != "me" || got.Auth["password"] != "p:w" {
+		t.Fatalf("unexpected auth: %v", got.Auth)
+	}
+
+	add = NewRootCmd()
+	add.SetOut(&bytes.Buffer{})
+	add.SetErr(&bytes.Buffer{})
+	add.SetArgs([]string{"source", "add", "--auth", "query:token", "https://e/x"})
+	if err := add.Execute(); err == nil {
+		t.Fatalf("expected invalid --auth to fail")
+	}
+}
+
+func TestSource_Add_ScrapePreviewAndAdd(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", "")
+	var got struct {
+		Kind   string            `json:"kind"`
+		Scrape map[string]string `json:"scrape"`
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&got)
+		if r.URL.Path == "/v1/sources/preview" {
+			_ = json.NewEncoder(w).Encode(map[string]any{"title": "News", "items": []map[string]any{
+				{"title": "Hello", "url": "https://e/p/1", "publishedAt": "2025-01-02T00:00:00Z"},
+				{"title": "World", "url": "https://e/p/2", "publishedAt": nil},
+			}})
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]any{"id": 3})
+	}))
+	t.Cleanup(srv.Close)
+
+	root := NewRootCmd()
+	root.SetArgs([]string{"init", "--server", srv.URL})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	t.Setenv("PP_TOKEN", "tok")
+
+	var out bytes.Buffer
+	cmd := NewRootCmd()
+	cmd.SetOut(&out)
+	cmd.SetArgs([]string{"source", "add", "--scrape", "--item", ".entry", "--title", "h3 a", "--preview", "https://e/"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("preview: %v", err)
+	}
+	want := "News (2 items)\n1. Hello  2025-01-02T00:00:00Z  https://e/p/1\n2. World  -  https://e/p/2\n"
+	if out.String() != want || got.Kind != "scrape" || got.Scrape["title"] != "h3 a" {
+		t.Fatalf("unexpected preview output %q (request %+v)", out.String(), got)
+	}
+
+	out.Reset()
+	cmd = NewRootCmd()
+	cmd.SetOut(&out)
+	cmd.SetArgs([]string{"source", "add", "--scrape", "--item", ".entry", "--title", "h3", "https://e/"})
+	if err := cmd.Execute(); err != nil || out.String() != "3\n" {
+		t.Fatalf("add: %v, out=%q", err, out.String())
+	}
+
+	cmd = NewRootCmd()
+	cmd.SetOut(&bytes.Buffer{})
+	cmd.SetErr(&bytes.Buffer{})
+	cmd.SetArgs([]string{"source", "add", "--scrape", "--item", ".entry", "https://e/"})
+	if err := cmd.Execute(); err == nil {
+		t.Fatalf("expected --scrape without --title to fail")
+	}
+}
+
+func TestSource_Add_AdapterSendsKindAndConfig(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", "")
+	var got struct {
+		Kind   string         `json:"kind"`
+		Config map[string]int `json:"config"`
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&got)
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]any{"id": 4})
+	}))
+	t.Cleanup(srv.Close)
+
+	root := NewRootCmd()
+	root.SetArgs([]string{"init", "--server", srv.URL})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	t.Setenv("PP_TOKEN", "tok")
+
+	var out bytes.Buffer
+	cmd := NewRootCmd()
+	cmd.SetOut(&out)
+	cmd.SetArgs([]string{"source", "add", "--adapter", "hn", "--config", `{"minPoints":100}`, "https://hn.example/api/v1/search"})
+	if err := cmd.Execute(); err != nil || out.String() != "4\n" {
+		t.Fatalf("add: %v, out=%q", err, out.String())
+	}
+	if got.Kind != "hn" || got.Config["minPoints"] != 100 {
+		t.Fatalf("unexpected request %+v", got)
+	}
+
+	for _, args := range [][]string{
+		{"--config", `{"minPoints":1}`},
+		{"--adapter", "hn", "--config", "{oops"},
+		{"--adapter", "hn", "--scrape", "--item", "li", "--title", "a"},
+	} {
+		cmd = NewRootCmd()
+		cmd.SetOut(&bytes.Buffer{})
+		cmd.SetErr(&bytes.Buffer{})
+		cmd.SetArgs(append(append([]string{"source", "add"}, args...), "https://hn.example/"))
+		if err := cmd.Execute(); err == nil {
+			t.Fatalf("%v: expected failure", args)
+		}
+	}
+}
+
+func TestSource_Add_PrintsResolvedURL(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", "")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		resolved := body["url"]
+		if strings.Contains(resolved, "/channel/") {
+			resolved = "https://www.youtube.com/feeds/videos.xml?channel_id=UC1"
+		}
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]any{"id": 5, "url": resolved, "originalUrl": body["url"]})
+	}))
+	t.Cleanup(srv.Close)
+
+	root := NewRootCmd()
+	root.SetArgs([]string{"init", "--server", srv.URL})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	t.Setenv("PP_TOKEN", "tok")
+
+	for _, c := range []struct{ url, want string }{
+		{"https://www.youtube.com/channel/UC1", "5\nhttps://www.youtube.com/channel/UC1 -> https://www.youtube.com/feeds/videos.xml?channel_id=UC1\n"},
+		{"https://blog.example/feed.xml", "5\n"},
+	} {
+		var out bytes.Buffer
+		cmd := NewRootCmd()
+		cmd.SetOut(&out)
+		cmd.SetArgs([]string{"source", "add", c.url})
+		if err := cmd.Execute(); err != nil || out.String() != c.want {
+			t.Fatalf("add %s: %v, out=%q", c.url, err, out.String())
+		}
+	}
+}
+
+func TestSource_Add_MultipleFeedsListsAndPicks(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", "")
+	var posted []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		posted = append(posted, body["url"])
+		w.Header().Set("Content-Type", "application/json")
+		if body["url"] == "https://blog.example/" {
+			w.WriteHeader(http.StatusMultipleChoices)
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"error":      map[string]any{"code": "multiple_feeds", "message": "choose"},
+				"candidates": []map[string]string{{"url": "https://blog.example/all.rss", "title": "All"}, {"url": "https://blog.example/go.rss", "title": "Go"}},
+			})
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]any{"id": 9, "url": body["url"]})
+	}))
+	t.Cleanup(srv.Close)
+
+	root := NewRootCmd()
+	root.SetArgs([]string{"init", "--server", srv.URL})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	t.Setenv("PP_TOKEN", "tok")
+
+	// without --pick: candidates are listed and a validation error is returned
+	var out bytes.Buffer
+	add := NewRootCmd()
+	add.SetOut(&out)
+	add.SetErr(&bytes.Buffer{})
+	add.SetArgs([]string{"source", "add", "https://blog.example/"})
+	err := add.Execute()
+	var he *httpc.Error
+	if !errors.As(err, &he) || he.Code != 2 {
+		t.Fatalf("expected validation error, got %v", err)
+	}
+	if !strings.Contains(out.String(), "2. https://blog.example/go.rss  Go") {
+		t.Fatalf("expected candidate list, got %q", out.String())
+	}
+
+	// with --pick: the chosen candidate is added
+	out.Reset()
+	posted = nil
+	add = NewRootCmd()
+	add.SetOut(&out)
+	add.SetArgs([]string{"source", "add", "--pick", "2", "https://blog.example/"})
+	if err := add.Execute(); err != nil {
+		t.Fatalf("add --pick: %v", err)
+	}
+	if len(posted) != 2 || posted[1] != "https://blog.example/go.rss" || strings.TrimSpace(out.String()) != "9" {
+		t.Fatalf("unexpected pick flow: posted=%v out=%q", posted, out.String())
+	}
+}
+
+func TestSource_Edit_Interval(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", "")
+	var bodies []map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPatch || r.URL.Path != "/v1/sources/12" {
+			t.Fatalf("unexpected request: %s %s", r.Method, r.URL.Path)
+		}
+		var b map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&b)
+		bodies = append(bodies, b)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(srv.Close)
+
+	root := NewRootCmd()
+	root.SetArgs([]string{"init", "--server", srv.URL})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	t.Setenv("PP_TOKEN", "tok")
+
+	for _, arg := range []string{"30m", "auto"} {
+		edit := NewRootCmd()
+		edit.SetArgs([]string{"source", "edit", "12", "--interval", arg})
+		if err := edit.Execute(); err != nil {
+			t.Fatalf("edit %s: %v", arg, err)
+		}
+	}
+	if len(bodies) != 2 || bodies[0]["pollIntervalSeconds"] != float64(1800) || bodies[1]["pollIntervalSeconds"] != nil {
+		t.Fatalf("unexpected request bodies: %v", bodies)
+	}
+
+	bad := NewRootCmd()
+	bad.SetErr(&bytes.Buffer{})
+	bad.SetArgs([]string{"source", "edit", "12", "--interval", "soon"})
+	if err := bad.Execute(); err == nil {
+		t.Fatal("expected invalid interval to fail")
+	}
+}
@@ -22,14 +22,18 @@ func WithTimeout(d time.Duration) Option { return func(c *Client) { c.http.Timeo
 func WithVerbose(w io.Writer) Option { return func(c *Client) { c.verbose = w } }
 
 // Error represents an operation error with a mapped exit code per CLI policy.
-// Error represents an operation error with a mapped exit code per CLI policy.
-// For HTTP errors, Status will be non-zero.
+// For HTTP errors, Status will be non-zero and Body holds the leading bytes
+// of the response body so callers can decode structured error payloads.
 type Error struct {
-	Code   int   // 0 success; 1 generic; 2 validation; 3 auth; 4 network
-	Status int   // HTTP status if applicable (non-zero for HTTP responses)
-	Err    error // underlying error
+	Code   int    // 0 success; 1 generic; 2 validation; 3 auth; 4 network
+	Status int    // HTTP status if applicable (non-zero for HTTP responses)
+	Body   []byte // response body, truncated to maxErrorBody
+	Err    error  // underlying error
 }
 
+// maxErrorBody bounds how much of a non-2xx response body is kept.
+const maxErrorBody = 64 << 10
+
 func (e *Error) Error() string { return e.Err.Error() }
 func (e *Error) Unwrap() error { return e.Err }
 
@@ -90,16 +94,20 @@ func (c *Client) Do(req *http.Request) (*http.Response, error) {
 	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
 		return resp, nil
 	}
-	// Drain body for completeness; caller shouldn't rely on it on errors
+	// Keep the body on the error; the response itself is closed here
 	var buf bytes.Buffer
-	_, _ = io.CopyN(&buf, resp.Body, 1024)
+	_, _ = io.CopyN(&buf, resp.Body, maxErrorBody)
 	resp.Body.Close()
 	code := mapStatusToExitCode(resp.StatusCode)
-	msg := strings.TrimSpace(buf.String())
-	if msg == "" {
-		msg = resp.Status
+	msg := buf.Bytes()
+	if len(msg) > 1024 {
+		msg = msg[:1024]
+	}
+	text := strings.TrimSpace(string(msg))
+	if text == "" {
+		text = resp.Status
 	}
-	return nil, &Error{Code: code, Status: resp.StatusCode, Err: errors.New(msg)}
+	return nil, &Error{Code: code, Status: resp.StatusCode, Body: buf.Bytes(), Err: errors.New(text)}
 }
 
 func mapStatusToExitCode(status int) int {